@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"openclaw-setup/internal/config"
+	"openclaw-setup/internal/handlers"
+)
+
+type applyOptions struct {
+	composeDir string
+	statePath  string
+	planOnly   bool
+	noRestart  bool
+	proxyEnv   bool
+	// runtime restarts the containers; DockerRuntime when nil.
+	runtime handlers.ContainerRuntime
+}
+
+// parseApplyArgs parses `plan` and `apply`, which take the same state file
+// argument; -no-restart only matters to apply.
+func parseApplyArgs(command, composeDir string, args []string) (applyOptions, error) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	proxyEnv := flags.Bool("proxy-env", proxyEnvMode(), "write SETUP_PROXY into data/conf/.env for the gateway")
+	noRestart := flags.Bool("no-restart", false, "write the configuration without restarting the containers")
+	if err := flags.Parse(args); err != nil {
+		return applyOptions{}, err
+	}
+	if flags.NArg() != 1 {
+		return applyOptions{}, fmt.Errorf("usage: openclaw-setup %s [flags] <state.json|state.yaml>", command)
+	}
+	return applyOptions{
+		composeDir: composeDir,
+		statePath:  flags.Arg(0),
+		planOnly:   command == "plan",
+		noRestart:  *noRestart,
+		proxyEnv:   *proxyEnv,
+	}, nil
+}
+
+// runApply renders the desired state with the same writer as init and the
+// server and compares it with the files on disk. Nothing is written and
+// nothing restarts when they already match, so applying a state twice is
+// a no-op.
+func runApply(opts applyOptions) error {
+	composeDir, err := resolveComposeDir(opts.composeDir)
+	if err != nil {
+		return err
+	}
+	state, err := config.LoadDesiredState(opts.statePath)
+	if err != nil {
+		return err
+	}
+	configDir := filepath.Join(composeDir, "data", "conf")
+	config.Secrets.AddFromConfigDir(configDir)
+
+	writeOpts, err := state.WriteOptions(configDir)
+	if err != nil {
+		return err
+	}
+	if writeOpts.GatewayToken == "" {
+		token, err := initGatewayToken(composeDir, false)
+		if err != nil {
+			return err
+		}
+		writeOpts.GatewayToken = token
+	}
+	if opts.proxyEnv {
+		outbound, err := outboundFromEnv()
+		if err != nil {
+			return err
+		}
+		writeOpts.Proxy = outbound.ProxyEnv()
+	}
+	checks, _ := handlers.CheckReachability(context.Background(), writeOpts.Providers, handlers.ReachabilityOptions{})
+	for _, check := range checks {
+		if check.Warning != "" {
+			log.Print(check.Warning)
+		}
+	}
+
+	if !opts.planOnly {
+		unlock, err := config.LockComposeDir(composeDir)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	changes, err := config.PreviewConfigAndEnv(writeOpts)
+	if err != nil {
+		return err
+	}
+	// The compose .env carries the token too, when there is one.
+	envPath := filepath.Join(composeDir, ".env")
+	_, statErr := os.Stat(envPath)
+	hasComposeEnv := statErr == nil
+	if hasComposeEnv {
+		composeEnv, err := renderComposeToken(envPath, writeOpts.GatewayToken)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, config.DiffFile(envPath, composeEnv))
+	}
+
+	pending := 0
+	for _, change := range changes {
+		if change.Action != "unchanged" {
+			pending++
+		}
+	}
+	printChanges(changes)
+	if pending == 0 {
+		fmt.Println("no changes")
+		return nil
+	}
+	if opts.planOnly {
+		fmt.Printf("%d file(s) would change; run apply to write them\n", pending)
+		return nil
+	}
+
+	if err := config.WriteConfigAndEnv(writeOpts); err != nil {
+		return err
+	}
+	if hasComposeEnv {
+		if err := writeComposeToken(envPath, writeOpts.GatewayToken); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d file(s) written\n", pending)
+	if opts.noRestart {
+		return nil
+	}
+	runtime := opts.runtime
+	if runtime == nil {
+		runtime = handlers.DockerRuntime{}
+	}
+	if err := runtime.Restart(context.Background(), composeDir); err != nil {
+		return fmt.Errorf("configuration written, but restart failed: %w", err)
+	}
+	fmt.Println("containers restarted")
+	return nil
+}
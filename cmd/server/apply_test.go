@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"openclaw-setup/internal/config"
+	"openclaw-setup/internal/handlers"
+)
+
+// fakeRuntime counts restarts instead of driving docker.
+type fakeRuntime struct {
+	mu       sync.Mutex
+	restarts int
+}
+
+func (f *fakeRuntime) Restart(ctx context.Context, composeDir string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.restarts++
+	return nil
+}
+
+func (f *fakeRuntime) Probe(ctx context.Context, container, rawURL string) error {
+	return handlers.ErrContainerNotRunning
+}
+
+func (f *fakeRuntime) Env(ctx context.Context, container, key string) (string, error) {
+	return "", handlers.ErrContainerNotRunning
+}
+
+func (f *fakeRuntime) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.restarts
+}
+
+const testState = `{
+  "model": "openai/gpt-4o",
+  "fallbacks": ["ollama/qwen3:8b"],
+  "providers": [
+    {"id": "openai", "apiKey": "${TEST_OPENAI_KEY}"},
+    {"id": "ollama", "baseUrl": "http://192.168.1.20:11434/v1", "models": ["llama3.2:3b"]}
+  ],
+  "gateway": {"port": 19001},
+  "channels": {"telegram": {"enabled": true, "botToken": "${TELEGRAM_BOT_TOKEN}"}},
+  "env": {"TELEGRAM_BOT_TOKEN": "${TEST_TELEGRAM_TOKEN}"}
+}
+`
+
+func writeTestState(t *testing.T, dir string) string {
+	t.Helper()
+	t.Setenv("TEST_OPENAI_KEY", "sk-test-openai-0001")
+	t.Setenv("TEST_TELEGRAM_TOKEN", "123456:telegram-test-token")
+	path := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(path, []byte(testState), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readConfig(t *testing.T, composeDir string) map[string]interface{} {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(composeDir, "data", "conf", "openclaw.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func lookup(value interface{}, path ...string) interface{} {
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// TestSaveAfterApplyKeepsState saves from the web UI after apply and
+// expects everything the UI does not edit to survive.
+func TestSaveAfterApplyKeepsState(t *testing.T) {
+	composeDir := t.TempDir()
+	statePath := writeTestState(t, t.TempDir())
+	if err := runApply(applyOptions{composeDir: composeDir, statePath: statePath, noRestart: true}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	configDir := filepath.Join(composeDir, "data", "conf")
+	token, _, err := config.ExistingGatewayToken(composeDir)
+	if err != nil || token == "" {
+		t.Fatalf("apply left no gateway token: %v", err)
+	}
+
+	runtime := &fakeRuntime{}
+	handler := handlers.NewConfigHandler(handlers.ServerConfig{
+		ComposeDir: composeDir,
+		ConfigDir:  configDir,
+		Offline:    true,
+		Runtime:    runtime,
+	}, handlers.NewModelCatalog("", nil), nil)
+	body := `{"model":"openai/gpt-4o-mini","gatewayToken":"","providers":[
+		{"key":"OPENAI_API_KEY","value":"sk-test-openai-0002","provider":"openai"},
+		{"provider":"ollama","baseUrl":"http://192.168.1.20:11434/v1"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/config", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", rec.Code, rec.Body)
+	}
+	if runtime.count() != 1 {
+		t.Errorf("restarts = %d, want 1", runtime.count())
+	}
+
+	cfg := readConfig(t, composeDir)
+	if got := lookup(cfg, "agents", "defaults", "model", "primary"); got != "openai/gpt-4o-mini" {
+		t.Errorf("primary = %v, want the saved model", got)
+	}
+	fallbacks, _ := lookup(cfg, "agents", "defaults", "model", "fallbacks").([]interface{})
+	if len(fallbacks) != 1 || fallbacks[0] != "ollama/qwen3:8b" {
+		t.Errorf("fallbacks = %v, want the applied ones", fallbacks)
+	}
+	if got := lookup(cfg, "gateway", "port"); got != float64(19001) {
+		t.Errorf("gateway.port = %v, want 19001", got)
+	}
+	if got := lookup(cfg, "gateway", "auth", "token"); got != token {
+		t.Errorf("gateway token changed on save")
+	}
+	if got := lookup(cfg, "channels", "telegram", "botToken"); got != "${TELEGRAM_BOT_TOKEN}" {
+		t.Errorf("channels.telegram.botToken = %v, want the applied reference", got)
+	}
+	var ollamaModels []string
+	models, _ := lookup(cfg, "models", "providers", "ollama", "models").([]interface{})
+	for _, model := range models {
+		ollamaModels = append(ollamaModels, lookup(model, "id").(string))
+	}
+	if strings.Join(ollamaModels, ",") != "qwen3:8b,llama3.2:3b" {
+		t.Errorf("ollama models = %v, want the fallback and the declared extra", ollamaModels)
+	}
+
+	env, err := os.ReadFile(filepath.Join(configDir, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"OPENAI_API_KEY=sk-test-openai-0002", "TELEGRAM_BOT_TOKEN=123456:telegram-test-token"} {
+		if !strings.Contains(string(env), line+"\n") {
+			t.Errorf(".env is missing %q:\n%s", line, env)
+		}
+	}
+}
+
+const testStateYAML = `model: openai/gpt-4o
+fallbacks:
+  - ollama/qwen3:8b
+providers:
+  - id: openai
+    apiKey: ${TEST_OPENAI_KEY}
+  - id: ollama
+    baseUrl: http://192.168.1.20:11434/v1
+    models: [llama3.2:3b]
+gateway:
+  port: 19001
+channels:
+  telegram:
+    enabled: true
+    botToken: ${TELEGRAM_BOT_TOKEN}
+env:
+  TELEGRAM_BOT_TOKEN: ${TEST_TELEGRAM_TOKEN}
+`
+
+func readConfigFiles(t *testing.T, composeDir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	for _, name := range []string{"data/conf/openclaw.json", "data/conf/.env"} {
+		content, err := os.ReadFile(filepath.Join(composeDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(content)
+	}
+	return files
+}
+
+// TestApplyTwiceIsNoop applies the same state twice, the second time from
+// the YAML form, and expects one write and one restart.
+func TestApplyTwiceIsNoop(t *testing.T) {
+	composeDir := t.TempDir()
+	stateDir := t.TempDir()
+	jsonPath := writeTestState(t, stateDir)
+	yamlPath := filepath.Join(stateDir, "state.yaml")
+	if err := os.WriteFile(yamlPath, []byte(testStateYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	runtime := &fakeRuntime{}
+
+	if err := runApply(applyOptions{composeDir: composeDir, statePath: jsonPath, runtime: runtime}); err != nil {
+		t.Fatalf("first apply: %v", err)
+	}
+	if runtime.count() != 1 {
+		t.Fatalf("restarts after the first apply = %d, want 1", runtime.count())
+	}
+	before := readConfigFiles(t, composeDir)
+	configPath := filepath.Join(composeDir, "data", "conf", "openclaw.json")
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{jsonPath, yamlPath} {
+		if err := runApply(applyOptions{composeDir: composeDir, statePath: path, runtime: runtime}); err != nil {
+			t.Fatalf("apply %s again: %v", filepath.Base(path), err)
+		}
+	}
+	if runtime.count() != 1 {
+		t.Errorf("restarts = %d, want 1: applying the same state again must not restart", runtime.count())
+	}
+	after := readConfigFiles(t, composeDir)
+	for name, content := range before {
+		if after[name] != content {
+			t.Errorf("%s changed on the second apply", name)
+		}
+	}
+	if again, err := os.Stat(configPath); err != nil || !again.ModTime().Equal(info.ModTime()) {
+		t.Errorf("openclaw.json was rewritten on the second apply")
+	}
+}
+
+func TestLoadDesiredStateYAMLMatchesJSON(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := writeTestState(t, dir)
+	yamlPath := filepath.Join(dir, "state.yml")
+	if err := os.WriteFile(yamlPath, []byte(testStateYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := config.LoadDesiredState(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromYAML, err := config.LoadDesiredState(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonOpts, err := fromJSON.WriteOptions("conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlOpts, err := fromYAML.WriteOptions("conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonOpts.GatewayToken, yamlOpts.GatewayToken = "token", "token"
+	jsonFiles, err := config.PreviewConfigAndEnv(jsonOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlFiles, err := config.PreviewConfigAndEnv(yamlOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range jsonFiles {
+		if jsonFiles[i].Diff != yamlFiles[i].Diff {
+			t.Errorf("%s differs between the JSON and YAML state:\n%s\n%s", jsonFiles[i].Path, jsonFiles[i].Diff, yamlFiles[i].Diff)
+		}
+	}
+
+	misspelled := filepath.Join(dir, "bad.yaml")
+	if err := os.WriteFile(misspelled, []byte("model: openai/gpt-4o\nfalbacks: [openai/gpt-4o-mini]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadDesiredState(misspelled); err == nil || !strings.Contains(err.Error(), "falbacks") {
+		t.Errorf("misspelled YAML key: err = %v, want an unknown field error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+func runExport(composeDir string, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "", "output file (default openclaw-setup-<timestamp>.tar.gz)")
+	passphrase := flags.String("passphrase", "", "encrypt openclaw.json and the .env with this passphrase (default OPENCLAW_BUNDLE_PASSPHRASE or _FILE)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := resolvePassphrase(passphrase); err != nil {
+		return err
+	}
+
+	composeDir, err := resolveComposeDir(composeDir)
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		path = fmt.Sprintf("openclaw-setup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create bundle: %w", err)
+	}
+	defer file.Close()
+
+	if err := config.ExportBundle(file, config.ExportOptions{
+		ConfigDir:  filepath.Join(composeDir, "data", "conf"),
+		Version:    version,
+		Passphrase: *passphrase,
+	}); err != nil {
+		os.Remove(path)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+
+	fmt.Printf("bundle written to %s\n", path)
+	return nil
+}
+
+func runImport(composeDir string, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "preview changes without writing")
+	passphrase := flags.String("passphrase", "", "passphrase for an encrypted bundle (default OPENCLAW_BUNDLE_PASSPHRASE or _FILE)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := resolvePassphrase(passphrase); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: openclaw-setup import [-dry-run] [-passphrase value] <bundle.tar.gz>")
+	}
+
+	composeDir, err := resolveComposeDir(composeDir)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("open bundle: %w", err)
+	}
+	defer file.Close()
+
+	if !*dryRun {
+		unlock, err := config.LockComposeDir(composeDir)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	result, err := config.ImportBundle(file, config.ImportOptions{
+		ConfigDir:  filepath.Join(composeDir, "data", "conf"),
+		ComposeDir: composeDir,
+		Passphrase: *passphrase,
+		DryRun:     *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("bundle version %s, created %s\n", result.Manifest.Version, result.Manifest.CreatedAt.Format(time.RFC3339))
+	for _, provider := range result.Providers {
+		fmt.Printf("  provider %s\n", provider.ID)
+	}
+	printChanges(result.Changes)
+	for _, backup := range result.Backups {
+		fmt.Printf("backup: %s\n", backup)
+	}
+	if result.DryRun {
+		fmt.Println("dry run, nothing written")
+	}
+	return nil
+}
+
+// resolvePassphrase fills in the passphrase from OPENCLAW_BUNDLE_PASSPHRASE
+// or OPENCLAW_BUNDLE_PASSPHRASE_FILE when the flag is not given.
+func resolvePassphrase(passphrase *string) error {
+	if *passphrase != "" {
+		config.Secrets.Add(*passphrase)
+		return nil
+	}
+	value, _, err := config.ResolveSecret("OPENCLAW_BUNDLE_PASSPHRASE", config.ProcessEnv())
+	if err != nil {
+		return err
+	}
+	*passphrase = value
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"openclaw-setup/internal/config"
+	"openclaw-setup/internal/handlers"
+)
+
+func runDoctor(composeDir, containerName string, args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "apply the automatic fixes offered, then check again")
+	offline := flags.Bool("offline", offlineMode(), "skip the provider key checks")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	composeDir, err := resolveComposeDir(composeDir)
+	if err != nil {
+		return err
+	}
+	config.Secrets.AddFromConfigDir(filepath.Join(composeDir, "data", "conf"))
+
+	outbound, err := outboundFromEnv()
+	if err != nil {
+		return err
+	}
+	client, err := handlers.NewOutboundClient(outbound)
+	if err != nil {
+		return err
+	}
+	opts := handlers.DoctorOptions{
+		ComposeDir:    composeDir,
+		ContainerName: containerName,
+		Catalog:       handlers.NewModelCatalog(filepath.Join(config.StateDir(composeDir), "models-cache.json"), client),
+		Offline:       *offline,
+	}
+
+	report := handlers.RunDoctor(context.Background(), opts)
+	printDoctorReport(report)
+	if fixes := report.Fixes(); len(fixes) > 0 {
+		if !*fix {
+			fmt.Printf("\nrun doctor -fix to apply: %s\n", strings.Join(fixes, ", "))
+		} else {
+			unlock, err := config.LockComposeDir(composeDir)
+			if err != nil {
+				return err
+			}
+			applied, err := handlers.ApplyDoctorFixes(context.Background(), opts, fixes)
+			unlock()
+			if len(applied) > 0 {
+				fmt.Printf("\nfixed: %s\n\n", strings.Join(applied, ", "))
+			}
+			if err != nil {
+				return err
+			}
+			report = handlers.RunDoctor(context.Background(), opts)
+			printDoctorReport(report)
+		}
+	}
+
+	if !report.OK {
+		return fmt.Errorf("doctor found problems")
+	}
+	return nil
+}
+
+func printDoctorReport(report handlers.DoctorReport) {
+	for _, finding := range report.Findings {
+		line := fmt.Sprintf("%-8s %-16s %s", finding.Severity, finding.Check, finding.Message)
+		if finding.Fix != "" {
+			line += " (fix: " + finding.Fix + ")"
+		}
+		fmt.Println(config.Secrets.Redact(line))
+	}
+}
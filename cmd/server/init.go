@@ -2,19 +2,60 @@ package main
 
 import (
 	"bufio"
-	"crypto/rand"
-	"encoding/hex"
+	"context"
+	"flag"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"openclaw-setup/internal/config"
+	"openclaw-setup/internal/handlers"
 )
 
 type initOptions struct {
-	composeDir string
+	composeDir      string
+	containerName   string
+	dryRun          bool
+	offline         bool
+	proxyEnv        bool
+	rotate          bool
+	rewriteLoopback bool
+	checkReach      bool
+	force           bool
+	outbound        handlers.OutboundConfig
+}
+
+func parseInitArgs(composeDir, containerName string, args []string) (initOptions, error) {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print a redacted diff instead of writing")
+	offline := flags.Bool("offline", offlineMode(), "check MODEL against the cached catalog only")
+	proxyEnv := flags.Bool("proxy-env", proxyEnvMode(), "write SETUP_PROXY into data/conf/.env for the gateway")
+	rotate := flags.Bool("rotate-token", false, "replace the existing gateway token with a new one")
+	rewriteLoopback := flags.Bool("rewrite-loopback", false, "replace a 127.0.0.1 or localhost BASE_URL with an address of the Docker host")
+	checkReach := flags.Bool("check-reachability", false, "test BASE_URL from inside the gateway container (needs OPENCLAW_CONTAINER_NAME)")
+	force := flags.Bool("force", false, "save a MODEL missing from the provider's model list, with a warning")
+	if err := flags.Parse(args); err != nil {
+		return initOptions{}, err
+	}
+	outbound, err := outboundFromEnv()
+	if err != nil {
+		return initOptions{}, err
+	}
+	return initOptions{
+		composeDir:      composeDir,
+		containerName:   containerName,
+		dryRun:          *dryRun,
+		offline:         *offline,
+		proxyEnv:        *proxyEnv,
+		rotate:          *rotate,
+		rewriteLoopback: *rewriteLoopback,
+		checkReach:      *checkReach,
+		force:           *force,
+		outbound:        outbound,
+	}, nil
 }
 
 func runInit(opts initOptions) error {
@@ -30,37 +71,116 @@ func runInit(opts initOptions) error {
 	}
 
 	provider := normalizeEnvValue(envMap["PROVIDER"])
-	apiKey := normalizeEnvValue(envMap["API_KEY"])
+	apiKey, _, err := config.ResolveSecret("API_KEY", config.ProcessEnv(), config.EnvFileSource("compose .env", envMap, composeDir))
+	if err != nil {
+		return err
+	}
 	model := normalizeEnvValue(envMap["MODEL"])
 	baseUrl := normalizeEnvValue(envMap["BASE_URL"])
+	region := strings.ToLower(normalizeEnvValue(envMap["REGION"]))
+	api := normalizeEnvValue(envMap["API"])
 	provider = strings.ToLower(provider)
 	if provider == "" || model == "" {
 		return fmt.Errorf(".env must include PROVIDER and MODEL")
 	}
 	if provider != "ollama" && apiKey == "" {
-		return fmt.Errorf(".env must include API_KEY for provider %s", provider)
+		return fmt.Errorf("API_KEY or API_KEY_FILE must be set for provider %s", provider)
 	}
 	if provider == "ollama" && baseUrl == "" {
 		return fmt.Errorf(".env must include BASE_URL for provider ollama")
 	}
 
-	providerEnvKey, err := providerEnvKey(provider)
+	config.Secrets.AddFromConfigDir(filepath.Join(composeDir, "data", "conf"))
+
+	providerEnvKey, err := providerEnvKey(provider, baseUrl)
+	if err != nil {
+		return err
+	}
+
+	client, err := handlers.NewOutboundClient(opts.outbound)
+	if err != nil {
+		return err
+	}
+	catalog := handlers.NewModelCatalog(filepath.Join(config.StateDir(composeDir), "models-cache.json"), client)
+	providers := map[string]handlers.ProviderCredentials{
+		provider: {ApiKey: apiKey, Region: region, BaseUrl: baseUrl, Api: api},
+	}
+	modelCheck, err := handlers.CheckModelRef(catalog, model, providers, opts.offline, opts.force)
+	if err != nil {
+		return fmt.Errorf(".env MODEL: %w", err)
+	}
+	if modelCheck.Warning != "" {
+		log.Print(modelCheck.Warning)
+	}
+	model = modelCheck.Model
+
+	if !opts.dryRun {
+		unlock, err := config.LockComposeDir(composeDir)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	token, err := initGatewayToken(composeDir, opts.rotate)
 	if err != nil {
 		return err
 	}
 
-	token := randomToken()
+	// init replaces the model, token and its provider, and keeps the rest
+	// of what is configured, such as channels, fallbacks and the other
+	// providers they use.
 	configDir := filepath.Join(composeDir, "data", "conf")
-	if err := config.WriteConfigOnly(config.WriteConfigOnlyOptions{
-		ConfigDir:      configDir,
-		Model:          model,
-		GatewayToken:   token,
-		ProviderID:     provider,
-		ProviderEnvKey: providerEnvKey,
-		ProviderApiKey: apiKey,
-		BaseUrl:        baseUrl,
-		WriteEnv:       true,
-	}); err != nil {
+	writeOpts, err := config.CurrentWriteOptions(configDir)
+	if err != nil {
+		return err
+	}
+	writeOpts.Model = model
+	writeOpts.GatewayToken = token
+	writeOpts.MergeProviders([]config.ProviderKey{{
+		Key:      providerEnvKey,
+		Value:    apiKey,
+		Provider: provider,
+		Region:   region,
+		BaseUrl:  baseUrl,
+		Api:      api,
+	}})
+	if dropped := writeOpts.PruneFallbacks(); len(dropped) > 0 {
+		log.Printf("dropping fallbacks of unconfigured providers: %s", strings.Join(dropped, ", "))
+	}
+	reachOpts := handlers.ReachabilityOptions{Rewrite: opts.rewriteLoopback}
+	if opts.checkReach {
+		if opts.containerName == "" {
+			return fmt.Errorf("-check-reachability needs OPENCLAW_CONTAINER_NAME")
+		}
+		reachOpts.Runtime = handlers.DockerRuntime{}
+		reachOpts.Container = opts.containerName
+	}
+	checks, writeProviders := handlers.CheckReachability(context.Background(), writeOpts.Providers, reachOpts)
+	for _, check := range checks {
+		if check.Warning != "" {
+			log.Print(check.Warning)
+		}
+	}
+	writeOpts.Providers = writeProviders
+	if opts.proxyEnv {
+		writeOpts.Proxy = opts.outbound.ProxyEnv()
+	}
+
+	if opts.dryRun {
+		changes, err := config.PreviewConfigAndEnv(writeOpts)
+		if err != nil {
+			return err
+		}
+		composeEnv, err := renderComposeToken(envPath, token)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, config.DiffFile(envPath, composeEnv))
+		printChanges(changes)
+		return nil
+	}
+
+	if err := config.WriteConfigAndEnv(writeOpts); err != nil {
 		return err
 	}
 
@@ -82,35 +202,13 @@ func resolveComposeDir(explicit string) (string, error) {
 	return filepath.Clean(wd), nil
 }
 
-func providerEnvKey(provider string) (string, error) {
-	switch provider {
-	case "openai":
-		return "OPENAI_API_KEY", nil
-	case "anthropic":
-		return "ANTHROPIC_API_KEY", nil
-	case "gemini":
-		return "GEMINI_API_KEY", nil
-	case "groq":
-		return "GROQ_API_KEY", nil
-	case "mistral":
-		return "MISTRAL_API_KEY", nil
-	case "cohere":
-		return "COHERE_API_KEY", nil
-	case "minimax":
-		return "MINIMAX_API_KEY", nil
-	case "deepseek":
-		return "DEEPSEEK_API_KEY", nil
-	case "moonshot":
-		return "MOONSHOT_API_KEY", nil
-	case "qwen":
-		return "QWEN_API_KEY", nil
-	case "zai":
-		return "ZAI_API_KEY", nil
-	case "ollama":
-		return "", nil
-	default:
-		return "", fmt.Errorf("unsupported PROVIDER: %s", provider)
+// providerEnvKey returns the env variable for the provider's key. Providers
+// outside the registry are accepted with a BASE_URL and use <ID>_API_KEY.
+func providerEnvKey(provider, baseUrl string) (string, error) {
+	if _, ok := config.LookupProvider(provider); !ok && baseUrl == "" {
+		return "", fmt.Errorf("unsupported PROVIDER: %s (set BASE_URL for a custom provider)", provider)
 	}
+	return config.ProviderEnvKey(provider), nil
 }
 
 func readDotEnv(path string) (map[string]string, error) {
@@ -145,36 +243,34 @@ func readDotEnv(path string) (map[string]string, error) {
 }
 
 func writeComposeToken(path string, token string) error {
+	content, err := renderComposeToken(path, token)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+func renderComposeToken(path string, token string) ([]byte, error) {
 	if strings.TrimSpace(token) == "" {
-		return fmt.Errorf("generated token is empty")
+		return nil, fmt.Errorf("gateway token is empty")
 	}
 	content, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("read .env: %w", err)
+		return nil, fmt.Errorf("read .env: %w", err)
 	}
+	return config.SetEnvValue(content, "OPENCLAW_GATEWAY_TOKEN", token, "CLAWDBOT_GATEWAY_TOKEN"), nil
+}
 
-	lines := strings.Split(string(content), "\n")
-	updated := false
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
-			continue
-		}
-		parts := strings.SplitN(trimmed, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		key := strings.TrimSpace(parts[0])
-		if key == "OPENCLAW_GATEWAY_TOKEN" || key == "CLAWDBOT_GATEWAY_TOKEN" {
-			lines[i] = fmt.Sprintf("OPENCLAW_GATEWAY_TOKEN=%s", token)
-			updated = true
+// printChanges writes the changes to stdout through the process redactor,
+// which also catches secrets in lines the diff itself does not mask.
+func printChanges(changes []config.FileChange) {
+	out := config.Secrets.Writer(os.Stdout)
+	for _, change := range changes {
+		fmt.Fprintf(out, "%-9s %s\n", change.Action, change.Path)
+		if change.Diff != "" {
+			fmt.Fprint(out, change.Diff)
 		}
 	}
-	if !updated {
-		lines = append(lines, fmt.Sprintf("OPENCLAW_GATEWAY_TOKEN=%s", token))
-	}
-
-	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600)
 }
 
 func normalizeEnvValue(value string) string {
@@ -184,12 +280,41 @@ func normalizeEnvValue(value string) string {
 	return strings.TrimSpace(trimmed)
 }
 
-func randomToken() string {
-	bytes := make([]byte, 24)
-	if _, err := rand.Read(bytes); err != nil {
-		return ""
+// initGatewayToken prefers OPENCLAW_GATEWAY_TOKEN or _FILE from the process
+// environment, then keeps the token already in use so paired browsers and
+// clients stay valid, and generates one on first run or with -rotate-token.
+func initGatewayToken(composeDir string, rotate bool) (string, error) {
+	token, origin, err := config.ResolveSecret("OPENCLAW_GATEWAY_TOKEN", config.ProcessEnv())
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		if rotate {
+			return "", fmt.Errorf("-rotate-token conflicts with the gateway token from the %s", origin)
+		}
+		log.Printf("using gateway token from the %s", origin)
+		return token, nil
+	}
+	if !rotate {
+		token, source, err := config.ExistingGatewayToken(composeDir)
+		if err != nil {
+			return "", err
+		}
+		if token != "" {
+			config.Secrets.Add(token)
+			log.Printf("reusing gateway token from %s", source)
+			return token, nil
+		}
+	}
+	token, err = config.GenerateGatewayToken()
+	if err != nil {
+		return "", err
+	}
+	config.Secrets.Add(token)
+	if rotate {
+		log.Print("gateway token rotated; paired clients must use the new token")
 	}
-	return hex.EncodeToString(bytes)
+	return token, nil
 }
 
 func chownDataDir(composeDir string) error {
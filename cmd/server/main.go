@@ -1,42 +1,136 @@
 package main
 
 import (
+	"flag"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 
+	"openclaw-setup/internal/config"
 	"openclaw-setup/internal/handlers"
+	"openclaw-setup/web"
 )
 
+var version = "dev"
+
 func main() {
+	log.SetOutput(config.Secrets.Writer(os.Stderr))
+
 	addr := getenvDefault("SETUP_LISTEN_ADDR", "0.0.0.0:8188")
 	composeDir := getenvDefault("OPENCLAW_COMPOSE_DIR", os.Getenv("MOLTBOT_COMPOSE_DIR"))
 	containerName := getenvDefault("OPENCLAW_CONTAINER_NAME", os.Getenv("MOLTBOT_CONTAINER_NAME"))
 
-	if len(os.Args) > 1 && os.Args[1] == "init" {
-		if err := runInit(initOptions{composeDir: composeDir}); err != nil {
-			log.Fatal(err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init":
+			opts, err := parseInitArgs(composeDir, containerName, os.Args[2:])
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := runInit(opts); err != nil {
+				log.Fatal(err)
+			}
+			if !opts.dryRun {
+				log.Print("openclaw.json generated")
+			}
+			return
+		case "migrate":
+			if err := runMigrate(migrateOptions{composeDir: composeDir}); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "validate":
+			if err := runValidate(composeDir, os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "doctor":
+			if err := runDoctor(composeDir, containerName, os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "plan", "apply":
+			opts, err := parseApplyArgs(os.Args[1], composeDir, os.Args[2:])
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := runApply(opts); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "export":
+			if err := runExport(composeDir, os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "import":
+			if err := runImport(composeDir, os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
 		}
-		log.Print("openclaw.json generated")
-		return
 	}
 
+	serverFlags := flag.NewFlagSet("openclaw-setup", flag.ExitOnError)
+	staticDir := serverFlags.String("static-dir", os.Getenv("SETUP_STATIC_DIR"), "serve the web UI from this directory instead of the embedded build")
+	_ = serverFlags.Parse(os.Args[1:])
+
 	if composeDir == "" {
 		log.Fatal("OPENCLAW_COMPOSE_DIR is required")
 	}
 
 	configDir := filepath.Join(composeDir, "data", "conf")
 
+	outbound, err := outboundFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	providerClient, err := handlers.NewOutboundClient(outbound)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var proxyEnv *config.ProxySettings
+	if proxyEnvMode() {
+		proxyEnv = outbound.ProxyEnv()
+	}
+	gatewayToken, _, err := config.ResolveSecret("OPENCLAW_GATEWAY_TOKEN", config.ProcessEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	draftPassphrase, _, err := config.ResolveSecret("SETUP_DRAFT_PASSPHRASE", config.ProcessEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	stateDir := config.StateDir(composeDir)
+	serveOpts, err := serveOptionsFromEnv(addr, stateDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger := handlers.NewLogger(os.Stderr, os.Getenv("SETUP_LOG_FORMAT") == "json")
+	slog.SetDefault(logger)
+
 	handler := handlers.NewServer(handlers.ServerConfig{
-		ComposeDir:    composeDir,
-		ConfigDir:     configDir,
-		ContainerName: containerName,
-		StaticDir:     "web/dist",
+		ComposeDir:      composeDir,
+		ConfigDir:       configDir,
+		ContainerName:   containerName,
+		StaticDir:       *staticDir,
+		StaticFS:        web.Dist(),
+		StateDir:        stateDir,
+		ListenAddr:      addr,
+		Version:         version,
+		Offline:         offlineMode(),
+		ProviderClient:  providerClient,
+		ProxyEnv:        proxyEnv,
+		GatewayToken:    gatewayToken,
+		DraftPassphrase: draftPassphrase,
+		Logger:          logger,
 	})
 
-	log.Printf("OpenClaw setup listening on %s", addr)
-	if err := http.ListenAndServe(addr, handler); err != nil {
+	logger.Info("OpenClaw setup starting", "version", version)
+	if err := serve(handler, serveOpts, logger); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -47,3 +141,10 @@ func getenvDefault(key, fallback string) string {
 	}
 	return fallback
 }
+
+// offlineMode reports whether SETUP_OFFLINE asks to skip live provider
+// calls and rely on the cached model catalog.
+func offlineMode() bool {
+	offline, _ := strconv.ParseBool(os.Getenv("SETUP_OFFLINE"))
+	return offline
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"openclaw-setup/internal/config"
+)
+
+type migrateOptions struct {
+	composeDir string
+}
+
+func runMigrate(opts migrateOptions) error {
+	composeDir, err := resolveComposeDir(opts.composeDir)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := config.LockComposeDir(composeDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	report, err := config.Migrate(config.MigrateOptions{
+		ComposeDir: composeDir,
+		ConfigDir:  filepath.Join(composeDir, "data", "conf"),
+	})
+	if err != nil {
+		return err
+	}
+
+	printMigrateReport(report)
+	return nil
+}
+
+func printMigrateReport(report *config.MigrateReport) {
+	fmt.Printf("source: %s\n", report.Source)
+	for _, path := range report.Mapped {
+		fmt.Printf("  mapped   %s\n", path)
+	}
+	for _, rename := range report.Renamed {
+		fmt.Printf("  renamed  %s -> %s\n", rename.From, rename.To)
+	}
+	for _, key := range report.Kept {
+		fmt.Printf("  kept     %s\n", key)
+	}
+	for _, path := range report.Dropped {
+		fmt.Printf("  dropped  %s\n", path)
+	}
+	for _, backup := range report.Backups {
+		fmt.Printf("backup: %s\n", backup)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"openclaw-setup/internal/config"
+	"openclaw-setup/internal/handlers"
+)
+
+// outboundFromEnv reads the provider request settings:
+//
+//	SETUP_PROXY         http(s):// or socks5:// proxy for provider requests,
+//	                    or SETUP_PROXY_FILE when the URL carries a password
+//	SETUP_NO_PROXY      hosts, domains and CIDRs that bypass SETUP_PROXY
+//	SETUP_CA_FILE       extra PEM bundles, separated like PATH
+//	SETUP_HTTP_TIMEOUT  per-request timeout such as 30s (default 15s)
+//
+// Without SETUP_PROXY the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// variables apply.
+func outboundFromEnv() (handlers.OutboundConfig, error) {
+	proxyURL, _, err := config.ResolveSecret("SETUP_PROXY", config.ProcessEnv())
+	if err != nil {
+		return handlers.OutboundConfig{}, err
+	}
+	cfg := handlers.OutboundConfig{
+		ProxyURL: proxyURL,
+		NoProxy:  strings.TrimSpace(os.Getenv("SETUP_NO_PROXY")),
+	}
+	if value := strings.TrimSpace(os.Getenv("SETUP_CA_FILE")); value != "" {
+		cfg.CAFiles = filepath.SplitList(value)
+	}
+	if value := strings.TrimSpace(os.Getenv("SETUP_HTTP_TIMEOUT")); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return cfg, fmt.Errorf("SETUP_HTTP_TIMEOUT must be a positive duration such as 30s, got %q", value)
+		}
+		cfg.Timeout = timeout
+	}
+	return cfg, nil
+}
+
+// proxyEnvMode reports whether SETUP_PROXY_ENV asks to mirror SETUP_PROXY
+// into the gateway's .env.
+func proxyEnvMode() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("SETUP_PROXY_ENV"))
+	return enabled
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	// readTimeout leaves room for bundle uploads.
+	readTimeout = 60 * time.Second
+	// writeTimeout covers a save, which waits for docker compose to restart
+	// the gateway before answering.
+	writeTimeout = 5 * time.Minute
+	idleTimeout  = 2 * time.Minute
+	// shutdownTimeout bounds how long SIGTERM waits for in-flight requests,
+	// long enough for a running save and restart to finish.
+	shutdownTimeout = 5 * time.Minute
+
+	selfSignedValidity = 2 * 365 * 24 * time.Hour
+)
+
+// serveOptions are read from the environment:
+//
+//	SETUP_LISTEN_ADDR       host:port, or unix:/path/to/socket
+//	SETUP_TLS_CERT/KEY      PEM certificate and key to serve HTTPS
+//	SETUP_TLS_SELF_SIGNED   generate and reuse a self-signed certificate
+//	SETUP_TLS_HOSTS         extra names for the self-signed certificate
+type serveOptions struct {
+	addr       string
+	certFile   string
+	keyFile    string
+	selfSigned bool
+	hosts      []string
+	stateDir   string
+}
+
+func serveOptionsFromEnv(addr, stateDir string) (serveOptions, error) {
+	opts := serveOptions{
+		addr:     addr,
+		certFile: strings.TrimSpace(os.Getenv("SETUP_TLS_CERT")),
+		keyFile:  strings.TrimSpace(os.Getenv("SETUP_TLS_KEY")),
+		stateDir: stateDir,
+	}
+	if value := os.Getenv("SETUP_TLS_SELF_SIGNED"); value != "" {
+		selfSigned, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("SETUP_TLS_SELF_SIGNED must be a boolean, got %q", value)
+		}
+		opts.selfSigned = selfSigned
+	}
+	for _, host := range strings.Split(os.Getenv("SETUP_TLS_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			opts.hosts = append(opts.hosts, host)
+		}
+	}
+	if (opts.certFile == "") != (opts.keyFile == "") {
+		return opts, fmt.Errorf("SETUP_TLS_CERT and SETUP_TLS_KEY must be set together")
+	}
+	if opts.certFile != "" && opts.selfSigned {
+		return opts, fmt.Errorf("SETUP_TLS_SELF_SIGNED cannot be combined with SETUP_TLS_CERT")
+	}
+	return opts, nil
+}
+
+// serve runs handler until SIGINT or SIGTERM, then stops accepting
+// connections and waits for in-flight requests such as a save and restart.
+func serve(handler http.Handler, opts serveOptions, logger *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serveUntil(ctx, handler, opts, logger)
+}
+
+// serveUntil runs handler until ctx is done and then shuts down like serve.
+func serveUntil(ctx context.Context, handler http.Handler, opts serveOptions, logger *slog.Logger) error {
+	listener, err := listen(opts.addr)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := serverTLSConfig(opts, logger)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+	logger.Info("OpenClaw setup listening", "addr", listener.Addr().String(), "tls", tlsConfig != nil)
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down, waiting for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	logger.Info("shutdown complete")
+	return nil
+}
+
+// listen opens a TCP listener, or a Unix socket for "unix:/path". A stale
+// socket file left by a previous run is removed first.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func serverTLSConfig(opts serveOptions, logger *slog.Logger) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case opts.certFile != "":
+		cert, err = tls.LoadX509KeyPair(opts.certFile, opts.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls certificate: %w", err)
+		}
+	case opts.selfSigned:
+		cert, err = selfSignedCertificate(filepath.Join(opts.stateDir, "tls"), opts.hosts)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	logger.Info("tls certificate", "sha256", certFingerprint(cert.Certificate[0]))
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// selfSignedCertificate loads the certificate kept in dir, generating it on
+// first use so its fingerprint stays stable across restarts.
+func selfSignedCertificate(dir string, hosts []string) (tls.Certificate, error) {
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	if cert, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && time.Now().Before(leaf.NotAfter) {
+			return cert, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate tls key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate serial: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "openclaw-setup"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	names := append([]string{"localhost", "127.0.0.1", "::1"}, hosts...)
+	if hostname, err := os.Hostname(); err == nil {
+		names = append(names, hostname)
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return tls.Certificate{}, fmt.Errorf("create tls dir: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return tls.Certificate{}, fmt.Errorf("write tls key: %w", err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return tls.Certificate{}, fmt.Errorf("write tls certificate: %w", err)
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// certFingerprint formats the SHA-256 of a DER certificate the way
+// browsers display it.
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	encoded := strings.ToUpper(hex.EncodeToString(sum[:]))
+	pairs := make([]string, 0, len(sum))
+	for i := 0; i < len(encoded); i += 2 {
+		pairs = append(pairs, encoded[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// socketClient talks HTTP, or HTTPS without verification, over the Unix
+// socket at path.
+func socketClient(path string) *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+	}
+}
+
+// startServe runs serveUntil in the background and waits until it answers.
+func startServe(t *testing.T, handler http.Handler, opts serveOptions, client *http.Client, base string) (context.CancelFunc, <-chan error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serveUntil(ctx, handler, opts, discardLogger) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := client.Get(base + "/ready")
+		if err == nil {
+			resp.Body.Close()
+			return cancel, done
+		}
+		if time.Now().After(deadline) {
+			cancel()
+			t.Fatalf("server did not come up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func skipWithoutUnixSockets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not used on windows")
+	}
+}
+
+func TestServeUnixSocketShutsDownGracefully(t *testing.T) {
+	skipWithoutUnixSockets(t)
+	socket := filepath.Join(t.TempDir(), "setup.sock")
+	// A socket file left by a crashed run must not block the next start.
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/save", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "saved")
+	})
+	client := socketClient(socket)
+	cancel, done := startServe(t, mux, serveOptions{addr: "unix:" + socket}, client, "http://setup")
+	defer cancel()
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o660 {
+		t.Errorf("socket mode = %o, want 660", perm)
+	}
+
+	saved := make(chan string, 1)
+	go func() {
+		resp, err := client.Get("http://setup/save")
+		if err != nil {
+			saved <- "error: " + err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		saved <- string(body)
+	}()
+	<-started
+	cancel()
+
+	// New connections are refused while the save is still running.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := client.Get("http://setup/ready")
+		if err != nil {
+			break
+		}
+		resp.Body.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("server still accepts connections after shutdown began")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("serveUntil returned before the in-flight request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if got := <-saved; got != "saved" {
+		t.Errorf("in-flight request got %q, want it completed", got)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serveUntil: %v", err)
+	}
+}
+
+func TestServeReusesSelfSignedCertificate(t *testing.T) {
+	skipWithoutUnixSockets(t)
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "setup.sock")
+	opts := serveOptions{addr: "unix:" + socket, selfSigned: true, hosts: []string{"setup.lan", "10.0.0.5"}, stateDir: dir}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {})
+	client := socketClient(socket)
+
+	var fingerprints []string
+	for run := 0; run < 2; run++ {
+		cancel, done := startServe(t, mux, opts, client, "https://setup")
+		resp, err := client.Get("https://setup/ready")
+		if err != nil {
+			cancel()
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		fingerprints = append(fingerprints, certFingerprint(resp.TLS.PeerCertificates[0].Raw))
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fingerprints[0] != fingerprints[1] {
+		t.Errorf("fingerprint changed across restarts: %s, then %s", fingerprints[0], fingerprints[1])
+	}
+
+	certPEM, err := os.ReadFile(filepath.Join(dir, "tls", "cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, mustReadFile(t, filepath.Join(dir, "tls", "key.pem")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := certFingerprint(pair.Certificate[0]); got != fingerprints[0] {
+		t.Errorf("served %s, persisted %s", fingerprints[0], got)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("setup.lan"); err != nil {
+		t.Error(err)
+	}
+	if err := leaf.VerifyHostname("10.0.0.5"); err != nil {
+		t.Error(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "tls", "key.pem")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key.pem mode = %v (%v), want 600", info.Mode().Perm(), err)
+	}
+
+	// A certificate that is gone is generated again, with a new fingerprint.
+	if err := os.Remove(filepath.Join(dir, "tls", "cert.pem")); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := selfSignedCertificate(filepath.Join(dir, "tls"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certFingerprint(cert.Certificate[0]) == fingerprints[0] {
+		t.Error("a missing certificate was not regenerated")
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestCertFingerprint(t *testing.T) {
+	got := certFingerprint([]byte("abc"))
+	want := "BA:78:16:BF:8F:01:CF:EA:41:41:40:DE:5D:AE:22:23:B0:03:61:A3:96:17:7A:9C:B4:10:FF:61:F2:00:15:AD"
+	if got != want {
+		t.Errorf("fingerprint = %s, want %s", got, want)
+	}
+}
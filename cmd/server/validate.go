@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"openclaw-setup/internal/config"
+)
+
+func runValidate(composeDir string, args []string) error {
+	path := ""
+	if len(args) > 0 {
+		path = args[0]
+	} else {
+		dir, err := resolveComposeDir(composeDir)
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(dir, "data", "conf", "openclaw.json")
+	}
+
+	errs, err := config.ValidateFile(path)
+	if err != nil {
+		return err
+	}
+	if len(errs) == 0 {
+		fmt.Printf("%s is valid\n", path)
+		return nil
+	}
+
+	for _, item := range errs {
+		fmt.Printf("  %s: %s\n", item.Path, item.Message)
+	}
+	return fmt.Errorf("%s: %d problem(s) found", path, len(errs))
+}
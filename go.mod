@@ -1,3 +1,8 @@
 module openclaw-setup
 
 go 1.22
+
+require (
+	golang.org/x/crypto v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,355 @@
+package config
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	bundleManifestName     = "manifest.json"
+	bundleConfigName       = "openclaw.json"
+	bundleConfigSealedName = "openclaw.json.enc"
+	bundleEnvName          = "env"
+	bundleEnvSealedName    = "env.enc"
+	bundleProvidersName    = "providers.json"
+	maxBundleEntrySize     = 4 << 20
+)
+
+type BundleManifest struct {
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Encrypted bool      `json:"encrypted"`
+	Files     []string  `json:"files"`
+}
+
+type BundleProvider struct {
+	ID      string `json:"id"`
+	EnvKey  string `json:"envKey,omitempty"`
+	BaseUrl string `json:"baseUrl,omitempty"`
+	Api     string `json:"api,omitempty"`
+}
+
+type ExportOptions struct {
+	ConfigDir  string
+	Version    string
+	Passphrase string
+}
+
+type ImportOptions struct {
+	ConfigDir string
+	// ComposeDir, when set, has its .env OPENCLAW_GATEWAY_TOKEN brought in
+	// line with the imported gateway token.
+	ComposeDir string
+	Passphrase string
+	DryRun     bool
+}
+
+type ImportResult struct {
+	Manifest  BundleManifest   `json:"manifest"`
+	Providers []BundleProvider `json:"providers"`
+	Changes   []FileChange     `json:"changes"`
+	Backups   []string         `json:"backups,omitempty"`
+	DryRun    bool             `json:"dryRun"`
+}
+
+type FileChange struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Diff   string `json:"diff,omitempty"`
+	// Keys lists the changed .env variables or openclaw.json paths. It
+	// never contains values.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// ExportBundle writes a gzipped tar archive with openclaw.json, the managed
+// .env, the provider definitions and a manifest. With a passphrase both
+// openclaw.json and .env are sealed, since openclaw.json holds the gateway
+// token and may hold literal API keys.
+func ExportBundle(w io.Writer, opts ExportOptions) error {
+	if strings.TrimSpace(opts.ConfigDir) == "" {
+		return fmt.Errorf("config dir is required")
+	}
+
+	configContent, err := os.ReadFile(filepath.Join(opts.ConfigDir, "openclaw.json"))
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	var cfg openclawConfig
+	if err := json.Unmarshal(configContent, &cfg); err != nil {
+		return fmt.Errorf("parse openclaw.json: %w", err)
+	}
+
+	envContent, err := os.ReadFile(filepath.Join(opts.ConfigDir, ".env"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read env: %w", err)
+	}
+
+	providersContent, err := json.MarshalIndent(bundleProviders(cfg, envContent), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal providers: %w", err)
+	}
+
+	configName, envName := bundleConfigName, bundleEnvName
+	if opts.Passphrase != "" {
+		configName, envName = bundleConfigSealedName, bundleEnvSealedName
+		configContent, err = sealWithPassphrase(configContent, opts.Passphrase)
+		if err != nil {
+			return fmt.Errorf("encrypt config: %w", err)
+		}
+		envContent, err = sealWithPassphrase(envContent, opts.Passphrase)
+		if err != nil {
+			return fmt.Errorf("encrypt env: %w", err)
+		}
+	}
+
+	manifest := BundleManifest{
+		Version:   opts.Version,
+		CreatedAt: time.Now().UTC(),
+		Encrypted: opts.Passphrase != "",
+		Files:     []string{configName, envName, bundleProvidersName},
+	}
+	manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	entries := []struct {
+		name    string
+		content []byte
+	}{
+		{bundleManifestName, manifestContent},
+		{configName, configContent},
+		{envName, envContent},
+		{bundleProvidersName, providersContent},
+	}
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:    entry.name,
+			Mode:    0o600,
+			Size:    int64(len(entry.content)),
+			ModTime: manifest.CreatedAt,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("write bundle: %w", err)
+		}
+		if _, err := tw.Write(entry.content); err != nil {
+			return fmt.Errorf("write bundle: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("write bundle: %w", err)
+	}
+	return gz.Close()
+}
+
+// ImportBundle applies a bundle produced by ExportBundle to the config dir.
+// With DryRun set it only reports which files would change.
+func ImportBundle(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if strings.TrimSpace(opts.ConfigDir) == "" {
+		return nil, fmt.Errorf("config dir is required")
+	}
+
+	entries, err := readBundle(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest BundleManifest
+	manifestContent, ok := entries[bundleManifestName]
+	if !ok {
+		return nil, fmt.Errorf("bundle is missing %s", bundleManifestName)
+	}
+	if err := json.Unmarshal(manifestContent, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+
+	var configContent []byte
+	if manifest.Encrypted {
+		sealed, ok := entries[bundleConfigSealedName]
+		if !ok {
+			return nil, fmt.Errorf("bundle is missing %s", bundleConfigSealedName)
+		}
+		configContent, err = openWithPassphrase(sealed, opts.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt config: %w", err)
+		}
+	} else {
+		configContent, ok = entries[bundleConfigName]
+		if !ok {
+			return nil, fmt.Errorf("bundle is missing %s", bundleConfigName)
+		}
+	}
+	if errs := ValidateConfig(configContent); len(errs) > 0 {
+		return nil, errs
+	}
+
+	var envContent []byte
+	if manifest.Encrypted {
+		sealed, ok := entries[bundleEnvSealedName]
+		if !ok {
+			return nil, fmt.Errorf("bundle is missing %s", bundleEnvSealedName)
+		}
+		envContent, err = openWithPassphrase(sealed, opts.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt env: %w", err)
+		}
+	} else {
+		envContent = entries[bundleEnvName]
+	}
+
+	result := &ImportResult{Manifest: manifest, DryRun: opts.DryRun}
+	if providersContent, ok := entries[bundleProvidersName]; ok {
+		if err := json.Unmarshal(providersContent, &result.Providers); err != nil {
+			return nil, fmt.Errorf("parse providers: %w", err)
+		}
+	}
+
+	type importTarget struct {
+		name    string
+		content []byte
+	}
+	targets := []importTarget{{"openclaw.json", configContent}}
+	if len(envContent) > 0 {
+		targets = append(targets, importTarget{".env", envContent})
+	}
+	for _, target := range targets {
+		result.Changes = append(result.Changes, DiffFile(filepath.Join(opts.ConfigDir, target.name), target.content))
+	}
+	// docker compose hands the gateway the token from the compose .env, so
+	// it has to follow the imported one.
+	token := bundleGatewayToken(configContent, envContent)
+	composeEnvChanged := false
+	if strings.TrimSpace(opts.ComposeDir) != "" && token != "" {
+		composeEnvPath := filepath.Join(opts.ComposeDir, ".env")
+		content, err := os.ReadFile(composeEnvPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read .env: %w", err)
+		}
+		if err == nil {
+			change := DiffFile(composeEnvPath, SetEnvValue(content, gatewayTokenKeys[0], token, gatewayTokenKeys[1:]...))
+			composeEnvChanged = change.Action != "unchanged"
+			result.Changes = append(result.Changes, change)
+		}
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if err := os.MkdirAll(opts.ConfigDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create config dir: %w", err)
+	}
+	for i, target := range targets {
+		if result.Changes[i].Action == "unchanged" {
+			continue
+		}
+		path := result.Changes[i].Path
+		backup, err := backupFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if backup != "" {
+			result.Backups = append(result.Backups, backup)
+		}
+		if err := os.WriteFile(path, target.content, 0o600); err != nil {
+			return nil, fmt.Errorf("write %s: %w", target.name, err)
+		}
+	}
+	if composeEnvChanged {
+		backup, err := backupFile(filepath.Join(opts.ComposeDir, ".env"))
+		if err != nil {
+			return nil, err
+		}
+		if backup != "" {
+			result.Backups = append(result.Backups, backup)
+		}
+		if _, err := SyncGatewayToken(opts.ComposeDir, token); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// bundleGatewayToken returns the gateway token an imported config uses:
+// gateway.auth.token, with a ${NAME} reference resolved against the
+// imported env. It is empty when neither holds one.
+func bundleGatewayToken(configContent, envContent []byte) string {
+	var cfg openclawConfig
+	if json.Unmarshal(configContent, &cfg) != nil {
+		return ""
+	}
+	token := strings.TrimSpace(cfg.Gateway.Auth.Token)
+	if name, ok := strings.CutPrefix(token, "${"); ok {
+		token = envValues(envContent)[strings.TrimSuffix(name, "}")]
+	}
+	return token
+}
+
+func readBundle(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("read bundle: %w", err)
+	}
+	defer gz.Close()
+
+	entries := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxBundleEntrySize {
+			return nil, fmt.Errorf("bundle entry %s is too large", header.Name)
+		}
+		content, err := io.ReadAll(io.LimitReader(tr, maxBundleEntrySize))
+		if err != nil {
+			return nil, fmt.Errorf("read bundle: %w", err)
+		}
+		entries[filepath.Base(header.Name)] = content
+	}
+	return entries, nil
+}
+
+func bundleProviders(cfg openclawConfig, envContent []byte) []BundleProvider {
+	byID := make(map[string]*BundleProvider)
+	if cfg.Models != nil {
+		for id, provider := range cfg.Models.Providers {
+			byID[id] = &BundleProvider{ID: id, BaseUrl: provider.BaseUrl, Api: provider.Api}
+		}
+	}
+	for _, line := range strings.Split(string(envContent), "\n") {
+		key, _, ok := splitEnvLine(line)
+		if !ok || !strings.HasSuffix(key, "_API_KEY") {
+			continue
+		}
+		id := ProviderIDForEnvKey(key)
+		if byID[id] == nil {
+			byID[id] = &BundleProvider{ID: id}
+		}
+		byID[id].EnvKey = key
+	}
+
+	providers := make([]BundleProvider, 0, len(byID))
+	for _, provider := range byID {
+		providers = append(providers, *provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].ID < providers[j].ID })
+	return providers
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const bundleTestConfig = `{
+  "gateway": {"mode": "local", "bind": "lan", "port": 18789, "auth": {"mode": "token", "token": "gateway-secret-token"}},
+  "agents": {"defaults": {"model": {"primary": "custom/model-a"}}},
+  "models": {"providers": {"custom": {"apiKey": "sk-literal-secret", "baseUrl": "https://llm.example.com/v1", "api": "openai-completions", "models": [{"id": "model-a", "name": "model-a", "reasoning": false, "input": ["text"], "contextWindow": 128000, "maxTokens": 8192}]}}}
+}`
+
+func bundleEntries(t *testing.T, archive []byte) map[string][]byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[header.Name] = content
+	}
+}
+
+func TestEncryptedBundleSealsConfig(t *testing.T) {
+	source := t.TempDir()
+	writeFile(t, filepath.Join(source, "openclaw.json"), bundleTestConfig)
+	writeFile(t, filepath.Join(source, ".env"), "OPENCLAW_GATEWAY_TOKEN=gateway-secret-token\n")
+
+	var archive bytes.Buffer
+	if err := ExportBundle(&archive, ExportOptions{ConfigDir: source, Version: "test", Passphrase: "correct horse"}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	entries := bundleEntries(t, archive.Bytes())
+	if _, ok := entries[bundleConfigName]; ok {
+		t.Errorf("encrypted bundle contains a plaintext %s", bundleConfigName)
+	}
+	for name, content := range entries {
+		for _, secret := range []string{"gateway-secret-token", "sk-literal-secret"} {
+			if strings.Contains(string(content), secret) {
+				t.Errorf("%s contains %q in plaintext", name, secret)
+			}
+		}
+	}
+
+	if _, err := ImportBundle(bytes.NewReader(archive.Bytes()), ImportOptions{ConfigDir: t.TempDir(), Passphrase: "wrong"}); err == nil {
+		t.Error("import with the wrong passphrase succeeded")
+	}
+	target := t.TempDir()
+	if _, err := ImportBundle(bytes.NewReader(archive.Bytes()), ImportOptions{ConfigDir: target, Passphrase: "correct horse"}); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if got := readFile(t, filepath.Join(target, "openclaw.json")); got != bundleTestConfig {
+		t.Errorf("imported openclaw.json differs from the exported one:\n%s", got)
+	}
+}
+
+func TestPlainBundleRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	writeFile(t, filepath.Join(source, "openclaw.json"), bundleTestConfig)
+
+	var archive bytes.Buffer
+	if err := ExportBundle(&archive, ExportOptions{ConfigDir: source, Version: "test"}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	target := t.TempDir()
+	if _, err := ImportBundle(bytes.NewReader(archive.Bytes()), ImportOptions{ConfigDir: target}); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if got := readFile(t, filepath.Join(target, "openclaw.json")); got != bundleTestConfig {
+		t.Errorf("imported openclaw.json differs from the exported one:\n%s", got)
+	}
+}
+
+func TestEncryptedBundleRequiresSealedConfig(t *testing.T) {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		bundleManifestName: `{"version":"test","encrypted":true}`,
+		bundleConfigName:   bundleTestConfig,
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ImportBundle(bytes.NewReader(archive.Bytes()), ImportOptions{ConfigDir: t.TempDir(), Passphrase: "correct horse"})
+	if err == nil || !strings.Contains(err.Error(), bundleConfigSealedName) {
+		t.Errorf("err = %v, want %s reported missing", err, bundleConfigSealedName)
+	}
+}
+
+func TestImportSyncsComposeGatewayToken(t *testing.T) {
+	source := t.TempDir()
+	writeFile(t, filepath.Join(source, "openclaw.json"), bundleTestConfig)
+	var archive bytes.Buffer
+	if err := ExportBundle(&archive, ExportOptions{ConfigDir: source, Version: "test"}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	composeDir := t.TempDir()
+	composeEnv := filepath.Join(composeDir, ".env")
+	writeFile(t, composeEnv, "PROVIDER=custom\nOPENCLAW_GATEWAY_TOKEN=old-compose-token\n")
+	opts := ImportOptions{ConfigDir: filepath.Join(composeDir, "data", "conf"), ComposeDir: composeDir}
+
+	opts.DryRun = true
+	result, err := ImportBundle(bytes.NewReader(archive.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	last := result.Changes[len(result.Changes)-1]
+	if last.Path != composeEnv || last.Action != "update" || strings.Contains(last.Diff, "gateway-secret-token") {
+		t.Errorf("dry run change = %+v, want a redacted update of the compose .env", last)
+	}
+	if got := readFile(t, composeEnv); !strings.Contains(got, "old-compose-token") {
+		t.Errorf("dry run wrote the compose .env:\n%s", got)
+	}
+
+	opts.DryRun = false
+	result, err = ImportBundle(bytes.NewReader(archive.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if got := readFile(t, composeEnv); got != "PROVIDER=custom\nOPENCLAW_GATEWAY_TOKEN=gateway-secret-token\n" {
+		t.Errorf("compose .env = %q, want the imported token", got)
+	}
+	if len(result.Backups) == 0 || !strings.HasPrefix(result.Backups[len(result.Backups)-1], composeEnv+".bak-") {
+		t.Errorf("backups = %v, want the compose .env backed up", result.Backups)
+	}
+}
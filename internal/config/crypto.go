@@ -0,0 +1,68 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	sealSaltSize   = 16
+	sealIterations = 200000
+)
+
+// sealWithPassphrase encrypts plaintext with AES-256-GCM using a key derived
+// from passphrase. The output is salt || nonce || ciphertext.
+func sealWithPassphrase(plaintext []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, sealSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	gcm, err := newPassphraseGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, len(salt)+len(nonce)+len(plaintext)+gcm.Overhead())
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+func openWithPassphrase(sealed []byte, passphrase string) ([]byte, error) {
+	if len(sealed) < sealSaltSize {
+		return nil, fmt.Errorf("encrypted data is truncated")
+	}
+	gcm, err := newPassphraseGCM(passphrase, sealed[:sealSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	rest := sealed[sealSaltSize:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is truncated")
+	}
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted data")
+	}
+	return plaintext, nil
+}
+
+func newPassphraseGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is required")
+	}
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, sealIterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	plaintext := []byte("OPENAI_API_KEY=sk-test\n")
+	sealed, err := sealWithPassphrase(plaintext, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Fatal("sealed output contains the plaintext")
+	}
+	opened, err := openWithPassphrase(sealed, "correct horse")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("opened = %q, want %q", opened, plaintext)
+	}
+
+	again, err := sealWithPassphrase(plaintext, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again, sealed) {
+		t.Error("sealing twice gave the same output; salt and nonce must be random")
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	sealed, err := sealWithPassphrase([]byte("OPENCLAW_GATEWAY_TOKEN=secret\n"), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonceEnd := sealSaltSize + 12
+	tests := []struct {
+		name       string
+		sealed     []byte
+		passphrase string
+	}{
+		{"wrong passphrase", sealed, "battery staple"},
+		{"empty passphrase", sealed, ""},
+		{"flipped salt bit", flipBit(sealed, 0), "correct horse"},
+		{"flipped nonce bit", flipBit(sealed, sealSaltSize), "correct horse"},
+		{"flipped ciphertext bit", flipBit(sealed, nonceEnd), "correct horse"},
+		{"flipped tag bit", flipBit(sealed, len(sealed)-1), "correct horse"},
+		{"truncated tag", sealed[:len(sealed)-1], "correct horse"},
+		{"truncated salt", sealed[:sealSaltSize-1], "correct horse"},
+		{"appended byte", append(append([]byte(nil), sealed...), 0), "correct horse"},
+	}
+	for _, tt := range tests {
+		if _, err := openWithPassphrase(tt.sealed, tt.passphrase); err == nil {
+			t.Errorf("%s: open succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func flipBit(data []byte, index int) []byte {
+	out := append([]byte(nil), data...)
+	out[index] ^= 0x01
+	return out
+}
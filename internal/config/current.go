@@ -0,0 +1,221 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// managedEnvKeys are written from other options than Env, so they are
+// never read back as extra env values.
+var managedEnvKeys = map[string]bool{
+	"OPENCLAW_GATEWAY_TOKEN": true,
+	"HTTP_PROXY":             true,
+	"HTTPS_PROXY":            true,
+	"ALL_PROXY":              true,
+	"NO_PROXY":               true,
+}
+
+// CurrentWriteOptions reads back what the writer left in configDir: the
+// model and fallbacks, the gateway settings, channels, providers and the
+// extra env values, with openclaw.json itself as the Base that keeps what
+// the writer does not manage. Callers that change only part of the
+// configuration, such as a save from the web UI or init, start from it so
+// that what apply wrote is kept. The gateway token and proxy are left for
+// the caller.
+func CurrentWriteOptions(configDir string) (WriteOptions, error) {
+	opts := WriteOptions{ConfigDir: configDir}
+	envContent, err := os.ReadFile(filepath.Join(configDir, ".env"))
+	if err != nil && !os.IsNotExist(err) {
+		return WriteOptions{}, fmt.Errorf("read env: %w", err)
+	}
+	env := envValues(envContent)
+	configContent, err := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return WriteOptions{}, fmt.Errorf("read config: %w", err)
+	}
+
+	var cfg openclawConfig
+	// allowInsecureAuth is read on its own so that a missing key keeps the
+	// default rather than turning it off.
+	var controlUi struct {
+		Gateway struct {
+			ControlUi struct {
+				AllowInsecureAuth *bool `json:"allowInsecureAuth"`
+			} `json:"controlUi"`
+		} `json:"gateway"`
+	}
+	if len(configContent) > 0 {
+		if err := json.Unmarshal(configContent, &cfg); err != nil {
+			return WriteOptions{}, fmt.Errorf("parse openclaw.json: %w", err)
+		}
+		opts.Base = configContent
+		if err := json.Unmarshal(configContent, &controlUi); err != nil {
+			return WriteOptions{}, fmt.Errorf("parse openclaw.json: %w", err)
+		}
+	}
+	opts.Model = cfg.Agents.Defaults.Model.Primary
+	opts.Fallbacks = cfg.Agents.Defaults.Model.Fallbacks
+	opts.Gateway = GatewaySettings{
+		Mode:              cfg.Gateway.Mode,
+		Bind:              cfg.Gateway.Bind,
+		Port:              cfg.Gateway.Port,
+		AllowInsecureAuth: controlUi.Gateway.ControlUi.AllowInsecureAuth,
+	}
+	if len(cfg.Channels) > 0 && string(cfg.Channels) != "null" {
+		opts.Channels = cfg.Channels
+	}
+
+	// Providers come from the models.providers blocks, whose apiKey names
+	// their variable, and from the <ID>_API_KEY variables of providers that
+	// need no block.
+	modelRefs := append([]string{opts.Model}, opts.Fallbacks...)
+	byID := make(map[string]*ProviderKey)
+	providerKeys := make(map[string]bool)
+	if cfg.Models != nil {
+		for id, block := range cfg.Models.Providers {
+			provider := &ProviderKey{Provider: id}
+			if isEnvReference(block.ApiKey) {
+				provider.Key = strings.TrimSuffix(strings.TrimPrefix(block.ApiKey, "${"), "}")
+				provider.Value = env[provider.Key]
+				providerKeys[provider.Key] = true
+			}
+			provider.BaseUrl, provider.Region, provider.Api = currentEndpoint(id, block)
+			provider.Models = extraModelIDs(id, block, modelRefs)
+			byID[id] = provider
+		}
+	}
+	for key, value := range env {
+		if !strings.HasSuffix(key, "_API_KEY") || value == "" || providerKeys[key] {
+			continue
+		}
+		id := ProviderIDForEnvKey(key)
+		if byID[id] == nil {
+			byID[id] = &ProviderKey{Provider: id}
+		}
+		byID[id].Key = key
+		byID[id].Value = value
+		providerKeys[key] = true
+	}
+	ids := make([]string, 0, len(byID))
+	for id := range byID {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		opts.Providers = append(opts.Providers, *byID[id])
+	}
+
+	for key, value := range env {
+		if managedEnvKeys[key] || providerKeys[key] {
+			continue
+		}
+		if opts.Env == nil {
+			opts.Env = make(map[string]string)
+		}
+		opts.Env[key] = value
+	}
+	return opts, nil
+}
+
+// currentEndpoint turns a models.providers block back into a base URL, a
+// region preset and an API dialect, leaving out what the registry implies.
+func currentEndpoint(providerID string, block modelProvider) (baseUrl, region, api string) {
+	baseUrl = strings.TrimRight(block.BaseUrl, "/")
+	api = block.Api
+	info, known := LookupProvider(providerID)
+	if !known {
+		return baseUrl, "", api
+	}
+	if api == info.Api || (info.Api == "" && api == "openai-completions") {
+		api = ""
+	}
+	for _, candidate := range info.Regions() {
+		if info.Endpoints[candidate] == baseUrl {
+			return "", candidate, api
+		}
+	}
+	return baseUrl, "", api
+}
+
+// extraModelIDs are the models declared on a block beyond those the writer
+// derives from the model references. Only Ollama and providers outside the
+// registry get their models from ProviderKey.Models.
+func extraModelIDs(providerID string, block modelProvider, modelRefs []string) []string {
+	if _, known := LookupProvider(providerID); known && providerID != "ollama" {
+		return nil
+	}
+	derived := make(map[string]bool)
+	for _, id := range ownedModelIDs(providerID, nil, modelRefs) {
+		derived[id] = true
+	}
+	var extra []string
+	for _, model := range block.Models {
+		if !derived[model.ID] {
+			extra = append(extra, model.ID)
+		}
+	}
+	return extra
+}
+
+// MergeProviders adds providers to the configured ones, replacing an entry
+// with the same id. A replaced entry keeps its extra models when the new
+// one names none. Providers not named are kept, with their keys and
+// blocks, since fallbacks may still use them.
+func (o *WriteOptions) MergeProviders(providers []ProviderKey) {
+	merged := append([]ProviderKey(nil), o.Providers...)
+	for _, provider := range providers {
+		replaced := false
+		for i, current := range merged {
+			if current.ID() != provider.ID() {
+				continue
+			}
+			if len(provider.Models) == 0 {
+				provider.Models = current.Models
+			}
+			merged[i] = provider
+			replaced = true
+			break
+		}
+		if !replaced {
+			merged = append(merged, provider)
+		}
+	}
+	o.Providers = merged
+}
+
+// PruneFallbacks drops the fallbacks whose provider is not configured and
+// returns them. Callers that keep the fallbacks on disk call it after
+// changing the providers; the writer rejects such fallbacks otherwise.
+func (o *WriteOptions) PruneFallbacks() []string {
+	configured := o.providerIDs()
+	var kept, dropped []string
+	for _, ref := range o.Fallbacks {
+		if configured[modelRefProvider(ref)] {
+			kept = append(kept, ref)
+		} else {
+			dropped = append(dropped, ref)
+		}
+	}
+	if dropped != nil {
+		o.Fallbacks = kept
+	}
+	return dropped
+}
+
+func (o *WriteOptions) providerIDs() map[string]bool {
+	ids := make(map[string]bool, len(o.Providers))
+	for _, provider := range o.Providers {
+		ids[provider.ID()] = true
+	}
+	return ids
+}
+
+// modelRefProvider is the provider id of a provider/model reference.
+func modelRefProvider(ref string) string {
+	provider, _, _ := strings.Cut(strings.TrimSpace(ref), "/")
+	return strings.ToLower(provider)
+}
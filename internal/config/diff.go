@@ -0,0 +1,292 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const diffContext = 3
+
+var (
+	secretKeyPattern  = regexp.MustCompile(`(?i)(token|key|secret|password|passphrase)$`)
+	jsonSecretPattern = regexp.MustCompile(`^(\s*"([^"]+)"\s*:\s*")([^"]*)(".*)$`)
+	// urlUserinfoPattern matches the user:password@ part of a URL, such as
+	// the credentials of an HTTP_PROXY.
+	urlUserinfoPattern = regexp.MustCompile(`([A-Za-z][A-Za-z0-9+.-]*://)([^/@\s"']+)@`)
+)
+
+// DiffFile compares content with the file currently at path and returns the
+// change with a redacted unified diff. Secrets are replaced by a short
+// fingerprint so a changed value still shows up as a changed line.
+func DiffFile(path string, content []byte) FileChange {
+	current, err := os.ReadFile(path)
+	change := FileChange{Path: path}
+	switch {
+	case err != nil:
+		change.Action = "create"
+	case bytes.Equal(current, content):
+		change.Action = "unchanged"
+		return change
+	default:
+		change.Action = "update"
+	}
+
+	name := filepath.Base(path)
+	change.Keys = changedKeys(name, current, content)
+	change.Diff = unifiedDiff(
+		"a/"+name,
+		"b/"+name,
+		splitLines(RedactContent(name, current)),
+		splitLines(RedactContent(name, content)),
+	)
+	return change
+}
+
+// changedKeys lists the .env variables or JSON leaf paths whose values
+// differ between before and after. Files that do not parse yield nil.
+func changedKeys(name string, before, after []byte) []string {
+	var old, updated map[string]string
+	if strings.HasSuffix(name, ".json") {
+		old, updated = flattenJSON(before), flattenJSON(after)
+	} else {
+		old, updated = envValues(before), envValues(after)
+	}
+	if updated == nil {
+		return nil
+	}
+	var keys []string
+	for key, value := range updated {
+		if previous, ok := old[key]; !ok || previous != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range old {
+		if _, ok := updated[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func envValues(content []byte) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		if key, value, ok := splitEnvLine(line); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// flattenJSON maps every leaf path of a JSON document to its encoded value.
+func flattenJSON(content []byte) map[string]string {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return map[string]string{}
+	}
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil
+	}
+	values := make(map[string]string)
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		if object, ok := value.(map[string]interface{}); ok && len(object) > 0 {
+			for key, child := range object {
+				path := key
+				if prefix != "" {
+					path = prefix + "." + key
+				}
+				walk(path, child)
+			}
+			return
+		}
+		encoded, _ := json.Marshal(value)
+		values[prefix] = string(encoded)
+	}
+	walk("", doc)
+	return values
+}
+
+// RedactContent masks secret values and URL credentials in a .env or JSON
+// file.
+func RedactContent(name string, content []byte) []byte {
+	lines := strings.Split(string(content), "\n")
+	isJSON := strings.HasSuffix(name, ".json")
+	for i, line := range lines {
+		if isJSON {
+			match := jsonSecretPattern.FindStringSubmatch(line)
+			if match == nil || !secretKeyPattern.MatchString(match[2]) || isEnvReference(match[3]) {
+				lines[i] = redactUserinfo(line)
+				continue
+			}
+			lines[i] = match[1] + redactValue(match[3]) + match[4]
+			continue
+		}
+		key, value, ok := splitEnvLine(line)
+		if !ok || !secretKeyPattern.MatchString(key) {
+			lines[i] = redactUserinfo(line)
+			continue
+		}
+		lines[i] = key + "=" + redactValue(value)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// redactUserinfo replaces the credentials of every URL in line with a
+// fingerprint and keeps the scheme and host readable.
+func redactUserinfo(line string) string {
+	return urlUserinfoPattern.ReplaceAllStringFunc(line, func(match string) string {
+		parts := urlUserinfoPattern.FindStringSubmatch(match)
+		return parts[1] + redactValue(parts[2]) + "@"
+	})
+}
+
+func redactValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "<redacted:" + hex.EncodeToString(sum[:3]) + ">"
+}
+
+func isEnvReference(value string) bool {
+	return strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}")
+}
+
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	text := strings.TrimSuffix(string(content), "\n")
+	return strings.Split(text, "\n")
+}
+
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff renders a line diff in unified format using an LCS table. The
+// files handled here are small, so the quadratic table is fine.
+func unifiedDiff(fromName, toName string, a, b []string) string {
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	for start := 0; start < len(ops); {
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		hunkStart := start - diffContext
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				break
+			}
+			end = run
+		}
+		hunkEnd := end + diffContext
+		if hunkEnd > len(ops) {
+			hunkEnd = len(ops)
+		}
+
+		aLine, bLine := 1, 1
+		for _, op := range ops[:hunkStart] {
+			if op.kind != '+' {
+				aLine++
+			}
+			if op.kind != '-' {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, op := range ops[hunkStart:hunkEnd] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		if aCount == 0 {
+			aLine--
+		}
+		if bCount == 0 {
+			bLine--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+		for _, op := range ops[hunkStart:hunkEnd] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		start = hunkEnd
+	}
+	return out.String()
+}
+
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
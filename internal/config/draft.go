@@ -0,0 +1,394 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// draftTokenSecret names the gateway token in Draft.MissingSecrets.
+const draftTokenSecret = "gatewayToken"
+
+// Draft is a configuration prepared through several edits and applied with
+// a single write and restart. It is based on the revision it was started
+// from, so applying it over newer changes can be refused.
+type Draft struct {
+	BaseRevision    string          `json:"baseRevision"`
+	Model           string          `json:"model"`
+	Fallbacks       []string        `json:"fallbacks"`
+	GatewayToken    string          `json:"gatewayToken,omitempty"`
+	Providers       []ProviderKey   `json:"providers"`
+	Gateway         GatewaySettings `json:"gateway"`
+	Channels        json.RawMessage `json:"channels,omitempty"`
+	RewriteLoopback bool            `json:"rewriteLoopback,omitempty"`
+	UpdatedAt       time.Time       `json:"updatedAt"`
+	// MissingSecrets lists the provider ids, and "gatewayToken", whose
+	// secrets were not kept across a server restart and must be entered
+	// again before the draft is applied.
+	MissingSecrets []string `json:"missingSecrets,omitempty"`
+}
+
+// DraftEdit is one change to a draft. Providers are matched by ID; an
+// empty Key or Value keeps the one already in the draft, so a base URL can
+// be changed without sending the key again, and so do empty Models.
+// Fallbacks, Gateway and Channels replace the draft's when set; channels
+// set to null are removed.
+type DraftEdit struct {
+	Model           *string          `json:"model,omitempty"`
+	Fallbacks       *[]string        `json:"fallbacks,omitempty"`
+	GatewayToken    *string          `json:"gatewayToken,omitempty"`
+	RotateToken     bool             `json:"rotateToken,omitempty"`
+	Providers       []ProviderKey    `json:"providers,omitempty"`
+	RemoveProviders []string         `json:"removeProviders,omitempty"`
+	Gateway         *GatewaySettings `json:"gateway,omitempty"`
+	Channels        json.RawMessage  `json:"channels,omitempty"`
+	RewriteLoopback *bool            `json:"rewriteLoopback,omitempty"`
+	// Rebase moves the draft onto the current revision, accepting that
+	// it will replace whatever changed since it was started.
+	Rebase bool `json:"rebase,omitempty"`
+}
+
+// NewDraft starts a draft from the configuration in configDir, so edits
+// add to what is there instead of replacing it. Everything the writer
+// reads back is carried, including regions, fallbacks, the gateway
+// settings and channels.
+func NewDraft(configDir string) (*Draft, error) {
+	revision, err := ConfigRevision(configDir)
+	if err != nil {
+		return nil, err
+	}
+	current, err := CurrentWriteOptions(configDir)
+	if err != nil {
+		return nil, err
+	}
+	draft := &Draft{
+		BaseRevision: revision,
+		Model:        current.Model,
+		Fallbacks:    append([]string{}, current.Fallbacks...),
+		Providers:    append([]ProviderKey{}, current.Providers...),
+		Gateway:      current.Gateway,
+		Channels:     current.Channels,
+		UpdatedAt:    time.Now().UTC(),
+	}
+	return draft, nil
+}
+
+// Apply makes edit to the draft. configDir is only read for a rebase.
+func (d *Draft) Apply(edit DraftEdit, configDir string) error {
+	for _, provider := range edit.Providers {
+		if provider.ID() == "" {
+			return fmt.Errorf("provider needs an id or an env key")
+		}
+		if api := strings.TrimSpace(provider.Api); api != "" && !IsAPIDialect(api) {
+			return fmt.Errorf("provider %s: unsupported api %q", provider.ID(), api)
+		}
+	}
+	if len(edit.Channels) > 0 && string(edit.Channels) != "null" {
+		var channels map[string]json.RawMessage
+		if err := json.Unmarshal(edit.Channels, &channels); err != nil {
+			return fmt.Errorf("channels must be a JSON object: %w", err)
+		}
+	}
+
+	if edit.Rebase {
+		revision, err := ConfigRevision(configDir)
+		if err != nil {
+			return err
+		}
+		d.BaseRevision = revision
+	}
+	if edit.Model != nil {
+		d.Model = strings.TrimSpace(*edit.Model)
+	}
+	if edit.Fallbacks != nil {
+		d.Fallbacks = append([]string{}, *edit.Fallbacks...)
+	}
+	if edit.Gateway != nil {
+		d.Gateway = *edit.Gateway
+	}
+	switch {
+	case string(edit.Channels) == "null":
+		d.Channels = nil
+	case len(edit.Channels) > 0:
+		d.Channels = append(json.RawMessage(nil), edit.Channels...)
+	}
+	if edit.GatewayToken != nil {
+		d.GatewayToken = strings.TrimSpace(*edit.GatewayToken)
+		d.clearMissing(draftTokenSecret)
+	}
+	if edit.RotateToken {
+		token, err := GenerateGatewayToken()
+		if err != nil {
+			return err
+		}
+		d.GatewayToken = token
+		d.clearMissing(draftTokenSecret)
+	}
+	if edit.RewriteLoopback != nil {
+		d.RewriteLoopback = *edit.RewriteLoopback
+	}
+	for _, id := range edit.RemoveProviders {
+		id = strings.ToLower(strings.TrimSpace(id))
+		kept := d.Providers[:0]
+		for _, provider := range d.Providers {
+			if provider.ID() != id {
+				kept = append(kept, provider)
+			}
+		}
+		d.Providers = kept
+		d.clearMissing(id)
+	}
+	for _, provider := range edit.Providers {
+		d.upsertProvider(provider)
+	}
+	d.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (d *Draft) upsertProvider(update ProviderKey) {
+	id := update.ID()
+	for i, current := range d.Providers {
+		if current.ID() != id {
+			continue
+		}
+		if strings.TrimSpace(update.Key) == "" {
+			update.Key = current.Key
+		}
+		if strings.TrimSpace(update.Value) == "" {
+			update.Value = current.Value
+		} else {
+			d.clearMissing(id)
+		}
+		if len(update.Models) == 0 {
+			update.Models = current.Models
+		}
+		d.Providers[i] = update
+		return
+	}
+	d.Providers = append(d.Providers, update)
+}
+
+func (d *Draft) clearMissing(name string) {
+	kept := d.MissingSecrets[:0]
+	for _, missing := range d.MissingSecrets {
+		if missing != name {
+			kept = append(kept, missing)
+		}
+	}
+	d.MissingSecrets = kept
+	if len(d.MissingSecrets) == 0 {
+		d.MissingSecrets = nil
+	}
+}
+
+// SecretValues returns the gateway token and provider keys of the draft,
+// for the redactor of a request that answers with it.
+func (d *Draft) SecretValues() []string {
+	if d == nil {
+		return nil
+	}
+	values := []string{d.GatewayToken}
+	for _, provider := range d.Providers {
+		values = append(values, provider.Value)
+	}
+	return values
+}
+
+// DraftStore keeps the single server-side draft in memory and in a file.
+// Secrets are sealed with the passphrase when one is configured; without
+// it they are left out of the file and reported as missing after a
+// restart.
+type DraftStore struct {
+	mu         sync.Mutex
+	path       string
+	passphrase string
+	draft      *Draft
+}
+
+type storedDraft struct {
+	Draft           Draft  `json:"draft"`
+	HasGatewayToken bool   `json:"hasGatewayToken,omitempty"`
+	Sealed          []byte `json:"sealed,omitempty"`
+}
+
+type draftSecrets struct {
+	GatewayToken string            `json:"gatewayToken,omitempty"`
+	Providers    map[string]string `json:"providers,omitempty"`
+}
+
+// NewDraftStore loads the draft saved at path, if any. The store is usable
+// even when loading fails: it starts empty, and the next edit replaces the
+// unreadable file. An empty path keeps the draft in memory only.
+func NewDraftStore(path, passphrase string) (*DraftStore, error) {
+	store := &DraftStore{path: path, passphrase: passphrase}
+	draft, err := store.load()
+	store.draft = draft
+	return store, err
+}
+
+// Update runs fn on a copy of the current draft, or on a new one started
+// from configDir, and keeps the result only if fn succeeds.
+func (s *DraftStore) Update(configDir string, fn func(*Draft) error) (*Draft, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var draft *Draft
+	if s.draft != nil {
+		draft = s.draft.clone()
+	} else {
+		var err error
+		draft, err = NewDraft(configDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := fn(draft); err != nil {
+		return nil, err
+	}
+	if err := s.save(draft); err != nil {
+		return nil, err
+	}
+	s.draft = draft
+	return draft.clone(), nil
+}
+
+// Current returns a copy of the draft, or nil when there is none.
+func (s *DraftStore) Current() *Draft {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draft == nil {
+		return nil
+	}
+	return s.draft.clone()
+}
+
+// Discard drops the draft from memory and disk.
+func (s *DraftStore) Discard() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.discard()
+}
+
+// DiscardIfUnchanged drops the draft only if it was not edited since
+// snapshot was taken from it, and reports whether it did.
+func (s *DraftStore) DiscardIfUnchanged(snapshot *Draft) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draft == nil || !s.draft.UpdatedAt.Equal(snapshot.UpdatedAt) {
+		return false, nil
+	}
+	return true, s.discard()
+}
+
+func (s *DraftStore) discard() error {
+	s.draft = nil
+	if s.path == "" {
+		return nil
+	}
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove draft: %w", err)
+	}
+	return nil
+}
+
+func (d *Draft) clone() *Draft {
+	copied := *d
+	copied.Fallbacks = append([]string{}, d.Fallbacks...)
+	copied.Providers = append([]ProviderKey(nil), d.Providers...)
+	copied.Channels = append(json.RawMessage(nil), d.Channels...)
+	copied.MissingSecrets = append([]string(nil), d.MissingSecrets...)
+	return &copied
+}
+
+func (s *DraftStore) save(draft *Draft) error {
+	if s.path == "" {
+		return nil
+	}
+	stored := storedDraft{Draft: *draft.clone(), HasGatewayToken: draft.GatewayToken != ""}
+	secrets := draftSecrets{GatewayToken: draft.GatewayToken, Providers: make(map[string]string)}
+	stored.Draft.GatewayToken = ""
+	for i, provider := range stored.Draft.Providers {
+		if provider.Key != "" && provider.Value != "" {
+			secrets.Providers[provider.ID()] = provider.Value
+			stored.Draft.Providers[i].Value = ""
+		}
+	}
+	if s.passphrase != "" {
+		plaintext, err := json.Marshal(secrets)
+		if err != nil {
+			return err
+		}
+		sealed, err := sealWithPassphrase(plaintext, s.passphrase)
+		if err != nil {
+			return err
+		}
+		stored.Sealed = sealed
+	}
+
+	content, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("create draft dir: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o600); err != nil {
+		return fmt.Errorf("write draft: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("write draft: %w", err)
+	}
+	return nil
+}
+
+func (s *DraftStore) load() (*Draft, error) {
+	if s.path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read draft: %w", err)
+	}
+	var stored storedDraft
+	if err := json.Unmarshal(content, &stored); err != nil {
+		return nil, fmt.Errorf("parse draft %s: %w", s.path, err)
+	}
+	draft := stored.Draft
+	draft.MissingSecrets = nil
+
+	// Secrets that cannot be opened, for example after the passphrase
+	// changed, are reported as missing rather than losing the draft.
+	secrets := draftSecrets{}
+	var secretsErr error
+	if len(stored.Sealed) > 0 && s.passphrase != "" {
+		plaintext, err := openWithPassphrase(stored.Sealed, s.passphrase)
+		if err == nil {
+			err = json.Unmarshal(plaintext, &secrets)
+		}
+		if err != nil {
+			secrets = draftSecrets{}
+			secretsErr = fmt.Errorf("open draft secrets: %w", err)
+		}
+	}
+
+	draft.GatewayToken = secrets.GatewayToken
+	if stored.HasGatewayToken && draft.GatewayToken == "" {
+		draft.MissingSecrets = append(draft.MissingSecrets, draftTokenSecret)
+	}
+	for i, provider := range draft.Providers {
+		value, ok := secrets.Providers[provider.ID()]
+		if ok {
+			draft.Providers[i].Value = value
+		} else if provider.Key != "" {
+			draft.MissingSecrets = append(draft.MissingSecrets, provider.ID())
+		}
+	}
+	return &draft, secretsErr
+}
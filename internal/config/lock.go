@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// processLocks holds one mutex per lock file, since an advisory file lock
+// does not exclude other goroutines of the process holding it.
+var processLocks sync.Map
+
+// LockComposeDir serializes configuration writes to composeDir: it takes an
+// in-process mutex and then an advisory lock on
+// .openclaw-setup/config.lock, so saves from the server, init, migrate
+// and import never interleave. It blocks until both are held; the returned
+// function releases them and must be called once the write, and any
+// restart that depends on it, has finished.
+func LockComposeDir(composeDir string) (func(), error) {
+	dir := StateDir(composeDir)
+	path := filepath.Join(dir, "config.lock")
+	value, _ := processLocks.LoadOrStore(path, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		mu.Unlock()
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		mu.Unlock()
+		return nil, fmt.Errorf("open config lock: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		mu.Unlock()
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	return func() {
+		unlockFile(file)
+		file.Close()
+		mu.Unlock()
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package config
+
+import "os"
+
+// Without flock only the in-process mutex of LockComposeDir applies.
+func lockFile(*os.File) error { return nil }
+
+func unlockFile(*os.File) {}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLockComposeDirExcludesHolders(t *testing.T) {
+	composeDir := t.TempDir()
+	var holders, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := LockComposeDir(composeDir)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			now := holders.Add(1)
+			for old := peak.Load(); now > old && !peak.CompareAndSwap(old, now); old = peak.Load() {
+			}
+			time.Sleep(2 * time.Millisecond)
+			holders.Add(-1)
+		}()
+	}
+	wg.Wait()
+	if got := peak.Load(); got != 1 {
+		t.Errorf("%d holders at once, want 1", got)
+	}
+
+	// A second holder waits for the first to unlock.
+	unlock, err := LockComposeDir(composeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan func())
+	go func() {
+		second, err := LockComposeDir(composeDir)
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- second
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("the second holder got the lock while the first held it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case second, ok := <-acquired:
+		if ok {
+			second()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second holder never got the lock")
+	}
+}
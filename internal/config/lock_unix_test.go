@@ -0,0 +1,35 @@
+//go:build unix
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestLockComposeDirHoldsFlock checks the file lock another process would
+// contend for, by trying it through a separate open of the lock file.
+func TestLockComposeDirHoldsFlock(t *testing.T) {
+	composeDir := t.TempDir()
+	unlock, err := LockComposeDir(composeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(filepath.Join(StateDir(composeDir), "config.lock"), os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); !errors.Is(err, syscall.EWOULDBLOCK) {
+		t.Fatalf("flock while held: %v, want EWOULDBLOCK", err)
+	}
+	unlock()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		t.Fatalf("flock after unlock: %v", err)
+	}
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
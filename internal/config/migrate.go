@@ -0,0 +1,621 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var legacyEnvPrefixes = []string{"CLAWDBOT_", "MOLTBOT_"}
+
+type MigrateOptions struct {
+	ComposeDir string
+	ConfigDir  string
+}
+
+type MigrateReport struct {
+	Source  string        `json:"source"`
+	Mapped  []string      `json:"mapped"`
+	Renamed []FieldRename `json:"renamed"`
+	// Kept lists the top-level keys copied over unchanged because the
+	// migration does not know them, such as channels.
+	Kept    []string `json:"kept"`
+	Dropped []string `json:"dropped"`
+	Backups []string `json:"backups"`
+}
+
+type FieldRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// legacySections are the top-level keys convertLegacyConfig reads; any
+// other top-level key is carried over as is.
+var legacySections = map[string]bool{"gateway": true, "agents": true, "agent": true, "models": true}
+
+// Migrate converts a Moltbot, Clawdbot or OpenClaw config found under the
+// compose dir into the current openclaw.json layout and renames legacy env
+// keys. An openclaw.json without legacy fields is left alone. Everything is
+// validated before the first write, and every file is backed up before it
+// is rewritten.
+func Migrate(opts MigrateOptions) (*MigrateReport, error) {
+	if strings.TrimSpace(opts.ConfigDir) == "" {
+		return nil, fmt.Errorf("config dir is required")
+	}
+
+	source, err := findLegacyConfig(opts.ComposeDir, opts.ConfigDir)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	var raw map[string]interface{}
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filepath.Base(source), err)
+	}
+	if err := json.Unmarshal(content, &top); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filepath.Base(source), err)
+	}
+
+	report := &MigrateReport{Source: source}
+	cfg, err := convertLegacyConfig(raw, report)
+	if err != nil {
+		return nil, err
+	}
+	// Rewriting a current openclaw.json would only lose the fields the
+	// migration does not know, so only its env keys are migrated.
+	current := filepath.Base(source) == "openclaw.json" && len(report.Renamed) == 0
+	if current {
+		report = &MigrateReport{Source: source}
+	}
+
+	envPaths := []string{filepath.Join(opts.ConfigDir, ".env")}
+	if strings.TrimSpace(opts.ComposeDir) != "" {
+		envPaths = append(envPaths, filepath.Join(opts.ComposeDir, ".env"))
+	}
+	envFiles := make([]envRewrite, 0, len(envPaths))
+	for _, envPath := range envPaths {
+		file, err := planEnvFile(envPath, report)
+		if err != nil {
+			return nil, err
+		}
+		envFiles = append(envFiles, file)
+	}
+
+	var configPayload []byte
+	if current {
+		if len(report.Renamed) == 0 && len(report.Dropped) == 0 {
+			return nil, fmt.Errorf("%s is already current and no legacy env keys were found", source)
+		}
+	} else {
+		if strings.TrimSpace(cfg.Gateway.Auth.Token) == "" {
+			cfg.Gateway.Auth.Token = lookupEnvToken(envFiles)
+		}
+		if strings.TrimSpace(cfg.Gateway.Auth.Token) == "" {
+			return nil, fmt.Errorf("gateway token not found in config or env")
+		}
+		configPayload, err = marshalMigratedConfig(cfg, top, report.Kept)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Everything has been checked; only now is the disk touched.
+	for _, file := range envFiles {
+		if !file.changed {
+			continue
+		}
+		if err := writeWithBackup(file.path, file.content, report); err != nil {
+			return nil, err
+		}
+	}
+	if configPayload != nil {
+		if err := os.MkdirAll(opts.ConfigDir, 0o755); err != nil {
+			return nil, fmt.Errorf("create config dir: %w", err)
+		}
+		if err := writeWithBackup(filepath.Join(opts.ConfigDir, "openclaw.json"), configPayload, report); err != nil {
+			return nil, err
+		}
+	}
+	// A legacy file left in place would be found again by the next run and
+	// overwrite the openclaw.json written now.
+	if filepath.Base(source) != "openclaw.json" {
+		retired, err := retireFile(source)
+		if err != nil {
+			return nil, err
+		}
+		report.Backups = append(report.Backups, retired)
+	}
+
+	return report, nil
+}
+
+// findLegacyConfig prefers the Moltbot and Clawdbot files, which are only
+// left behind by older installs, over an openclaw.json that may already be
+// current. Migrate renames a legacy file once it is converted, so a second
+// run finds openclaw.json.
+func findLegacyConfig(composeDir, configDir string) (string, error) {
+	candidates := []string{
+		filepath.Join(configDir, "moltbot.json"),
+		filepath.Join(configDir, "clawdbot.json"),
+	}
+	if strings.TrimSpace(composeDir) != "" {
+		candidates = append(candidates,
+			filepath.Join(composeDir, "data", ".moltbot", "moltbot.json"),
+			filepath.Join(composeDir, "data", ".clawdbot", "clawdbot.json"),
+		)
+	}
+	candidates = append(candidates, filepath.Join(configDir, "openclaw.json"))
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no openclaw.json, moltbot.json or clawdbot.json found in %s", configDir)
+}
+
+func convertLegacyConfig(raw map[string]interface{}, report *MigrateReport) (openclawConfig, error) {
+	cfg := defaultConfig("", "")
+
+	if value, ok := takeString(raw, "gateway", "mode"); ok {
+		cfg.Gateway.Mode = value
+		report.mapped("gateway.mode")
+	}
+	if value, ok := takeString(raw, "gateway", "bind"); ok {
+		cfg.Gateway.Bind = value
+		report.mapped("gateway.bind")
+	}
+	if value, ok := take(raw, "gateway", "port"); ok {
+		port, isNumber := value.(float64)
+		if !isNumber || port <= 0 || port > 65535 || port != float64(int(port)) {
+			return cfg, fmt.Errorf("gateway.port is not a valid port: %v", value)
+		}
+		cfg.Gateway.Port = int(port)
+		report.mapped("gateway.port")
+	}
+	if value, ok := takeString(raw, "gateway", "auth", "mode"); ok {
+		cfg.Gateway.Auth.Mode = value
+		report.mapped("gateway.auth.mode")
+	}
+	if value, ok := takeString(raw, "gateway", "auth", "token"); ok {
+		cfg.Gateway.Auth.Token = value
+		report.mapped("gateway.auth.token")
+	}
+	if value, ok := takeString(raw, "gateway", "token"); ok {
+		if cfg.Gateway.Auth.Token == "" {
+			cfg.Gateway.Auth.Token = value
+			report.renamed("gateway.token", "gateway.auth.token")
+		} else {
+			report.dropped("gateway.token")
+		}
+	}
+	if value, ok := take(raw, "gateway", "controlUi", "allowInsecureAuth"); ok {
+		if allow, isBool := value.(bool); isBool {
+			cfg.Gateway.ControlUi.AllowInsecureAuth = allow
+			report.mapped("gateway.controlUi.allowInsecureAuth")
+		} else {
+			report.dropped("gateway.controlUi.allowInsecureAuth")
+		}
+	}
+
+	if value, ok := take(raw, "agents", "defaults", "model"); ok {
+		switch model := value.(type) {
+		case string:
+			cfg.Agents.Defaults.Model.Primary = model
+			report.renamed("agents.defaults.model", "agents.defaults.model.primary")
+		case map[string]interface{}:
+			if primary, isString := model["primary"].(string); isString {
+				cfg.Agents.Defaults.Model.Primary = primary
+				report.mapped("agents.defaults.model.primary")
+				delete(model, "primary")
+			}
+			for _, path := range leafPaths("agents.defaults.model", model) {
+				report.dropped(path)
+			}
+		default:
+			report.dropped("agents.defaults.model")
+		}
+	}
+	if value, ok := take(raw, "agent", "model"); ok {
+		primary := ""
+		switch model := value.(type) {
+		case string:
+			primary = model
+		case map[string]interface{}:
+			primary, _ = model["primary"].(string)
+		}
+		if primary != "" && cfg.Agents.Defaults.Model.Primary == "" {
+			cfg.Agents.Defaults.Model.Primary = primary
+			report.renamed("agent.model", "agents.defaults.model.primary")
+		} else {
+			report.dropped("agent.model")
+		}
+	}
+
+	if value, ok := take(raw, "models"); ok {
+		payload, err := json.Marshal(value)
+		if err != nil {
+			return cfg, fmt.Errorf("marshal models: %w", err)
+		}
+		var models modelsConfig
+		if err := json.Unmarshal(payload, &models); err != nil {
+			report.dropped("models")
+		} else {
+			cfg.Models = &models
+			report.mapped("models")
+			// Fields modelsConfig does not know, such as provider headers,
+			// are lost on the way through it.
+			written, err := json.Marshal(models)
+			if err != nil {
+				return cfg, fmt.Errorf("marshal models: %w", err)
+			}
+			var kept interface{}
+			if err := json.Unmarshal(written, &kept); err != nil {
+				return cfg, fmt.Errorf("marshal models: %w", err)
+			}
+			for _, path := range missingPaths("models", value, kept) {
+				report.dropped(path)
+			}
+		}
+	}
+
+	for key := range raw {
+		if !legacySections[key] {
+			report.Kept = append(report.Kept, key)
+			delete(raw, key)
+		}
+	}
+	sort.Strings(report.Kept)
+	for _, path := range leafPaths("", raw) {
+		report.dropped(path)
+	}
+
+	if strings.TrimSpace(cfg.Agents.Defaults.Model.Primary) == "" {
+		return cfg, fmt.Errorf("no default model found in legacy config")
+	}
+	return cfg, nil
+}
+
+// envRewrite is an env file as it will read after the migration.
+type envRewrite struct {
+	path    string
+	content []byte
+	changed bool
+}
+
+// planEnvFile renames the legacy keys of the env file at path in memory.
+// A missing file yields an empty, unchanged rewrite.
+func planEnvFile(path string, report *MigrateReport) (envRewrite, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return envRewrite{path: path}, nil
+		}
+		return envRewrite{}, fmt.Errorf("read env: %w", err)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	present := make(map[string]bool)
+	for _, line := range lines {
+		if key, _, ok := splitEnvLine(line); ok {
+			present[key] = true
+		}
+	}
+
+	label := envLabel(path)
+	changed := false
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		key, value, ok := splitEnvLine(line)
+		if !ok {
+			result = append(result, line)
+			continue
+		}
+		renamed := renameLegacyEnvKey(key)
+		if renamed == key {
+			result = append(result, line)
+			continue
+		}
+		changed = true
+		if present[renamed] {
+			report.dropped(label + ":" + key)
+			continue
+		}
+		present[renamed] = true
+		result = append(result, fmt.Sprintf("%s=%s", renamed, value))
+		report.renamed(label+":"+key, label+":"+renamed)
+	}
+	if !changed {
+		return envRewrite{path: path, content: content}, nil
+	}
+	return envRewrite{path: path, content: []byte(strings.Join(result, "\n")), changed: true}, nil
+}
+
+func lookupEnvToken(files []envRewrite) string {
+	for _, file := range files {
+		for _, line := range strings.Split(string(file.content), "\n") {
+			key, value, ok := splitEnvLine(line)
+			if ok && key == "OPENCLAW_GATEWAY_TOKEN" && value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+func renameLegacyEnvKey(key string) string {
+	for _, prefix := range legacyEnvPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return "OPENCLAW_" + strings.TrimPrefix(key, prefix)
+		}
+	}
+	return key
+}
+
+func splitEnvLine(line string) (string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", "", false
+	}
+	parts := strings.SplitN(trimmed, "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	key := strings.TrimSpace(parts[0])
+	if key == "" {
+		return "", "", false
+	}
+	value := strings.TrimSpace(parts[1])
+	value = strings.Trim(value, "\"")
+	value = strings.Trim(value, "'")
+	return key, strings.TrimSpace(value), true
+}
+
+func envLabel(path string) string {
+	dir := filepath.Base(filepath.Dir(path))
+	if dir == "conf" {
+		return "data/conf/.env"
+	}
+	return ".env"
+}
+
+// backupFile copies path next to itself with a timestamp suffix and returns
+// the backup path, or "" when there is nothing to back up. A counter is
+// added when a backup from the same second exists, so none is overwritten.
+func backupFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	stamp := fmt.Sprintf("%s.bak-%s", path, time.Now().Format("20060102-150405"))
+	for attempt := 0; ; attempt++ {
+		backup := stamp
+		if attempt > 0 {
+			backup = fmt.Sprintf("%s-%d", stamp, attempt)
+		}
+		file, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("backup %s: %w", filepath.Base(path), err)
+		}
+		_, err = file.Write(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", fmt.Errorf("backup %s: %w", filepath.Base(path), err)
+		}
+		return backup, nil
+	}
+}
+
+// retireFile renames a migrated legacy config to <name>.migrated-<time>,
+// adding a counter like backupFile, and returns the new path.
+func retireFile(path string) (string, error) {
+	stamp := fmt.Sprintf("%s.migrated-%s", path, time.Now().Format("20060102-150405"))
+	for attempt := 0; ; attempt++ {
+		retired := stamp
+		if attempt > 0 {
+			retired = fmt.Sprintf("%s-%d", stamp, attempt)
+		}
+		if _, err := os.Lstat(retired); err == nil {
+			continue
+		}
+		if err := os.Rename(path, retired); err != nil {
+			return "", fmt.Errorf("rename %s: %w", filepath.Base(path), err)
+		}
+		return retired, nil
+	}
+}
+
+func writeWithBackup(path string, content []byte, report *MigrateReport) error {
+	backup, err := backupFile(path)
+	if err != nil {
+		return err
+	}
+	if backup != "" {
+		report.Backups = append(report.Backups, backup)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// marshalMigratedConfig renders cfg followed by the kept top-level keys,
+// copied verbatim from the source, and validates the result.
+func marshalMigratedConfig(cfg openclawConfig, source map[string]json.RawMessage, kept []string) ([]byte, error) {
+	payload, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal config: %w", err)
+	}
+	var merged bytes.Buffer
+	merged.Write(payload[:len(payload)-1])
+	for _, key := range kept {
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, fmt.Errorf("marshal config: %w", err)
+		}
+		merged.WriteByte(',')
+		merged.Write(name)
+		merged.WriteByte(':')
+		merged.Write(source[key])
+	}
+	merged.WriteByte('}')
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, merged.Bytes(), "", "  "); err != nil {
+		return nil, fmt.Errorf("marshal config: %w", err)
+	}
+	if errs := ValidateConfig(indented.Bytes()); len(errs) > 0 {
+		return nil, errs
+	}
+	return indented.Bytes(), nil
+}
+
+// marshalConfig renders cfg and validates the result, so nothing that the
+// gateway would reject is ever written.
+func marshalConfig(cfg openclawConfig) ([]byte, error) {
+	payload, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal config: %w", err)
+	}
+	if errs := ValidateConfig(payload); len(errs) > 0 {
+		return nil, errs
+	}
+	return payload, nil
+}
+
+func take(raw map[string]interface{}, path ...string) (interface{}, bool) {
+	current := raw
+	for i, key := range path {
+		value, ok := current[key]
+		if !ok {
+			return nil, false
+		}
+		if i == len(path)-1 {
+			delete(current, key)
+			pruneEmpty(raw, path[:i])
+			return value, true
+		}
+		next, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return nil, false
+}
+
+func takeString(raw map[string]interface{}, path ...string) (string, bool) {
+	value, ok := take(raw, path...)
+	if !ok {
+		return "", false
+	}
+	text, isString := value.(string)
+	if !isString {
+		return "", false
+	}
+	return text, true
+}
+
+// pruneEmpty removes objects along path that became empty after take so
+// they are not reported as dropped.
+func pruneEmpty(raw map[string]interface{}, path []string) {
+	for depth := len(path); depth > 0; depth-- {
+		parent := raw
+		for _, key := range path[:depth-1] {
+			parent, _ = parent[key].(map[string]interface{})
+			if parent == nil {
+				return
+			}
+		}
+		child, ok := parent[path[depth-1]].(map[string]interface{})
+		if !ok || len(child) > 0 {
+			return
+		}
+		delete(parent, path[depth-1])
+	}
+}
+
+func leafPaths(prefix string, raw map[string]interface{}) []string {
+	var paths []string
+	for key, value := range raw {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if child, ok := value.(map[string]interface{}); ok && len(child) > 0 {
+			paths = append(paths, leafPaths(path, child)...)
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// missingPaths lists the leaves of original that kept, the same value after
+// a round trip through a typed struct, no longer has.
+func missingPaths(prefix string, original, kept interface{}) []string {
+	var paths []string
+	switch value := original.(type) {
+	case map[string]interface{}:
+		keptMap, _ := kept.(map[string]interface{})
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			path := prefix + "." + key
+			keptValue, ok := keptMap[key]
+			if !ok {
+				if child, isMap := value[key].(map[string]interface{}); isMap && len(child) > 0 {
+					paths = append(paths, leafPaths(path, child)...)
+				} else {
+					paths = append(paths, path)
+				}
+				continue
+			}
+			paths = append(paths, missingPaths(path, value[key], keptValue)...)
+		}
+	case []interface{}:
+		keptList, _ := kept.([]interface{})
+		for i, item := range value {
+			path := fmt.Sprintf("%s[%d]", prefix, i)
+			if i >= len(keptList) {
+				paths = append(paths, path)
+				continue
+			}
+			paths = append(paths, missingPaths(path, item, keptList[i])...)
+		}
+	}
+	return paths
+}
+
+func (r *MigrateReport) mapped(path string) {
+	r.Mapped = append(r.Mapped, path)
+}
+
+func (r *MigrateReport) renamed(from, to string) {
+	r.Renamed = append(r.Renamed, FieldRename{From: from, To: to})
+}
+
+func (r *MigrateReport) dropped(path string) {
+	r.Dropped = append(r.Dropped, path)
+}
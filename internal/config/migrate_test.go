@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestMigratePrefersLegacySourceAndKeepsUnknownKeys(t *testing.T) {
+	configDir := t.TempDir()
+	writeFile(t, filepath.Join(configDir, "openclaw.json"), `{"gateway":{"auth":{"token":"stale"}},"agents":{"defaults":{"model":{"primary":"openai/gpt-4o"}}}}`)
+	writeFile(t, filepath.Join(configDir, "moltbot.json"), `{
+  "gateway": {"token": "legacy-token", "port": 18790},
+  "agent": {"model": "anthropic/claude-sonnet-4"},
+  "channels": {"telegram": {"enabled": true, "botToken": "${TELEGRAM_BOT_TOKEN}"}},
+  "plugins": {"entries": {"memory": {"enabled": true}}}
+}`)
+
+	report, err := Migrate(MigrateOptions{ConfigDir: configDir})
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if filepath.Base(report.Source) != "moltbot.json" {
+		t.Errorf("source = %s, want moltbot.json ahead of openclaw.json", report.Source)
+	}
+	if !reflect.DeepEqual(report.Kept, []string{"channels", "plugins"}) {
+		t.Errorf("kept = %v, want channels and plugins", report.Kept)
+	}
+	if len(report.Dropped) != 0 {
+		t.Errorf("dropped = %v, want none", report.Dropped)
+	}
+
+	var cfg map[string]interface{}
+	if err := json.Unmarshal([]byte(readFile(t, filepath.Join(configDir, "openclaw.json"))), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	channels, _ := json.Marshal(cfg["channels"])
+	if string(channels) != `{"telegram":{"botToken":"${TELEGRAM_BOT_TOKEN}","enabled":true}}` {
+		t.Errorf("channels = %s, want them carried over", channels)
+	}
+	if cfg["plugins"] == nil {
+		t.Error("plugins were dropped")
+	}
+	gateway := cfg["gateway"].(map[string]interface{})
+	if token := gateway["auth"].(map[string]interface{})["token"]; token != "legacy-token" {
+		t.Errorf("gateway.auth.token = %v, want the legacy token", token)
+	}
+}
+
+func TestMigrateLeavesCurrentConfigAlone(t *testing.T) {
+	configDir := t.TempDir()
+	current := `{"gateway":{"auth":{"token":"t"},"tls":{"enabled":true}},"agents":{"defaults":{"model":{"primary":"openai/gpt-4o","fallbacks":["openai/gpt-4o-mini"]}}}}`
+	configPath := filepath.Join(configDir, "openclaw.json")
+	writeFile(t, configPath, current)
+
+	if _, err := Migrate(MigrateOptions{ConfigDir: configDir}); err == nil || !strings.Contains(err.Error(), "already current") {
+		t.Errorf("err = %v, want an already current error", err)
+	}
+
+	writeFile(t, filepath.Join(configDir, ".env"), "CLAWDBOT_GATEWAY_TOKEN=t\n")
+	report, err := Migrate(MigrateOptions{ConfigDir: configDir})
+	if err != nil {
+		t.Fatalf("Migrate with legacy env keys: %v", err)
+	}
+	if readFile(t, configPath) != current {
+		t.Error("a current openclaw.json was rewritten")
+	}
+	if len(report.Renamed) != 1 || !strings.HasSuffix(report.Renamed[0].To, ":OPENCLAW_GATEWAY_TOKEN") {
+		t.Errorf("renamed = %v, want only the env key", report.Renamed)
+	}
+}
+
+func TestMigrateWritesNothingWhenTokenIsMissing(t *testing.T) {
+	configDir := t.TempDir()
+	writeFile(t, filepath.Join(configDir, "clawdbot.json"), `{"agent":{"model":"openai/gpt-4o"}}`)
+	env := "CLAWDBOT_LOG_LEVEL=debug\n"
+	writeFile(t, filepath.Join(configDir, ".env"), env)
+
+	if _, err := Migrate(MigrateOptions{ConfigDir: configDir}); err == nil || !strings.Contains(err.Error(), "gateway token") {
+		t.Fatalf("err = %v, want a missing token error", err)
+	}
+	if got := readFile(t, filepath.Join(configDir, ".env")); got != env {
+		t.Errorf(".env was rewritten before the token check:\n%s", got)
+	}
+	entries, err := os.ReadDir(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "clawdbot.json" && entry.Name() != ".env" {
+			t.Errorf("unexpected file %s after a failed migration", entry.Name())
+		}
+	}
+}
+
+func TestBackupFileNamesAreUnique(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openclaw.json")
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		writeFile(t, path, strings.Repeat("x", i+1))
+		backup, err := backupFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[backup] {
+			t.Fatalf("backup %s was reused", backup)
+		}
+		seen[backup] = true
+		if got := readFile(t, backup); got != strings.Repeat("x", i+1) {
+			t.Errorf("backup %s = %q, want the content at that time", backup, got)
+		}
+	}
+}
+
+func TestMigrateTwiceKeepsTheMigratedConfig(t *testing.T) {
+	configDir := t.TempDir()
+	legacy := filepath.Join(configDir, "clawdbot.json")
+	writeFile(t, legacy, `{"gateway":{"token":"legacy-token"},"agent":{"model":"anthropic/claude-sonnet-4"}}`)
+
+	report, err := Migrate(MigrateOptions{ConfigDir: configDir})
+	if err != nil {
+		t.Fatalf("first Migrate: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("clawdbot.json still exists after migrating: %v", err)
+	}
+	retired := report.Backups[len(report.Backups)-1]
+	if !strings.HasPrefix(filepath.Base(retired), "clawdbot.json.migrated-") || readFile(t, retired) == "" {
+		t.Errorf("backups = %v, want the renamed legacy file last", report.Backups)
+	}
+
+	// The user edits the migrated config; a second run must not replace it
+	// with a fresh conversion of the legacy file.
+	configPath := filepath.Join(configDir, "openclaw.json")
+	edited := strings.Replace(readFile(t, configPath), "anthropic/claude-sonnet-4", "openai/gpt-4o", 1)
+	writeFile(t, configPath, edited)
+	if _, err := Migrate(MigrateOptions{ConfigDir: configDir}); err == nil || !strings.Contains(err.Error(), "already current") {
+		t.Errorf("second Migrate err = %v, want an already current error", err)
+	}
+	if readFile(t, configPath) != edited {
+		t.Error("the second run rewrote openclaw.json")
+	}
+}
+
+func TestMigrateReportsUnknownModelFieldsAsDropped(t *testing.T) {
+	configDir := t.TempDir()
+	writeFile(t, filepath.Join(configDir, "moltbot.json"), `{
+  "gateway": {"token": "legacy-token"},
+  "agent": {"model": "vllm/qwen"},
+  "models": {"providers": {"vllm": {
+    "baseUrl": "http://10.0.0.2:8000/v1",
+    "headers": {"X-Team": "a"},
+    "models": [{"id": "qwen", "name": "Qwen", "reasoning": false, "input": ["text"], "contextWindow": 32768, "maxTokens": 4096, "cost": {"input": 0}}]
+  }}}
+}`)
+
+	report, err := Migrate(MigrateOptions{ConfigDir: configDir})
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	want := []string{"models.providers.vllm.headers.X-Team", "models.providers.vllm.models[0].cost.input"}
+	if !reflect.DeepEqual(report.Dropped, want) {
+		t.Errorf("dropped = %v, want %v", report.Dropped, want)
+	}
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ownedPaths are the openclaw.json keys the writer manages. A key on this
+// list that the rendered config leaves out was removed on purpose, so the
+// base's value is dropped too. "*" matches any one key.
+var ownedPaths = []string{
+	"agents.defaults.model.primary",
+	"agents.defaults.model.fallbacks",
+	"channels",
+	"models.mode",
+	"models.providers.*",
+	"models.providers.*.apiKey",
+	"models.providers.*.baseUrl",
+	"models.providers.*.api",
+	"models.providers.*.models",
+}
+
+// verbatimPaths are written as rendered, without merging the base into
+// them: channels always come whole from WriteOptions.Channels.
+var verbatimPaths = []string{"channels"}
+
+// modelListPath holds the model entries of a provider block. An entry the
+// base already has under the same id is kept as it is, since it may carry
+// a context window or other fields the writer only fills with defaults.
+const modelListPath = "models.providers.*.models"
+
+// overlayConfig writes rendered over base, the openclaw.json the write
+// started from. Objects are merged key by key: rendered keys come first and
+// win, then the base's other keys follow in their order unless the writer
+// owns them. Unknown keys such as plugins, provider headers or extra
+// gateway settings survive a save that does not know about them.
+func overlayConfig(rendered, base []byte) ([]byte, error) {
+	merged, err := overlayValue(nil, rendered, base)
+	if err != nil {
+		return nil, fmt.Errorf("merge openclaw.json: %w", err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, merged, "", "  "); err != nil {
+		return nil, fmt.Errorf("merge openclaw.json: %w", err)
+	}
+	if errs := ValidateConfig(indented.Bytes()); len(errs) > 0 {
+		return nil, errs
+	}
+	return indented.Bytes(), nil
+}
+
+func overlayValue(path []string, rendered, base json.RawMessage) (json.RawMessage, error) {
+	if matchPath(path, modelListPath) {
+		return overlayModelList(rendered, base)
+	}
+	for _, pattern := range verbatimPaths {
+		if matchPath(path, pattern) {
+			return rendered, nil
+		}
+	}
+	renderedObj, ok := parseObject(rendered)
+	if !ok {
+		return rendered, nil
+	}
+	baseObj, ok := parseObject(base)
+	if !ok {
+		return rendered, nil
+	}
+	out := orderedObject{values: make(map[string]json.RawMessage)}
+	for _, key := range renderedObj.keys {
+		value := renderedObj.values[key]
+		if baseValue, ok := baseObj.values[key]; ok {
+			var err error
+			value, err = overlayValue(append(path, key), value, baseValue)
+			if err != nil {
+				return nil, err
+			}
+		}
+		out.set(key, value)
+	}
+	for _, key := range baseObj.keys {
+		if _, ok := renderedObj.values[key]; ok || isOwned(append(path, key)) {
+			continue
+		}
+		out.set(key, baseObj.values[key])
+	}
+	return out.marshal()
+}
+
+// overlayModelList keeps the rendered entries and their order, taking the
+// base's entry for every id it already declares.
+func overlayModelList(rendered, base json.RawMessage) (json.RawMessage, error) {
+	var renderedEntries, baseEntries []json.RawMessage
+	if json.Unmarshal(rendered, &renderedEntries) != nil || json.Unmarshal(base, &baseEntries) != nil {
+		return rendered, nil
+	}
+	byID := make(map[string]json.RawMessage, len(baseEntries))
+	for _, entry := range baseEntries {
+		if id := modelEntryID(entry); id != "" {
+			byID[id] = entry
+		}
+	}
+	for i, entry := range renderedEntries {
+		if kept, ok := byID[modelEntryID(entry)]; ok {
+			renderedEntries[i] = kept
+		}
+	}
+	return json.Marshal(renderedEntries)
+}
+
+func modelEntryID(entry json.RawMessage) string {
+	var head struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(entry, &head) != nil {
+		return ""
+	}
+	return head.ID
+}
+
+func isOwned(path []string) bool {
+	for _, pattern := range ownedPaths {
+		if matchPath(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(path []string, pattern string) bool {
+	parts := strings.Split(pattern, ".")
+	if len(parts) != len(path) {
+		return false
+	}
+	for i, part := range parts {
+		if part != "*" && part != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// orderedObject is a JSON object that keeps its key order.
+type orderedObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+func (o *orderedObject) set(key string, value json.RawMessage) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o orderedObject) marshal() (json.RawMessage, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(o.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// parseObject reads raw as a JSON object, or reports false when it is
+// anything else.
+func parseObject(raw json.RawMessage) (orderedObject, bool) {
+	obj := orderedObject{values: make(map[string]json.RawMessage)}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return obj, false
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return obj, false
+		}
+		key, ok := token.(string)
+		if !ok {
+			return obj, false
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return obj, false
+		}
+		obj.set(key, value)
+	}
+	return obj, true
+}
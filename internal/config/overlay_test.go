@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOverlayValue(t *testing.T) {
+	cases := []struct {
+		name     string
+		rendered string
+		base     string
+		want     string
+	}{
+		{
+			name:     "unknown keys follow the rendered ones",
+			rendered: `{"gateway":{"port":18789}}`,
+			base:     `{"plugins":{"x":1},"gateway":{"bind":"lan","port":1}}`,
+			want:     `{"gateway":{"port":18789,"bind":"lan"},"plugins":{"x":1}}`,
+		},
+		{
+			name:     "owned keys left out are removed",
+			rendered: `{"agents":{"defaults":{"model":{"primary":"openai/gpt-4o"}}}}`,
+			base:     `{"agents":{"defaults":{"model":{"primary":"a/b","fallbacks":["a/c"]},"workspace":"/w"}}}`,
+			want:     `{"agents":{"defaults":{"model":{"primary":"openai/gpt-4o"},"workspace":"/w"}}}`,
+		},
+		{
+			name:     "removed providers are dropped with their unknown fields",
+			rendered: `{"models":{"providers":{"ollama":{"baseUrl":"http://new"}}}}`,
+			base:     `{"models":{"providers":{"ollama":{"baseUrl":"http://old","headers":{"X":"1"}},"vllm":{"baseUrl":"http://v"}}}}`,
+			want:     `{"models":{"providers":{"ollama":{"baseUrl":"http://new","headers":{"X":"1"}}}}}`,
+		},
+		{
+			name:     "model entries already on disk win by id",
+			rendered: `{"models":{"providers":{"ollama":{"models":[{"id":"a","contextWindow":1},{"id":"b","contextWindow":1}]}}}}`,
+			base:     `{"models":{"providers":{"ollama":{"models":[{"id":"b","contextWindow":9,"reasoning":true},{"id":"c"}]}}}}`,
+			want:     `{"models":{"providers":{"ollama":{"models":[{"id":"a","contextWindow":1},{"id":"b","contextWindow":9,"reasoning":true}]}}}}`,
+		},
+		{
+			name:     "channels are written as rendered",
+			rendered: `{"channels":{"telegram":{"enabled":true}}}`,
+			base:     `{"channels":{"telegram":{"enabled":false,"botToken":"t"},"slack":{}}}`,
+			want:     `{"channels":{"telegram":{"enabled":true}}}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := overlayValue(nil, json.RawMessage(tc.rendered), json.RawMessage(tc.base))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got  %s\nwant %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	RegionIntl   = "intl"
+	RegionCN     = "cn"
+	RegionCustom = "custom"
+)
+
+type ProviderInfo struct {
+	ID            string
+	EnvKey        string
+	Api           string
+	DefaultRegion string
+	// Endpoints maps a region to the API base URL written to
+	// models.providers.<id>.baseUrl and used for listing models.
+	Endpoints map[string]string
+}
+
+var knownProviders = []ProviderInfo{
+	{ID: "openai", EnvKey: "OPENAI_API_KEY", Api: "openai-completions", DefaultRegion: RegionIntl, Endpoints: map[string]string{
+		RegionIntl: "https://api.openai.com/v1",
+	}},
+	{ID: "anthropic", EnvKey: "ANTHROPIC_API_KEY", Api: "anthropic-messages", DefaultRegion: RegionIntl, Endpoints: map[string]string{
+		RegionIntl: "https://api.anthropic.com",
+	}},
+	{ID: "gemini", EnvKey: "GEMINI_API_KEY", Api: "google-generative-ai", DefaultRegion: RegionIntl, Endpoints: map[string]string{
+		RegionIntl: "https://generativelanguage.googleapis.com/v1beta",
+	}},
+	{ID: "groq", EnvKey: "GROQ_API_KEY", Api: "openai-completions", DefaultRegion: RegionIntl, Endpoints: map[string]string{
+		RegionIntl: "https://api.groq.com/openai/v1",
+	}},
+	{ID: "mistral", EnvKey: "MISTRAL_API_KEY", Api: "openai-completions", DefaultRegion: RegionIntl, Endpoints: map[string]string{
+		RegionIntl: "https://api.mistral.ai/v1",
+	}},
+	{ID: "cohere", EnvKey: "COHERE_API_KEY", DefaultRegion: RegionIntl, Endpoints: map[string]string{
+		RegionIntl: "https://api.cohere.com",
+	}},
+	{ID: "minimax", EnvKey: "MINIMAX_API_KEY", Api: "openai-completions", DefaultRegion: RegionIntl, Endpoints: map[string]string{
+		RegionIntl: "https://api.minimax.io/v1",
+		RegionCN:   "https://api.minimaxi.com/v1",
+	}},
+	{ID: "deepseek", EnvKey: "DEEPSEEK_API_KEY", Api: "openai-completions", DefaultRegion: RegionIntl, Endpoints: map[string]string{
+		RegionIntl: "https://api.deepseek.com/v1",
+	}},
+	{ID: "moonshot", EnvKey: "MOONSHOT_API_KEY", Api: "openai-completions", DefaultRegion: RegionCN, Endpoints: map[string]string{
+		RegionIntl: "https://api.moonshot.ai/v1",
+		RegionCN:   "https://api.moonshot.cn/v1",
+	}},
+	{ID: "qwen", EnvKey: "QWEN_API_KEY", Api: "openai-completions", DefaultRegion: RegionCN, Endpoints: map[string]string{
+		RegionIntl: "https://dashscope-intl.aliyuncs.com/compatible-mode/v1",
+		RegionCN:   "https://dashscope.aliyuncs.com/compatible-mode/v1",
+	}},
+	{ID: "zai", EnvKey: "ZAI_API_KEY", Api: "openai-completions", DefaultRegion: RegionIntl, Endpoints: map[string]string{
+		RegionIntl: "https://api.z.ai/api/paas/v4",
+		RegionCN:   "https://open.bigmodel.cn/api/paas/v4",
+	}},
+	{ID: "ollama", Api: "openai-completions"},
+}
+
+// LookupProvider returns the registry entry for a provider id.
+func LookupProvider(id string) (ProviderInfo, bool) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	for _, provider := range knownProviders {
+		if provider.ID == id {
+			return provider, true
+		}
+	}
+	return ProviderInfo{}, false
+}
+
+// ResolveEndpoint picks the base URL for a provider. An empty region means
+// the provider's default; a custom URL always wins and implies the custom
+// region. Unknown providers only resolve with a custom URL.
+func ResolveEndpoint(providerID, region, customURL string) (string, string, error) {
+	region = strings.ToLower(strings.TrimSpace(region))
+	customURL = strings.TrimRight(strings.TrimSpace(customURL), "/")
+	if customURL != "" {
+		if err := checkBaseUrl(customURL); err != nil {
+			return "", "", fmt.Errorf("base url %w", err)
+		}
+		return customURL, RegionCustom, nil
+	}
+	if region == RegionCustom {
+		return "", "", fmt.Errorf("base url is required for the custom region")
+	}
+
+	provider, ok := LookupProvider(providerID)
+	if !ok {
+		return "", "", fmt.Errorf("unknown provider %s", providerID)
+	}
+	if len(provider.Endpoints) == 0 {
+		return "", "", fmt.Errorf("base url is required for provider %s", provider.ID)
+	}
+	if region == "" {
+		region = provider.DefaultRegion
+	}
+	endpoint, ok := provider.Endpoints[region]
+	if !ok {
+		return "", "", fmt.Errorf("provider %s has no %s endpoint (available: %s)", provider.ID, region, strings.Join(provider.Regions(), ", "))
+	}
+	return endpoint, region, nil
+}
+
+// Regions lists the preset regions of a provider in a stable order.
+func (p ProviderInfo) Regions() []string {
+	regions := make([]string, 0, len(p.Endpoints))
+	for region := range p.Endpoints {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// ProviderEnvKey is the env variable holding a provider's key: the
+// registry's, which is empty for keyless providers such as Ollama, or
+// <ID>_API_KEY for providers outside it.
+func ProviderEnvKey(providerID string) string {
+	if info, ok := LookupProvider(providerID); ok {
+		return info.EnvKey
+	}
+	return strings.ToUpper(strings.ReplaceAll(providerID, "-", "_")) + "_API_KEY"
+}
+
+// ProviderIDForEnvKey maps an env key such as OPENAI_API_KEY back to the
+// provider id used in model references. Custom keys follow the same
+// <ID>_API_KEY convention.
+func ProviderIDForEnvKey(key string) string {
+	key = strings.TrimSpace(key)
+	for _, provider := range knownProviders {
+		if provider.EnvKey != "" && provider.EnvKey == key {
+			return provider.ID
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(key, "_API_KEY"))
+}
+
+// StateDir is where the setup tool keeps its own files (caches, logs) inside
+// the compose dir, away from the config mounted into the container.
+func StateDir(composeDir string) string {
+	return filepath.Join(composeDir, ".openclaw-setup")
+}
+
+// ConfiguredProvider is a provider as stored. Region, BaseUrl and Api are
+// read back like CurrentWriteOptions does: a base URL of a region preset
+// becomes the region, and a dialect the registry implies is left empty.
+type ConfiguredProvider struct {
+	ID      string
+	EnvKey  string
+	ApiKey  string
+	Region  string
+	BaseUrl string
+	Api     string
+}
+
+// ConfiguredProviders lists the providers set up in configDir: every
+// <ID>_API_KEY in the managed .env plus every models.providers entry in
+// openclaw.json.
+func ConfiguredProviders(configDir string) ([]ConfiguredProvider, error) {
+	byID := make(map[string]*ConfiguredProvider)
+	var order []string
+	get := func(id string) *ConfiguredProvider {
+		if byID[id] == nil {
+			byID[id] = &ConfiguredProvider{ID: id}
+			order = append(order, id)
+		}
+		return byID[id]
+	}
+
+	envContent, err := os.ReadFile(filepath.Join(configDir, ".env"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read env: %w", err)
+	}
+	for _, line := range strings.Split(string(envContent), "\n") {
+		key, value, ok := splitEnvLine(line)
+		if !ok || !strings.HasSuffix(key, "_API_KEY") || value == "" {
+			continue
+		}
+		provider := get(ProviderIDForEnvKey(key))
+		provider.EnvKey = key
+		provider.ApiKey = value
+	}
+
+	configContent, err := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if len(configContent) > 0 {
+		var cfg openclawConfig
+		if err := json.Unmarshal(configContent, &cfg); err != nil {
+			return nil, fmt.Errorf("parse openclaw.json: %w", err)
+		}
+		if cfg.Models != nil {
+			for id, entry := range cfg.Models.Providers {
+				provider := get(id)
+				provider.BaseUrl, provider.Region, provider.Api = currentEndpoint(id, entry)
+				if provider.ApiKey == "" && !isEnvReference(entry.ApiKey) {
+					provider.ApiKey = entry.ApiKey
+				}
+			}
+		}
+	}
+
+	sort.Strings(order)
+	providers := make([]ConfiguredProvider, 0, len(order))
+	for _, id := range order {
+		providers = append(providers, *byID[id])
+	}
+	return providers, nil
+}
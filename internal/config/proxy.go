@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ProxySettings is the outbound proxy route that can be mirrored into the
+// gateway's .env so OpenClaw reaches providers the same way the setup
+// server does.
+type ProxySettings struct {
+	URL     string
+	NoProxy string
+}
+
+// ParseProxyURL checks that raw is an http, https, socks5 or socks5h proxy
+// URL with a host.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy url must use http, https, socks5 or socks5h, got %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", raw)
+	}
+	return parsed, nil
+}
+
+// envLines returns the proxy variables understood by most HTTP clients.
+// SOCKS proxies are also exported as ALL_PROXY since several clients only
+// look there for them.
+func (p *ProxySettings) envLines() []string {
+	if p == nil || strings.TrimSpace(p.URL) == "" {
+		return nil
+	}
+	proxyURL := strings.TrimSpace(p.URL)
+	lines := []string{
+		"HTTP_PROXY=" + proxyURL,
+		"HTTPS_PROXY=" + proxyURL,
+	}
+	if strings.HasPrefix(proxyURL, "socks5") {
+		lines = append(lines, "ALL_PROXY="+proxyURL)
+	}
+	if noProxy := strings.TrimSpace(p.NoProxy); noProxy != "" {
+		lines = append(lines, "NO_PROXY="+noProxy)
+	}
+	return lines
+}
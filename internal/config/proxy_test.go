@@ -0,0 +1,46 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProxyURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"http://proxy.lan:3128":       true,
+		" https://u:p@proxy.lan:443 ": true,
+		"socks5://127.0.0.1:1080":     true,
+		"socks5h://proxy.lan:1080":    true,
+		"ftp://proxy.lan":             false,
+		"proxy.lan:3128":              false,
+		"http://":                     false,
+		"http://proxy lan:3128":       false,
+	} {
+		if _, err := ParseProxyURL(raw); (err == nil) != ok {
+			t.Errorf("ParseProxyURL(%q): err = %v, want ok = %v", raw, err, ok)
+		}
+	}
+}
+
+func TestProxyEnvLines(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings *ProxySettings
+		want     []string
+	}{
+		{"none", nil, nil},
+		{"empty", &ProxySettings{URL: " "}, nil},
+		{"http", &ProxySettings{URL: "http://proxy.lan:3128"}, []string{"HTTP_PROXY=http://proxy.lan:3128", "HTTPS_PROXY=http://proxy.lan:3128"}},
+		{"socks with no proxy", &ProxySettings{URL: "socks5://proxy.lan:1080", NoProxy: " localhost,10.0.0.0/8 "}, []string{
+			"HTTP_PROXY=socks5://proxy.lan:1080",
+			"HTTPS_PROXY=socks5://proxy.lan:1080",
+			"ALL_PROXY=socks5://proxy.lan:1080",
+			"NO_PROXY=localhost,10.0.0.0/8",
+		}},
+	}
+	for _, tc := range cases {
+		if got := tc.settings.envLines(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minSecretLength keeps short placeholders such as "ollama" from being
+// treated as secrets and scrubbed from every message.
+const minSecretLength = 8
+
+// credentialPatterns catch values shaped like credentials even when they
+// were never registered: key-like query parameters, bearer tokens and the
+// well-known key prefixes of the major providers.
+var credentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)([?&](?:key|api_key|apikey|access_token|token)=)[^&\s"'<]+`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]{8,}`),
+	regexp.MustCompile(`()\bsk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`()\bAIza[0-9A-Za-z_-]{30,}`),
+}
+
+// SecretSet collects secret values seen at runtime and scrubs them, along
+// with anything that looks like a credential, from text before it is
+// logged or returned to a client. It is safe for concurrent use.
+type SecretSet struct {
+	mu     sync.RWMutex
+	values map[string]struct{}
+	sorted []string
+	parent *SecretSet
+}
+
+// Secrets is the process-wide set used by the server and the CLI. It only
+// holds values the operator supplied, such as those read from the config
+// dir; values sent by a client go to a Scoped set.
+var Secrets = NewSecretSet()
+
+func NewSecretSet() *SecretSet {
+	return &SecretSet{values: make(map[string]struct{})}
+}
+
+// Scoped returns a set that redacts its own values as well as those of s.
+// Values added to it never reach s, so a request can register what its
+// client sent without scrubbing those strings from every other response.
+func (s *SecretSet) Scoped() *SecretSet {
+	scoped := NewSecretSet()
+	scoped.parent = s
+	return scoped
+}
+
+// Add registers secret values. Blank, short and ${VAR} values are ignored.
+func (s *SecretSet) Add(values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if len(value) < minSecretLength || isEnvReference(value) {
+			continue
+		}
+		if _, ok := s.values[value]; ok {
+			continue
+		}
+		s.values[value] = struct{}{}
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	// A new slice, so a snapshot taken by Redact is never modified.
+	sorted := make([]string, 0, len(s.values))
+	for value := range s.values {
+		sorted = append(sorted, value)
+	}
+	sortLongestFirst(sorted)
+	s.sorted = sorted
+}
+
+// snapshot returns the values of s and its parents, longest first so a
+// secret containing another is replaced whole.
+func (s *SecretSet) snapshot() []string {
+	s.mu.RLock()
+	values := s.sorted
+	s.mu.RUnlock()
+	if s.parent == nil {
+		return values
+	}
+	merged := append(append([]string(nil), values...), s.parent.snapshot()...)
+	sortLongestFirst(merged)
+	return merged
+}
+
+func sortLongestFirst(values []string) {
+	sort.SliceStable(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+}
+
+// AddFromConfigDir registers the secrets stored in configDir: every
+// secret-like variable of the managed .env and every secret-like string in
+// openclaw.json.
+func (s *SecretSet) AddFromConfigDir(configDir string) {
+	if content, err := os.ReadFile(filepath.Join(configDir, ".env")); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			if key, value, ok := splitEnvLine(line); ok && secretKeyPattern.MatchString(key) {
+				s.Add(value)
+			}
+		}
+	}
+	if content, err := os.ReadFile(filepath.Join(configDir, "openclaw.json")); err == nil {
+		var doc interface{}
+		if json.Unmarshal(content, &doc) == nil {
+			s.addFromJSON("", doc)
+		}
+	}
+}
+
+func (s *SecretSet) addFromJSON(key string, value interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for childKey, child := range typed {
+			s.addFromJSON(childKey, child)
+		}
+	case []interface{}:
+		for _, child := range typed {
+			s.addFromJSON(key, child)
+		}
+	case string:
+		if secretKeyPattern.MatchString(key) {
+			s.Add(typed)
+		}
+	}
+}
+
+// Redact replaces registered secrets with their fingerprint and masks
+// credential-shaped substrings.
+func (s *SecretSet) Redact(text string) string {
+	if text == "" {
+		return text
+	}
+	for _, value := range s.snapshot() {
+		if strings.Contains(text, value) {
+			text = strings.ReplaceAll(text, value, redactValue(value))
+		}
+	}
+	for _, pattern := range credentialPatterns {
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			prefix := pattern.FindStringSubmatch(match)[1]
+			return prefix + redactValue(strings.TrimPrefix(match, prefix))
+		})
+	}
+	return text
+}
+
+// Writer wraps w so everything written through it is redacted first. It
+// is meant for line-oriented output such as the standard logger.
+func (s *SecretSet) Writer(w io.Writer) io.Writer {
+	return redactingWriter{set: s, w: w}
+}
+
+type redactingWriter struct {
+	set *SecretSet
+	w   io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, r.set.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
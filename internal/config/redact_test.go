@@ -0,0 +1,28 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScopedSecretsStayInTheirScope(t *testing.T) {
+	global := NewSecretSet()
+	global.Add("config-dir-secret-value")
+	scoped := global.Scoped()
+	scoped.Add("client-sent-secret", "config-dir")
+
+	text := "config-dir-secret-value client-sent-secret"
+	got := scoped.Redact(text)
+	if strings.Contains(got, "secret") {
+		t.Errorf("scoped Redact = %q, want both values replaced", got)
+	}
+	if got != global.Redact("config-dir-secret-value")+" "+scoped.Redact("client-sent-secret") {
+		t.Errorf("scoped Redact = %q, want each value replaced whole", got)
+	}
+	if got := global.Redact(text); !strings.Contains(got, "client-sent-secret") {
+		t.Errorf("global Redact = %q, want the scoped value left alone", got)
+	}
+	if got := global.Scoped().Redact("client-sent-secret"); got != "client-sent-secret" {
+		t.Errorf("another scope redacted %q", got)
+	}
+}
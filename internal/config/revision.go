@@ -0,0 +1,82 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// revisionFiles are the files a revision covers, in hashing order.
+var revisionFiles = []string{"openclaw.json", ".env"}
+
+// ConfigSnapshot is the current configuration with secrets redacted, and
+// the revision it was read at.
+type ConfigSnapshot struct {
+	Revision string            `json:"revision"`
+	Config   json.RawMessage   `json:"config,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+}
+
+// ConfigRevision identifies the content of openclaw.json and .env in
+// configDir. Any change to either file, including creating or removing
+// it, changes the revision.
+func ConfigRevision(configDir string) (string, error) {
+	contents, err := readRevisionFiles(configDir)
+	if err != nil {
+		return "", err
+	}
+	return revisionOf(contents), nil
+}
+
+// ReadConfigSnapshot reads configDir once, so the redacted content and the
+// revision always match.
+func ReadConfigSnapshot(configDir string) (ConfigSnapshot, error) {
+	contents, err := readRevisionFiles(configDir)
+	if err != nil {
+		return ConfigSnapshot{}, err
+	}
+	snapshot := ConfigSnapshot{Revision: revisionOf(contents)}
+	if content := contents["openclaw.json"]; content != nil {
+		redacted := RedactContent("openclaw.json", content)
+		if json.Valid(redacted) {
+			snapshot.Config = redacted
+		}
+	}
+	if content := contents[".env"]; content != nil {
+		snapshot.Env = envValues(RedactContent(".env", content))
+	}
+	return snapshot, nil
+}
+
+func readRevisionFiles(configDir string) (map[string][]byte, error) {
+	contents := make(map[string][]byte, len(revisionFiles))
+	for _, name := range revisionFiles {
+		content, err := os.ReadFile(filepath.Join(configDir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		contents[name] = content
+	}
+	return contents, nil
+}
+
+func revisionOf(contents map[string][]byte) string {
+	hash := sha256.New()
+	for _, name := range revisionFiles {
+		content, ok := contents[name]
+		// The length prefix keeps a missing file distinct from an empty one.
+		if ok {
+			fmt.Fprintf(hash, "%s %d\n", name, len(content))
+			hash.Write(content)
+		} else {
+			fmt.Fprintf(hash, "%s -\n", name)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:12])
+}
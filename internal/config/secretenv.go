@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SecretSource is one place a secret can be read from, such as the process
+// environment or the compose .env. Each source may hold the secret itself
+// under NAME or a path to a file holding it under NAME_FILE, the convention
+// of Docker and Kubernetes secrets.
+type SecretSource struct {
+	Name   string
+	Lookup func(key string) (string, bool)
+	// BaseDir anchors relative NAME_FILE paths; empty means the working
+	// directory.
+	BaseDir string
+}
+
+// ProcessEnv is the process environment as a secret source.
+func ProcessEnv() SecretSource {
+	return SecretSource{Name: "environment", Lookup: os.LookupEnv}
+}
+
+// EnvFileSource wraps values parsed from an env file; relative NAME_FILE
+// paths are resolved against baseDir.
+func EnvFileSource(name string, values map[string]string, baseDir string) SecretSource {
+	return SecretSource{
+		Name: name,
+		Lookup: func(key string) (string, bool) {
+			value, ok := values[key]
+			return value, ok
+		},
+		BaseDir: baseDir,
+	}
+}
+
+// ResolveSecret reads the secret called name. Sources are tried in the
+// order given and the first one that sets NAME or NAME_FILE wins; within a
+// source, setting both is an error rather than a silent choice. A file
+// must hold a non-blank value, of which surrounding whitespace such as the
+// trailing newline is dropped. The value is registered with Secrets and
+// returned with a description of where it came from; all three results
+// are empty when no source sets it.
+func ResolveSecret(name string, sources ...SecretSource) (value, origin string, err error) {
+	fileKey := name + "_FILE"
+	for _, source := range sources {
+		value, _ := source.Lookup(name)
+		value = strings.TrimSpace(value)
+		path, _ := source.Lookup(fileKey)
+		path = strings.TrimSpace(path)
+
+		switch {
+		case value != "" && path != "":
+			return "", "", fmt.Errorf("%s and %s are both set in the %s; set only one", name, fileKey, source.Name)
+		case value != "":
+			Secrets.Add(value)
+			return value, fmt.Sprintf("%s %s", source.Name, name), nil
+		case path != "":
+			if !filepath.IsAbs(path) && source.BaseDir != "" {
+				path = filepath.Join(source.BaseDir, path)
+			}
+			value, err := readSecretFile(fileKey, path)
+			if err != nil {
+				return "", "", err
+			}
+			Secrets.Add(value)
+			return value, fmt.Sprintf("%s %s (%s)", source.Name, fileKey, path), nil
+		}
+	}
+	return "", "", nil
+}
+
+func readSecretFile(key, path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: read %s: %w", key, path, err)
+	}
+	if len(content) == 0 {
+		return "", fmt.Errorf("%s: %s is empty", key, path)
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return "", fmt.Errorf("%s: %s contains only whitespace", key, path)
+	}
+	return value, nil
+}
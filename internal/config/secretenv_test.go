@@ -0,0 +1,123 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"key":       "sk-from-file-0001\n",
+		"empty":     "",
+		"blank":     " \n\t\n",
+		"padded":    "  sk-padded-0001  \r\n",
+		"two-lines": "sk-first\nsk-second\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name       string
+		sources    []SecretSource
+		want       string
+		wantOrigin string
+		wantErr    string
+	}{
+		{
+			name:       "value",
+			sources:    []SecretSource{EnvFileSource("environment", map[string]string{"API_KEY": " sk-value-0001 "}, "")},
+			want:       "sk-value-0001",
+			wantOrigin: "environment API_KEY",
+		},
+		{
+			name:       "file relative to the source",
+			sources:    []SecretSource{EnvFileSource("compose .env", map[string]string{"API_KEY_FILE": "key"}, dir)},
+			want:       "sk-from-file-0001",
+			wantOrigin: "compose .env API_KEY_FILE (" + filepath.Join(dir, "key") + ")",
+		},
+		{
+			name:    "padded file",
+			sources: []SecretSource{EnvFileSource("environment", map[string]string{"API_KEY_FILE": filepath.Join(dir, "padded")}, "")},
+			want:    "sk-padded-0001",
+		},
+		{
+			name:    "inner newlines are kept",
+			sources: []SecretSource{EnvFileSource("environment", map[string]string{"API_KEY_FILE": filepath.Join(dir, "two-lines")}, "")},
+			want:    "sk-first\nsk-second",
+		},
+		{
+			name:    "empty file",
+			sources: []SecretSource{EnvFileSource("environment", map[string]string{"API_KEY_FILE": filepath.Join(dir, "empty")}, "")},
+			wantErr: "is empty",
+		},
+		{
+			name:    "whitespace-only file",
+			sources: []SecretSource{EnvFileSource("environment", map[string]string{"API_KEY_FILE": filepath.Join(dir, "blank")}, "")},
+			wantErr: "contains only whitespace",
+		},
+		{
+			name:    "missing file",
+			sources: []SecretSource{EnvFileSource("environment", map[string]string{"API_KEY_FILE": filepath.Join(dir, "missing")}, "")},
+			wantErr: "API_KEY_FILE: read",
+		},
+		{
+			name:    "both set in one source",
+			sources: []SecretSource{EnvFileSource("environment", map[string]string{"API_KEY": "sk-value-0001", "API_KEY_FILE": "key"}, dir)},
+			wantErr: "API_KEY and API_KEY_FILE are both set in the environment",
+		},
+		{
+			name: "first source wins",
+			sources: []SecretSource{
+				EnvFileSource("environment", map[string]string{"API_KEY_FILE": "key"}, dir),
+				EnvFileSource("compose .env", map[string]string{"API_KEY": "sk-compose-0001"}, ""),
+			},
+			want:       "sk-from-file-0001",
+			wantOrigin: "environment API_KEY_FILE (" + filepath.Join(dir, "key") + ")",
+		},
+		{
+			name: "blank value falls through",
+			sources: []SecretSource{
+				EnvFileSource("environment", map[string]string{"API_KEY": "  ", "API_KEY_FILE": ""}, ""),
+				EnvFileSource("compose .env", map[string]string{"API_KEY": "sk-compose-0001"}, ""),
+			},
+			want:       "sk-compose-0001",
+			wantOrigin: "compose .env API_KEY",
+		},
+		{
+			name:    "unset",
+			sources: []SecretSource{EnvFileSource("environment", nil, "")},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, origin, err := ResolveSecret("API_KEY", tc.sources...)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want it to mention %q", err, tc.wantErr)
+				}
+				if value != "" || origin != "" {
+					t.Errorf("value %q, origin %q returned with the error", value, origin)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != tc.want {
+				t.Errorf("value = %q, want %q", value, tc.want)
+			}
+			if tc.wantOrigin != "" && origin != tc.wantOrigin {
+				t.Errorf("origin = %q, want %q", origin, tc.wantOrigin)
+			}
+			if value != "" && Secrets.Redact(value) == value {
+				t.Error("the secret was not registered for redaction")
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DesiredState describes a whole OpenClaw setup in one JSON or YAML file,
+// for the plan and apply commands. A provider apiKey, the gateway token
+// and env values of the form ${NAME} are read from NAME or NAME_FILE in the
+// process environment, so the file itself can be kept free of secrets.
+// Channels are written as given; their ${NAME} references are resolved by
+// the gateway from data/conf/.env.
+type DesiredState struct {
+	Model     string            `json:"model"`
+	Fallbacks []string          `json:"fallbacks,omitempty"`
+	Providers []StateProvider   `json:"providers"`
+	Gateway   StateGateway      `json:"gateway"`
+	Channels  json.RawMessage   `json:"channels,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// StateProvider is one provider of a DesiredState. EnvKey defaults to the
+// registry's variable, or <ID>_API_KEY for custom providers.
+type StateProvider struct {
+	ID      string   `json:"id"`
+	ApiKey  string   `json:"apiKey,omitempty"`
+	EnvKey  string   `json:"envKey,omitempty"`
+	Region  string   `json:"region,omitempty"`
+	BaseUrl string   `json:"baseUrl,omitempty"`
+	Api     string   `json:"api,omitempty"`
+	Models  []string `json:"models,omitempty"`
+}
+
+// StateGateway overrides the gateway defaults. Without a token the one
+// already in use is kept.
+type StateGateway struct {
+	Mode              string `json:"mode,omitempty"`
+	Bind              string `json:"bind,omitempty"`
+	Port              int    `json:"port,omitempty"`
+	Token             string `json:"token,omitempty"`
+	AllowInsecureAuth *bool  `json:"allowInsecureAuth,omitempty"`
+}
+
+var (
+	stateReferencePattern = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+	envNamePattern        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// LoadDesiredState reads a state file, as YAML when it is named .yaml or
+// .yml and as JSON otherwise. Unknown fields are rejected so a misspelled
+// key fails instead of being silently ignored.
+func LoadDesiredState(path string) (DesiredState, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return DesiredState{}, fmt.Errorf("read state: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// YAML is converted to JSON so both formats share the JSON field
+		// names and the strict decoding below.
+		if content, err = yamlToJSON(content); err != nil {
+			return DesiredState{}, fmt.Errorf("parse state %s: %w", path, err)
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	var state DesiredState
+	if err := decoder.Decode(&state); err != nil {
+		return DesiredState{}, fmt.Errorf("parse state %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, keeping the order of
+// mapping keys so that channels come out as written.
+func yamlToJSON(content []byte) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeYAMLNode(&buf, &document); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeYAMLNode(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeYAMLNode(buf, node.Content[0])
+	case yaml.AliasNode:
+		return writeYAMLNode(buf, node.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: mapping keys must be strings", key.Line)
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(key.Value)
+			buf.Write(name)
+			buf.WriteByte(':')
+			if err := writeYAMLNode(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeYAMLNode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		buf.Write(encoded)
+	}
+	return nil
+}
+
+// WriteOptions resolves the state into options for the writer, based on
+// the openclaw.json in configDir. The gateway token is left empty when the
+// state does not set one, for the caller to fill in.
+func (s DesiredState) WriteOptions(configDir string) (WriteOptions, error) {
+	opts := WriteOptions{
+		ConfigDir: configDir,
+		Model:     strings.TrimSpace(s.Model),
+		Fallbacks: s.Fallbacks,
+		Gateway: GatewaySettings{
+			Mode:              s.Gateway.Mode,
+			Bind:              s.Gateway.Bind,
+			Port:              s.Gateway.Port,
+			AllowInsecureAuth: s.Gateway.AllowInsecureAuth,
+		},
+		Channels: s.Channels,
+	}
+	if opts.Model == "" {
+		return WriteOptions{}, fmt.Errorf("state: model is required")
+	}
+
+	token, err := resolveStateValue("gateway.token", s.Gateway.Token)
+	if err != nil {
+		return WriteOptions{}, err
+	}
+	Secrets.Add(token)
+	opts.GatewayToken = token
+
+	// Every variable may only be written once to the generated .env.
+	envOwners := map[string]string{"OPENCLAW_GATEWAY_TOKEN": "the gateway token"}
+	seen := make(map[string]bool)
+	for i, provider := range s.Providers {
+		id := strings.ToLower(strings.TrimSpace(provider.ID))
+		field := fmt.Sprintf("providers[%d]", i)
+		if id == "" {
+			return WriteOptions{}, fmt.Errorf("state: %s: id is required", field)
+		}
+		if seen[id] {
+			return WriteOptions{}, fmt.Errorf("state: provider %s is listed twice", id)
+		}
+		seen[id] = true
+
+		apiKey, err := resolveStateValue(field+".apiKey", provider.ApiKey)
+		if err != nil {
+			return WriteOptions{}, err
+		}
+		Secrets.Add(apiKey)
+		envKey := strings.TrimSpace(provider.EnvKey)
+		if envKey == "" {
+			envKey = ProviderEnvKey(id)
+		}
+		if info, known := LookupProvider(id); known && info.EnvKey != "" && apiKey == "" {
+			return WriteOptions{}, fmt.Errorf("state: provider %s: apiKey is required", id)
+		}
+		if apiKey != "" {
+			if !envNamePattern.MatchString(envKey) {
+				return WriteOptions{}, fmt.Errorf("state: provider %s: invalid envKey %q", id, envKey)
+			}
+			if owner, taken := envOwners[envKey]; taken {
+				return WriteOptions{}, fmt.Errorf("state: provider %s: %s is already used by %s", id, envKey, owner)
+			}
+			envOwners[envKey] = "provider " + id
+		}
+
+		opts.Providers = append(opts.Providers, ProviderKey{
+			Key:      envKey,
+			Value:    apiKey,
+			Provider: id,
+			Region:   provider.Region,
+			BaseUrl:  provider.BaseUrl,
+			Api:      provider.Api,
+			Models:   provider.Models,
+		})
+	}
+
+	if len(s.Env) > 0 {
+		opts.Env = make(map[string]string, len(s.Env))
+		for key, raw := range s.Env {
+			if !envNamePattern.MatchString(key) {
+				return WriteOptions{}, fmt.Errorf("state: env: invalid name %q", key)
+			}
+			if owner, taken := envOwners[key]; taken {
+				return WriteOptions{}, fmt.Errorf("state: env: %s is already used by %s", key, owner)
+			}
+			// <ID>_API_KEY variables are read back as provider keys.
+			if strings.HasSuffix(key, "_API_KEY") {
+				return WriteOptions{}, fmt.Errorf("state: env: %s looks like a provider key; declare the provider instead", key)
+			}
+			value, err := resolveStateValue("env."+key, raw)
+			if err != nil {
+				return WriteOptions{}, err
+			}
+			if secretKeyPattern.MatchString(key) {
+				Secrets.Add(value)
+			}
+			opts.Env[key] = value
+		}
+	}
+
+	// The state owns what the writer manages; anything else in
+	// openclaw.json, such as plugins, is kept.
+	base, err := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return WriteOptions{}, fmt.Errorf("read config: %w", err)
+	}
+	opts.Base = base
+	return opts, nil
+}
+
+// resolveStateValue returns value, or the secret it references as ${NAME}.
+// A reference that is not set is an error rather than an empty value.
+func resolveStateValue(field, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	match := stateReferencePattern.FindStringSubmatch(value)
+	if match == nil {
+		return value, nil
+	}
+	resolved, _, err := ResolveSecret(match[1], ProcessEnv())
+	if err != nil {
+		return "", fmt.Errorf("state: %s: %w", field, err)
+	}
+	if resolved == "" {
+		return "", fmt.Errorf("state: %s: %s or %s_FILE is not set", field, match[1], match[1])
+	}
+	return resolved, nil
+}
@@ -0,0 +1,289 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const gatewayTokenBytes = 24
+
+// gatewayTokenKeys are the compose .env keys holding the gateway token, the
+// current name first.
+var gatewayTokenKeys = []string{"OPENCLAW_GATEWAY_TOKEN", "CLAWDBOT_GATEWAY_TOKEN"}
+
+// GenerateGatewayToken returns a new random token. It fails rather than
+// return an empty token when the system random source is unavailable.
+func GenerateGatewayToken() (string, error) {
+	bytes := make([]byte, gatewayTokenBytes)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("generate gateway token: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// ExistingGatewayToken returns the token already in use and where it was
+// found: the compose .env (OPENCLAW_GATEWAY_TOKEN, then the legacy
+// CLAWDBOT_GATEWAY_TOKEN) wins over gateway.auth.token in openclaw.json,
+// because that is what docker compose hands to the gateway. Both are empty
+// when no token is set.
+func ExistingGatewayToken(composeDir string) (token, source string, err error) {
+	envPath := filepath.Join(composeDir, ".env")
+	envContent, err := os.ReadFile(envPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", fmt.Errorf("read .env: %w", err)
+	}
+	values := envValues(envContent)
+	for _, key := range gatewayTokenKeys {
+		if value := values[key]; value != "" {
+			return value, ".env " + key, nil
+		}
+	}
+
+	value, err := configuredAuthToken(filepath.Join(composeDir, "data", "conf"))
+	if err != nil {
+		return "", "", err
+	}
+	// A ${VAR} reference is resolved by the gateway, not a token itself.
+	if value == "" || strings.HasPrefix(value, "${") {
+		return "", "", nil
+	}
+	return value, "openclaw.json gateway.auth.token", nil
+}
+
+// GatewayTokenCopy is one place the gateway token is kept. Token is empty
+// when openclaw.json references a variable that is not set; Fingerprint
+// tells copies apart without showing them.
+type GatewayTokenCopy struct {
+	Source      string
+	Token       string
+	Fingerprint string
+}
+
+// GatewayTokenCopies lists every copy of the gateway token under
+// composeDir: the compose .env, data/conf/.env and gateway.auth.token, with
+// a ${VAR} reference resolved against data/conf/.env. Missing files and
+// unset entries are left out.
+func GatewayTokenCopies(composeDir string) ([]GatewayTokenCopy, error) {
+	var copies []GatewayTokenCopy
+	composeEnv, err := os.ReadFile(filepath.Join(composeDir, ".env"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read .env: %w", err)
+	}
+	composeValues := envValues(composeEnv)
+	for _, key := range gatewayTokenKeys {
+		if value := composeValues[key]; value != "" {
+			copies = append(copies, GatewayTokenCopy{Source: ".env " + key, Token: value})
+			break
+		}
+	}
+
+	configDir := filepath.Join(composeDir, "data", "conf")
+	configEnv, err := os.ReadFile(filepath.Join(configDir, ".env"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read data/conf/.env: %w", err)
+	}
+	configValues := envValues(configEnv)
+	if value := configValues[gatewayTokenKeys[0]]; value != "" {
+		copies = append(copies, GatewayTokenCopy{Source: "data/conf/.env " + gatewayTokenKeys[0], Token: value})
+	}
+
+	token, err := configuredAuthToken(configDir)
+	if err != nil {
+		return nil, err
+	}
+	if name, ok := strings.CutPrefix(token, "${"); ok {
+		name = strings.TrimSuffix(name, "}")
+		copies = append(copies, GatewayTokenCopy{Source: "openclaw.json gateway.auth.token (" + token + ")", Token: configValues[name]})
+	} else if token != "" {
+		copies = append(copies, GatewayTokenCopy{Source: "openclaw.json gateway.auth.token", Token: token})
+	}
+	for i := range copies {
+		if copies[i].Token != "" {
+			copies[i].Fingerprint = redactValue(copies[i].Token)
+		}
+	}
+	return copies, nil
+}
+
+// SyncGatewayToken writes token into every copy that exists: both .env
+// files and a literal gateway.auth.token. Only the gateway.auth.token value
+// of openclaw.json is replaced, so the rest of the file keeps its layout
+// and any other field that happens to hold the old token is left alone. It
+// returns the files changed.
+func SyncGatewayToken(composeDir, token string) ([]string, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, fmt.Errorf("gateway token is empty")
+	}
+	configDir := filepath.Join(composeDir, "data", "conf")
+	var changed []string
+	envFiles := []struct {
+		path    string
+		aliases []string
+	}{
+		{filepath.Join(composeDir, ".env"), gatewayTokenKeys[1:]},
+		{filepath.Join(configDir, ".env"), nil},
+	}
+	for _, file := range envFiles {
+		content, err := os.ReadFile(file.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return changed, fmt.Errorf("read %s: %w", file.path, err)
+		}
+		updated := SetEnvValue(content, gatewayTokenKeys[0], token, file.aliases...)
+		if string(updated) == string(content) {
+			continue
+		}
+		if err := os.WriteFile(file.path, updated, 0o600); err != nil {
+			return changed, fmt.Errorf("write %s: %w", file.path, err)
+		}
+		changed = append(changed, file.path)
+	}
+
+	current, err := configuredAuthToken(configDir)
+	if err != nil {
+		return changed, err
+	}
+	if current == "" || current == token || strings.HasPrefix(current, "${") {
+		return changed, nil
+	}
+	configPath := filepath.Join(configDir, "openclaw.json")
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return changed, fmt.Errorf("read openclaw.json: %w", err)
+	}
+	updated, err := setJSONString(content, token, "gateway", "auth", "token")
+	if err != nil {
+		return changed, fmt.Errorf("update openclaw.json: %w", err)
+	}
+	if errs := ValidateConfig(updated); len(errs) > 0 {
+		return changed, errs
+	}
+	if err := os.WriteFile(configPath, updated, 0o600); err != nil {
+		return changed, fmt.Errorf("write openclaw.json: %w", err)
+	}
+	return append(changed, configPath), nil
+}
+
+// setJSONString replaces the string at path in the JSON document content
+// with value and leaves every other byte as it was. When a key repeats, the
+// last one is used, as encoding/json does.
+func setJSONString(content []byte, value string, path ...string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	start, end := -1, -1
+	// walk reads one value; matched tells whether the keys leading to it
+	// follow path, and keyEnd is where its key ended.
+	var walk func(depth int, matched bool, keyEnd int64) error
+	walk = func(depth int, matched bool, keyEnd int64) error {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		delim, isDelim := token.(json.Delim)
+		if !isDelim {
+			if _, isString := token.(string); isString && matched && depth == len(path) {
+				valueEnd := int(dec.InputOffset())
+				quote := bytes.IndexByte(content[keyEnd:valueEnd], ':')
+				quote += bytes.IndexByte(content[int(keyEnd)+quote:valueEnd], '"')
+				start, end = int(keyEnd)+quote, valueEnd
+			}
+			return nil
+		}
+		for dec.More() {
+			childMatched := false
+			var childKeyEnd int64
+			if delim == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				childKeyEnd = dec.InputOffset()
+				childMatched = matched && depth < len(path) && key == path[depth]
+			}
+			if err := walk(depth+1, childMatched, childKeyEnd); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+	if err := walk(0, true, 0); err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("%s is not a string", strings.Join(path, "."))
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	updated := make([]byte, 0, len(content)-(end-start)+len(encoded))
+	updated = append(updated, content[:start]...)
+	updated = append(updated, encoded...)
+	return append(updated, content[end:]...), nil
+}
+
+// SetEnvValue sets key in .env content, replacing the key or any of its
+// aliases where they appear and appending it otherwise. The file's
+// trailing newline is kept.
+func SetEnvValue(content []byte, key, value string, aliases ...string) []byte {
+	names := append([]string{key}, aliases...)
+	entry := key + "=" + value
+	lines := strings.Split(string(content), "\n")
+	updated := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		name, _, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+		for _, candidate := range names {
+			if strings.TrimSpace(name) == candidate {
+				lines[i] = entry
+				updated = true
+			}
+		}
+	}
+	if !updated {
+		if last := len(lines) - 1; lines[last] == "" {
+			lines = append(lines[:last], entry, "")
+		} else {
+			lines = append(lines, entry)
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// configuredAuthToken is gateway.auth.token as written in openclaw.json,
+// or empty when the file does not exist.
+func configuredAuthToken(configDir string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("read openclaw.json: %w", err)
+	}
+	var cfg struct {
+		Gateway struct {
+			Auth struct {
+				Token string `json:"token"`
+			} `json:"auth"`
+		} `json:"gateway"`
+	}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return "", fmt.Errorf("parse openclaw.json: %w", err)
+	}
+	return strings.TrimSpace(cfg.Gateway.Auth.Token), nil
+}
@@ -0,0 +1,48 @@
+package config
+
+import "testing"
+
+func TestSetJSONString(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "only the path changes",
+			content: "{\n  \"channels\": {\"auth\": {\"token\": \"old\"}},\n  \"gateway\": {\"auth\": {\"token\": \"old\", \"mode\": \"token\"}},\n  \"note\": \"old\"\n}\n",
+			want:    "{\n  \"channels\": {\"auth\": {\"token\": \"old\"}},\n  \"gateway\": {\"auth\": {\"token\": \"new\", \"mode\": \"token\"}},\n  \"note\": \"old\"\n}\n",
+		},
+		{
+			name:    "escaped value and spacing",
+			content: `{"gateway" : {"auth":{ "token"  :  "o\"ld\u0041" }}}`,
+			want:    `{"gateway" : {"auth":{ "token"  :  "new" }}}`,
+		},
+		{
+			name:    "arrays are skipped",
+			content: `{"list":[{"gateway":{"auth":{"token":"x"}}}],"gateway":{"auth":{"token":"old"}}}`,
+			want:    `{"list":[{"gateway":{"auth":{"token":"x"}}}],"gateway":{"auth":{"token":"new"}}}`,
+		},
+		{
+			name:    "last duplicate wins",
+			content: `{"gateway":{"auth":{"token":"first","token":"second"}}}`,
+			want:    `{"gateway":{"auth":{"token":"first","token":"new"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := setJSONString([]byte(tt.content), "new", "gateway", "auth", "token")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+
+	for _, content := range []string{`{"gateway":{"auth":{"token":1}}}`, `{"gateway":{}}`, `{"gateway":`} {
+		if _, err := setJSONString([]byte(content), "new", "gateway", "auth", "token"); err == nil {
+			t.Errorf("%s: want an error", content)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	gatewayModes = []string{"local", "remote"}
+	gatewayBinds = []string{"loopback", "lan", "tailnet", "auto", "custom"}
+	authModes    = []string{"token", "password"}
+	modelsModes  = []string{"merge", "replace"}
+	apiDialects  = []string{"openai-completions", "openai-responses", "anthropic-messages", "google-generative-ai"}
+	modelInputs  = []string{"text", "image"}
+)
+
+const maxPortNumber = 65535
+
+// IsAPIDialect reports whether api is a models.providers.*.api value the
+// gateway understands.
+func IsAPIDialect(api string) bool {
+	for _, dialect := range apiDialects {
+		if api == dialect {
+			return true
+		}
+	}
+	return false
+}
+
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, item := range e {
+		messages = append(messages, item.Error())
+	}
+	return "invalid openclaw.json: " + strings.Join(messages, "; ")
+}
+
+// ValidateFile checks an openclaw.json on disk, including parts that were
+// edited by hand. A nil error with an empty result means the file is valid.
+func ValidateFile(path string) (ValidationErrors, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	return ValidateConfig(content), nil
+}
+
+// ValidateConfig checks the subset of openclaw.json managed by this tool and
+// returns every problem found, each with the JSON path it refers to.
+func ValidateConfig(content []byte) ValidationErrors {
+	var raw interface{}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			// Offset counts the byte that failed to parse; point at it.
+			line, column := offsetPosition(content, syntaxErr.Offset-1)
+			return ValidationErrors{{Path: "$", Message: fmt.Sprintf("invalid json at line %d, column %d: %s", line, column, syntaxErr)}}
+		}
+		return ValidationErrors{{Path: "$", Message: err.Error()}}
+	}
+
+	v := &validator{}
+	root, ok := v.object("$", raw, true)
+	if !ok {
+		return v.errs
+	}
+
+	if gateway, ok := v.object("$.gateway", root["gateway"], true); ok {
+		v.enum("$.gateway.mode", gateway["mode"], gatewayModes, true)
+		v.enum("$.gateway.bind", gateway["bind"], gatewayBinds, true)
+		v.integer("$.gateway.port", gateway["port"], 1, maxPortNumber, true)
+		if auth, ok := v.object("$.gateway.auth", gateway["auth"], true); ok {
+			mode, _ := v.enum("$.gateway.auth.mode", auth["mode"], authModes, true)
+			v.nonEmptyString("$.gateway.auth.token", auth["token"], mode == "token")
+		}
+		if controlUi, ok := v.object("$.gateway.controlUi", gateway["controlUi"], false); ok {
+			v.boolean("$.gateway.controlUi.allowInsecureAuth", controlUi["allowInsecureAuth"])
+		}
+	}
+
+	if agents, ok := v.object("$.agents", root["agents"], true); ok {
+		if defaults, ok := v.object("$.agents.defaults", agents["defaults"], true); ok {
+			if model, ok := v.object("$.agents.defaults.model", defaults["model"], true); ok {
+				v.modelRef("$.agents.defaults.model.primary", model["primary"], true)
+				if fallbacks, ok := v.array("$.agents.defaults.model.fallbacks", model["fallbacks"], false); ok {
+					for i, item := range fallbacks {
+						v.modelRef(fmt.Sprintf("$.agents.defaults.model.fallbacks[%d]", i), item, true)
+					}
+				}
+			}
+		}
+	}
+
+	if models, ok := v.object("$.models", root["models"], false); ok {
+		v.enum("$.models.mode", models["mode"], modelsModes, false)
+		if providers, ok := v.object("$.models.providers", models["providers"], false); ok {
+			for _, id := range sortedKeys(providers) {
+				v.provider("$.models.providers."+id, providers[id])
+			}
+		}
+	}
+
+	return v.errs
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) fail(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) object(path string, value interface{}, required bool) (map[string]interface{}, bool) {
+	if value == nil {
+		if required {
+			v.fail(path, "is required")
+		}
+		return nil, false
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		v.fail(path, "must be an object")
+		return nil, false
+	}
+	return obj, true
+}
+
+func (v *validator) array(path string, value interface{}, required bool) ([]interface{}, bool) {
+	if value == nil {
+		if required {
+			v.fail(path, "is required")
+		}
+		return nil, false
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		v.fail(path, "must be an array")
+		return nil, false
+	}
+	return items, true
+}
+
+func (v *validator) str(path string, value interface{}, required bool) (string, bool) {
+	if value == nil {
+		if required {
+			v.fail(path, "is required")
+		}
+		return "", false
+	}
+	text, ok := value.(string)
+	if !ok {
+		v.fail(path, "must be a string")
+		return "", false
+	}
+	return text, true
+}
+
+func (v *validator) nonEmptyString(path string, value interface{}, required bool) (string, bool) {
+	text, ok := v.str(path, value, required)
+	if ok && strings.TrimSpace(text) == "" && required {
+		v.fail(path, "must not be empty")
+		return "", false
+	}
+	return text, ok
+}
+
+func (v *validator) enum(path string, value interface{}, allowed []string, required bool) (string, bool) {
+	text, ok := v.str(path, value, required)
+	if !ok {
+		return "", false
+	}
+	for _, item := range allowed {
+		if text == item {
+			return text, true
+		}
+	}
+	v.fail(path, "must be one of %s, got %q", strings.Join(allowed, ", "), text)
+	return "", false
+}
+
+func (v *validator) integer(path string, value interface{}, min, max float64, required bool) {
+	if value == nil {
+		if required {
+			v.fail(path, "is required")
+		}
+		return
+	}
+	number, ok := value.(float64)
+	if !ok || number != float64(int64(number)) {
+		v.fail(path, "must be an integer")
+		return
+	}
+	if number < min || number > max {
+		v.fail(path, "must be between %.0f and %.0f", min, max)
+	}
+}
+
+func (v *validator) boolean(path string, value interface{}) {
+	if value == nil {
+		return
+	}
+	if _, ok := value.(bool); !ok {
+		v.fail(path, "must be a boolean")
+	}
+}
+
+func (v *validator) modelRef(path string, value interface{}, required bool) {
+	text, ok := v.nonEmptyString(path, value, required)
+	if !ok || text == "" {
+		return
+	}
+	if err := checkModelRef(text); err != nil {
+		v.fail(path, "%s", err)
+	}
+}
+
+func (v *validator) provider(path string, value interface{}) {
+	provider, ok := v.object(path, value, true)
+	if !ok {
+		return
+	}
+	if baseUrl, ok := v.str(path+".baseUrl", provider["baseUrl"], false); ok {
+		if err := checkBaseUrl(baseUrl); err != nil {
+			v.fail(path+".baseUrl", "%s", err)
+		}
+	}
+	v.enum(path+".api", provider["api"], apiDialects, false)
+	v.str(path+".apiKey", provider["apiKey"], false)
+
+	entries, ok := v.array(path+".models", provider["models"], false)
+	if !ok {
+		return
+	}
+	seen := make(map[string]bool)
+	for i, item := range entries {
+		entryPath := fmt.Sprintf("%s.models[%d]", path, i)
+		entry, ok := v.object(entryPath, item, true)
+		if !ok {
+			continue
+		}
+		if id, ok := v.nonEmptyString(entryPath+".id", entry["id"], true); ok {
+			if seen[id] {
+				v.fail(entryPath+".id", "duplicate model id %q", id)
+			}
+			seen[id] = true
+		}
+		v.str(entryPath+".name", entry["name"], false)
+		v.boolean(entryPath+".reasoning", entry["reasoning"])
+		if inputs, ok := v.array(entryPath+".input", entry["input"], false); ok {
+			for j, input := range inputs {
+				v.enum(fmt.Sprintf("%s.input[%d]", entryPath, j), input, modelInputs, true)
+			}
+		}
+		v.integer(entryPath+".contextWindow", entry["contextWindow"], 1, 1<<30, false)
+		v.integer(entryPath+".maxTokens", entry["maxTokens"], 1, 1<<30, false)
+		contextWindow, _ := entry["contextWindow"].(float64)
+		maxTokens, _ := entry["maxTokens"].(float64)
+		if contextWindow > 0 && maxTokens > contextWindow {
+			v.fail(entryPath+".maxTokens", "must not exceed contextWindow (%.0f)", contextWindow)
+		}
+	}
+}
+
+func checkModelRef(ref string) error {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+		return fmt.Errorf("must have the form provider/model, got %q", ref)
+	}
+	if strings.ContainsAny(ref, " \t") {
+		return fmt.Errorf("must not contain whitespace, got %q", ref)
+	}
+	if parts[0] != strings.ToLower(parts[0]) {
+		return fmt.Errorf("provider id must be lowercase, got %q", parts[0])
+	}
+	return nil
+}
+
+func checkBaseUrl(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("is not a valid url: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("must start with http:// or https://, got %q", value)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("must include a host, got %q", value)
+	}
+	return nil
+}
+
+func offsetPosition(content []byte, offset int64) (int, int) {
+	line, column := 1, 1
+	for i := int64(0); i < offset && i < int64(len(content)); i++ {
+		if content[i] == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return line, column
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
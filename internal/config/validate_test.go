@@ -0,0 +1,139 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const validTestConfig = `{
+  "gateway": {"mode": "local", "bind": "lan", "port": 18789, "auth": {"mode": "token", "token": "t"}, "controlUi": {"allowInsecureAuth": true}},
+  "agents": {"defaults": {"model": {"primary": "openai/gpt-4o", "fallbacks": ["ollama/llama3"]}}},
+  "models": {"mode": "merge", "providers": {"ollama": {"apiKey": "ollama", "baseUrl": "http://172.17.0.1:11434/v1", "api": "openai-completions", "models": [{"id": "llama3", "name": "llama3", "reasoning": false, "input": ["text"], "contextWindow": 8192, "maxTokens": 4096}]}}}
+}`
+
+// setPath replaces the value at a dotted path of doc, or deletes it when
+// value is nil. Array elements are addressed by their index.
+func setPath(t *testing.T, doc interface{}, path string, value interface{}) {
+	t.Helper()
+	parts := strings.Split(path, ".")
+	current := doc
+	for i, part := range parts {
+		last := i == len(parts)-1
+		switch node := current.(type) {
+		case map[string]interface{}:
+			if last {
+				if value == nil {
+					delete(node, part)
+				} else {
+					node[part] = value
+				}
+				return
+			}
+			current = node[part]
+		case []interface{}:
+			var index int
+			if err := json.Unmarshal([]byte(part), &index); err != nil || index >= len(node) {
+				t.Fatalf("bad index %q in %s", part, path)
+			}
+			if last {
+				node[index] = value
+				return
+			}
+			current = node[index]
+		default:
+			t.Fatalf("%s does not lead to an object", path)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	cases := []struct {
+		name  string
+		edits map[string]interface{}
+		want  []string
+	}{
+		{name: "valid"},
+		{"gateway missing", map[string]interface{}{"gateway": nil}, []string{"$.gateway: is required"}},
+		{"gateway mode", map[string]interface{}{"gateway.mode": "cloud"}, []string{`$.gateway.mode: must be one of local, remote, got "cloud"`}},
+		{"gateway bind type", map[string]interface{}{"gateway.bind": 1.0}, []string{"$.gateway.bind: must be a string"}},
+		{"gateway port range", map[string]interface{}{"gateway.port": 70000.0}, []string{"$.gateway.port: must be between 1 and 65535"}},
+		{"gateway port fraction", map[string]interface{}{"gateway.port": 80.5}, []string{"$.gateway.port: must be an integer"}},
+		{"token required", map[string]interface{}{"gateway.auth.token": "  "}, []string{"$.gateway.auth.token: must not be empty"}},
+		{"password mode needs no token", map[string]interface{}{"gateway.auth.mode": "password", "gateway.auth.token": nil}, nil},
+		{"controlUi flag", map[string]interface{}{"gateway.controlUi.allowInsecureAuth": "yes"}, []string{"$.gateway.controlUi.allowInsecureAuth: must be a boolean"}},
+		{"primary missing", map[string]interface{}{"agents.defaults.model.primary": nil}, []string{"$.agents.defaults.model.primary: is required"}},
+		{"primary without provider", map[string]interface{}{"agents.defaults.model.primary": "gpt-4o"}, []string{`$.agents.defaults.model.primary: must have the form provider/model, got "gpt-4o"`}},
+		{"primary with whitespace", map[string]interface{}{"agents.defaults.model.primary": "openai/gpt 4o"}, []string{`$.agents.defaults.model.primary: must not contain whitespace, got "openai/gpt 4o"`}},
+		{"uppercase provider", map[string]interface{}{"agents.defaults.model.primary": "OpenAI/gpt-4o"}, []string{`$.agents.defaults.model.primary: provider id must be lowercase, got "OpenAI"`}},
+		{"bad fallback", map[string]interface{}{"agents.defaults.model.fallbacks": []interface{}{"openai/gpt-4o", "/x"}}, []string{`$.agents.defaults.model.fallbacks[1]: must have the form provider/model, got "/x"`}},
+		{"fallbacks type", map[string]interface{}{"agents.defaults.model.fallbacks": "openai/gpt-4o"}, []string{"$.agents.defaults.model.fallbacks: must be an array"}},
+		{"models mode", map[string]interface{}{"models.mode": "append"}, []string{`$.models.mode: must be one of merge, replace, got "append"`}},
+		{"provider not an object", map[string]interface{}{"models.providers.ollama": "x"}, []string{"$.models.providers.ollama: must be an object"}},
+		{"provider base url scheme", map[string]interface{}{"models.providers.ollama.baseUrl": "ftp://host/v1"}, []string{`$.models.providers.ollama.baseUrl: must start with http:// or https://, got "ftp://host/v1"`}},
+		{"provider base url host", map[string]interface{}{"models.providers.ollama.baseUrl": "http:///v1"}, []string{`$.models.providers.ollama.baseUrl: must include a host, got "http:///v1"`}},
+		{"provider api", map[string]interface{}{"models.providers.ollama.api": "grpc"}, []string{`$.models.providers.ollama.api: must be one of openai-completions, openai-responses, anthropic-messages, google-generative-ai, got "grpc"`}},
+		{"model id missing", map[string]interface{}{"models.providers.ollama.models.0.id": nil}, []string{"$.models.providers.ollama.models[0].id: is required"}},
+		{"model input", map[string]interface{}{"models.providers.ollama.models.0.input": []interface{}{"audio"}}, []string{`$.models.providers.ollama.models[0].input[0]: must be one of text, image, got "audio"`}},
+		{"maxTokens over context", map[string]interface{}{"models.providers.ollama.models.0.maxTokens": 9000.0}, []string{"$.models.providers.ollama.models[0].maxTokens: must not exceed contextWindow (8192)"}},
+		{
+			name: "errors are collected",
+			edits: map[string]interface{}{
+				"gateway.port":                  0.0,
+				"agents.defaults.model.primary": "x",
+			},
+			want: []string{
+				"$.gateway.port: must be between 1 and 65535",
+				`$.agents.defaults.model.primary: must have the form provider/model, got "x"`,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc map[string]interface{}
+			if err := json.Unmarshal([]byte(validTestConfig), &doc); err != nil {
+				t.Fatal(err)
+			}
+			for path, value := range tc.edits {
+				setPath(t, doc, path, value)
+			}
+			content, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, item := range ValidateConfig(content) {
+				got = append(got, item.Error())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("errors = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigReportsSyntaxPosition(t *testing.T) {
+	errs := ValidateConfig([]byte("{\n  \"gateway\": {,\n}"))
+	if len(errs) != 1 || errs[0].Path != "$" || !strings.Contains(errs[0].Message, "line 2, column 15") {
+		t.Errorf("errors = %v, want one syntax error at line 2, column 15", errs)
+	}
+}
+
+func TestValidateConfigDuplicateModelID(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(validTestConfig), &doc); err != nil {
+		t.Fatal(err)
+	}
+	ollama := doc["models"].(map[string]interface{})["providers"].(map[string]interface{})["ollama"].(map[string]interface{})
+	models := ollama["models"].([]interface{})
+	ollama["models"] = append(models, models[0])
+	content, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := ValidateConfig(content)
+	if len(errs) != 1 || errs[0].Path != "$.models.providers.ollama.models[1].id" {
+		t.Errorf("errors = %v, want a duplicate id at models[1]", errs)
+	}
+}
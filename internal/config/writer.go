@@ -1,40 +1,73 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
+// ProviderKey is one configured provider. Key is the env variable holding
+// the API key; Provider defaults to the id derived from Key and is needed
+// for providers without a key such as Ollama. Region, BaseUrl and Api
+// override the registry defaults. Models declares extra model ids on
+// providers that get a models.providers block.
 type ProviderKey struct {
-	Key   string
-	Value string
+	Key      string   `json:"key,omitempty"`
+	Value    string   `json:"value,omitempty"`
+	Provider string   `json:"provider,omitempty"`
+	Region   string   `json:"region,omitempty"`
+	BaseUrl  string   `json:"baseUrl,omitempty"`
+	Api      string   `json:"api,omitempty"`
+	Models   []string `json:"models,omitempty"`
 }
 
+// ID is the provider id of the entry.
+func (p ProviderKey) ID() string {
+	if id := strings.ToLower(strings.TrimSpace(p.Provider)); id != "" {
+		return id
+	}
+	return ProviderIDForEnvKey(strings.TrimSpace(p.Key))
+}
+
+// WriteOptions drive the single writer used by init, the server and
+// apply. The fields after Proxy are optional and left at the defaults
+// when zero.
 type WriteOptions struct {
 	ConfigDir    string
 	Model        string
 	GatewayToken string
 	Providers    []ProviderKey
+	Proxy        *ProxySettings
+	Fallbacks    []string
+	Gateway      GatewaySettings
+	// Channels is written as the channels object of openclaw.json as is.
+	Channels json.RawMessage
+	// Env adds variables to data/conf/.env, such as channel tokens
+	// referenced from Channels.
+	Env map[string]string
+	// Base is the openclaw.json the write starts from. What the writer does
+	// not manage, such as plugins or provider headers, is kept from it;
+	// see overlayConfig.
+	Base json.RawMessage
 }
 
-type WriteConfigOnlyOptions struct {
-	ConfigDir      string
-	Model          string
-	GatewayToken   string
-	ProviderID     string
-	ProviderEnvKey string
-	ProviderApiKey string
-	BaseUrl        string
-	WriteEnv       bool
+// GatewaySettings override the generated gateway block.
+type GatewaySettings struct {
+	Mode              string `json:"mode,omitempty"`
+	Bind              string `json:"bind,omitempty"`
+	Port              int    `json:"port,omitempty"`
+	AllowInsecureAuth *bool  `json:"allowInsecureAuth,omitempty"`
 }
 
 type openclawConfig struct {
-	Gateway gatewayConfig `json:"gateway"`
-	Agents  agentsConfig  `json:"agents"`
-	Models  *modelsConfig `json:"models,omitempty"`
+	Gateway  gatewayConfig   `json:"gateway"`
+	Agents   agentsConfig    `json:"agents"`
+	Models   *modelsConfig   `json:"models,omitempty"`
+	Channels json.RawMessage `json:"channels,omitempty"`
 }
 
 type gatewayConfig struct {
@@ -63,7 +96,8 @@ type agentDefaults struct {
 }
 
 type modelRef struct {
-	Primary string `json:"primary"`
+	Primary   string   `json:"primary"`
+	Fallbacks []string `json:"fallbacks,omitempty"`
 }
 
 type modelsConfig struct {
@@ -87,32 +121,15 @@ type modelEntry struct {
 	MaxTokens     int      `json:"maxTokens"`
 }
 
-func WriteConfigAndEnv(opts WriteOptions) error {
-	if strings.TrimSpace(opts.ConfigDir) == "" {
-		return fmt.Errorf("config dir is required")
-	}
-	if strings.TrimSpace(opts.Model) == "" {
-		return fmt.Errorf("model is required")
-	}
-	if strings.TrimSpace(opts.GatewayToken) == "" {
-		return fmt.Errorf("gateway token is required")
-	}
-
-	if err := os.MkdirAll(opts.ConfigDir, 0o755); err != nil {
-		return fmt.Errorf("create config dir: %w", err)
-	}
-
-	configPath := filepath.Join(opts.ConfigDir, "openclaw.json")
-	envPath := filepath.Join(opts.ConfigDir, ".env")
-
-	cfg := openclawConfig{
+func defaultConfig(token, model string) openclawConfig {
+	return openclawConfig{
 		Gateway: gatewayConfig{
 			Mode: "local",
 			Bind: "lan",
 			Port: 18789,
 			Auth: gatewayAuth{
 				Mode:  "token",
-				Token: opts.GatewayToken,
+				Token: token,
 			},
 			ControlUi: gatewayControlUi{
 				AllowInsecureAuth: true,
@@ -121,19 +138,86 @@ func WriteConfigAndEnv(opts WriteOptions) error {
 		Agents: agentsConfig{
 			Defaults: agentDefaults{
 				Model: modelRef{
-					Primary: opts.Model,
+					Primary: model,
 				},
 			},
 		},
 	}
+}
 
-	payload, err := json.MarshalIndent(cfg, "", "  ")
+type renderedFile struct {
+	path    string
+	content []byte
+}
+
+func WriteConfigAndEnv(opts WriteOptions) error {
+	files, err := renderConfigAndEnv(opts)
 	if err != nil {
-		return fmt.Errorf("marshal config: %w", err)
+		return err
 	}
+	return writeRenderedFiles(opts.ConfigDir, files)
+}
 
-	if err := os.WriteFile(configPath, payload, 0o600); err != nil {
-		return fmt.Errorf("write config: %w", err)
+// PreviewConfigAndEnv renders the files WriteConfigAndEnv would write and
+// diffs them against the current files without touching the disk.
+func PreviewConfigAndEnv(opts WriteOptions) ([]FileChange, error) {
+	files, err := renderConfigAndEnv(opts)
+	if err != nil {
+		return nil, err
+	}
+	return previewRenderedFiles(files), nil
+}
+
+func renderConfigAndEnv(opts WriteOptions) ([]renderedFile, error) {
+	if strings.TrimSpace(opts.ConfigDir) == "" {
+		return nil, fmt.Errorf("config dir is required")
+	}
+	if strings.TrimSpace(opts.Model) == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+	if strings.TrimSpace(opts.GatewayToken) == "" {
+		return nil, fmt.Errorf("gateway token is required")
+	}
+
+	cfg := defaultConfig(opts.GatewayToken, opts.Model)
+	cfg.Agents.Defaults.Model.Fallbacks = opts.Fallbacks
+	opts.Gateway.apply(&cfg.Gateway)
+	if len(opts.Channels) > 0 {
+		var channels map[string]json.RawMessage
+		if err := json.Unmarshal(opts.Channels, &channels); err != nil {
+			return nil, fmt.Errorf("channels must be a JSON object: %w", err)
+		}
+		cfg.Channels = opts.Channels
+	}
+	modelRefs := append([]string{opts.Model}, opts.Fallbacks...)
+	for _, item := range opts.Providers {
+		providerID := item.ID()
+		if providerID == "" {
+			continue
+		}
+		provider, err := providerBlock(providerID, item, modelRefs)
+		if err != nil {
+			return nil, err
+		}
+		if provider == nil {
+			continue
+		}
+		if cfg.Models == nil {
+			cfg.Models = &modelsConfig{Mode: "merge", Providers: make(map[string]modelProvider)}
+		}
+		cfg.Models.Providers[providerID] = *provider
+	}
+	if errs := unconfiguredFallbacks(opts); len(errs) > 0 {
+		return nil, errs
+	}
+	configContent, err := marshalConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(opts.Base)) > 0 {
+		if configContent, err = overlayConfig(configContent, opts.Base); err != nil {
+			return nil, err
+		}
 	}
 
 	envLines := []string{fmt.Sprintf("OPENCLAW_GATEWAY_TOKEN=%s", opts.GatewayToken)}
@@ -145,126 +229,185 @@ func WriteConfigAndEnv(opts WriteOptions) error {
 		}
 		envLines = append(envLines, fmt.Sprintf("%s=%s", key, value))
 	}
-
-	envContent := strings.Join(envLines, "\n") + "\n"
-	if err := os.WriteFile(envPath, []byte(envContent), 0o600); err != nil {
-		return fmt.Errorf("write env: %w", err)
+	envKeys := make([]string, 0, len(opts.Env))
+	for key := range opts.Env {
+		envKeys = append(envKeys, key)
+	}
+	sort.Strings(envKeys)
+	for _, key := range envKeys {
+		if value := strings.TrimSpace(opts.Env[key]); value != "" {
+			envLines = append(envLines, fmt.Sprintf("%s=%s", key, value))
+		}
 	}
+	envLines = append(envLines, opts.Proxy.envLines()...)
+	envContent := strings.Join(envLines, "\n") + "\n"
 
-	return nil
+	return []renderedFile{
+		{path: filepath.Join(opts.ConfigDir, "openclaw.json"), content: configContent},
+		{path: filepath.Join(opts.ConfigDir, ".env"), content: []byte(envContent)},
+	}, nil
 }
 
-func WriteConfigOnly(opts WriteConfigOnlyOptions) error {
-	if strings.TrimSpace(opts.ConfigDir) == "" {
-		return fmt.Errorf("config dir is required")
+// unconfiguredFallbacks reports the fallbacks whose provider is not among
+// opts.Providers, which the gateway could not use.
+func unconfiguredFallbacks(opts WriteOptions) ValidationErrors {
+	configured := opts.providerIDs()
+	var errs ValidationErrors
+	for i, ref := range opts.Fallbacks {
+		if provider := modelRefProvider(ref); provider != "" && !configured[provider] {
+			errs = append(errs, ValidationError{
+				Path:    fmt.Sprintf("$.agents.defaults.model.fallbacks[%d]", i),
+				Message: fmt.Sprintf("provider %s is not configured", provider),
+			})
+		}
 	}
-	if strings.TrimSpace(opts.Model) == "" {
-		return fmt.Errorf("model is required")
+	return errs
+}
+
+func (g GatewaySettings) apply(gateway *gatewayConfig) {
+	if mode := strings.TrimSpace(g.Mode); mode != "" {
+		gateway.Mode = mode
 	}
-	if strings.TrimSpace(opts.GatewayToken) == "" {
-		return fmt.Errorf("gateway token is required")
+	if bind := strings.TrimSpace(g.Bind); bind != "" {
+		gateway.Bind = bind
 	}
-
-	if err := os.MkdirAll(opts.ConfigDir, 0o755); err != nil {
-		return fmt.Errorf("create config dir: %w", err)
+	if g.Port != 0 {
+		gateway.Port = g.Port
 	}
-
-	configPath := filepath.Join(opts.ConfigDir, "openclaw.json")
-
-	cfg := openclawConfig{
-		Gateway: gatewayConfig{
-			Mode: "local",
-			Bind: "lan",
-			Port: 18789,
-			Auth: gatewayAuth{
-				Mode:  "token",
-				Token: opts.GatewayToken,
-			},
-			ControlUi: gatewayControlUi{
-				AllowInsecureAuth: true,
-			},
-		},
-		Agents: agentsConfig{
-			Defaults: agentDefaults{
-				Model: modelRef{
-					Primary: opts.Model,
-				},
-			},
-		},
+	if g.AllowInsecureAuth != nil {
+		gateway.ControlUi.AllowInsecureAuth = *g.AllowInsecureAuth
 	}
+}
 
-	providerID := strings.ToLower(strings.TrimSpace(opts.ProviderID))
-	if providerID == "ollama" && strings.TrimSpace(opts.BaseUrl) == "" {
-		return fmt.Errorf("ollama base url is required")
+// providerBlock builds the models.providers entry for a provider, or nil
+// when the gateway's built-in defaults suffice. DeepSeek, Ollama and
+// providers outside the registry always need one; the others only when a
+// region, base URL or API dialect was chosen.
+func providerBlock(providerID string, item ProviderKey, modelRefs []string) (*modelProvider, error) {
+	apiKey := ""
+	if key := strings.TrimSpace(item.Key); key != "" {
+		apiKey = "${" + key + "}"
 	}
-	if providerID == "deepseek" {
-		cfg.Models = &modelsConfig{
-			Mode: "merge",
-			Providers: map[string]modelProvider{
-				"deepseek": {
-					ApiKey:  "${DEEPSEEK_API_KEY}",
-					BaseUrl: "https://api.deepseek.com/v1",
-					Api:     "openai-completions",
-					Models: []modelEntry{
-						{
-							ID:            "deepseek-chat",
-							Name:          "DeepSeek Chat",
-							Reasoning:     false,
-							Input:         []string{"text"},
-							ContextWindow: 128000,
-							MaxTokens:     8192,
-						},
-					},
-				},
-			},
+	region := strings.TrimSpace(item.Region)
+	baseUrl := strings.TrimSpace(item.BaseUrl)
+	api := strings.TrimSpace(item.Api)
+	if api != "" && !IsAPIDialect(api) {
+		return nil, fmt.Errorf("provider %s: unsupported api %q", providerID, api)
+	}
+
+	// Models are only declared on the provider they belong to.
+	ownedModels := ownedModelIDs(providerID, item.Models, modelRefs)
+	var models []modelEntry
+
+	info, known := LookupProvider(providerID)
+	switch {
+	case providerID == "ollama":
+		if baseUrl == "" {
+			return nil, fmt.Errorf("ollama base url is required")
 		}
-	} else if providerID == "ollama" {
-		modelID := opts.Model
-		if parts := strings.SplitN(opts.Model, "/", 2); len(parts) == 2 {
-			modelID = parts[1]
+		apiKey = "ollama"
+		for _, modelID := range ownedModels {
+			models = append(models, modelEntry{
+				ID:            modelID,
+				Name:          modelID,
+				Reasoning:     false,
+				Input:         []string{"text"},
+				ContextWindow: 160000,
+				MaxTokens:     81920,
+			})
 		}
-		cfg.Models = &modelsConfig{
-			Mode: "merge",
-			Providers: map[string]modelProvider{
-				"ollama": {
-					ApiKey:  "ollama",
-					BaseUrl: opts.BaseUrl,
-					Api:     "openai-completions",
-					Models: []modelEntry{
-						{
-							ID:            modelID,
-							Name:          modelID,
-							Reasoning:     false,
-							Input:         []string{"text"},
-							ContextWindow: 160000,
-							MaxTokens:     81920,
-						},
-					},
-				},
-			},
+	case providerID == "deepseek":
+		models = []modelEntry{{
+			ID:            "deepseek-chat",
+			Name:          "DeepSeek Chat",
+			Reasoning:     false,
+			Input:         []string{"text"},
+			ContextWindow: 128000,
+			MaxTokens:     8192,
+		}}
+	case !known:
+		if baseUrl == "" {
+			return nil, fmt.Errorf("provider %s: base url is required for providers outside the registry", providerID)
+		}
+		for _, modelID := range ownedModels {
+			models = append(models, modelEntry{
+				ID:            modelID,
+				Name:          modelID,
+				Reasoning:     false,
+				Input:         []string{"text"},
+				ContextWindow: 128000,
+				MaxTokens:     8192,
+			})
 		}
+	case region == "" && baseUrl == "" && api == "" && len(info.Endpoints) < 2 && !renamedKey(item.Key, info):
+		// A single-region provider is left to the gateway's built-in
+		// endpoint and key variable. Multi-region ones always get their
+		// resolved base URL, since the gateway's default region need not
+		// be the one the models were listed from, and a key kept under
+		// another variable has to be named in the block.
+		return nil, nil
 	}
 
-	payload, err := json.MarshalIndent(cfg, "", "  ")
+	endpoint, _, err := ResolveEndpoint(providerID, region, baseUrl)
 	if err != nil {
-		return fmt.Errorf("marshal config: %w", err)
+		return nil, err
 	}
-
-	if err := os.WriteFile(configPath, payload, 0o600); err != nil {
-		return fmt.Errorf("write config: %w", err)
+	if api == "" {
+		api = "openai-completions"
+		if known && info.Api != "" {
+			api = info.Api
+		}
 	}
+	return &modelProvider{ApiKey: apiKey, BaseUrl: endpoint, Api: api, Models: models}, nil
+}
 
-	if opts.WriteEnv {
-		envPath := filepath.Join(opts.ConfigDir, ".env")
-		lines := []string{fmt.Sprintf("OPENCLAW_GATEWAY_TOKEN=%s", opts.GatewayToken)}
-		if strings.TrimSpace(opts.ProviderEnvKey) != "" && strings.TrimSpace(opts.ProviderApiKey) != "" {
-			lines = append(lines, fmt.Sprintf("%s=%s", opts.ProviderEnvKey, opts.ProviderApiKey))
+// renamedKey reports whether key is set and differs from the variable the
+// gateway reads for the registry provider info.
+func renamedKey(key string, info ProviderInfo) bool {
+	key = strings.TrimSpace(key)
+	return key != "" && key != info.EnvKey
+}
+
+// ownedModelIDs lists the models to declare on providerID: those of the
+// model references that name it, then the extra ids given for it, without
+// duplicates.
+func ownedModelIDs(providerID string, extra, modelRefs []string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(id string) {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
 		}
-		content := strings.Join(lines, "\n") + "\n"
-		if err := os.WriteFile(envPath, []byte(content), 0o600); err != nil {
-			return fmt.Errorf("write env: %w", err)
+	}
+	for _, ref := range modelRefs {
+		if refProvider, modelID, ok := strings.Cut(ref, "/"); ok && strings.EqualFold(refProvider, providerID) {
+			add(modelID)
 		}
 	}
+	for _, id := range extra {
+		add(id)
+	}
+	return ids
+}
 
+func writeRenderedFiles(configDir string, files []renderedFile) error {
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	for _, file := range files {
+		if err := os.WriteFile(file.path, file.content, 0o600); err != nil {
+			return fmt.Errorf("write %s: %w", filepath.Base(file.path), err)
+		}
+	}
 	return nil
 }
+
+func previewRenderedFiles(files []renderedFile) []FileChange {
+	changes := make([]FileChange, 0, len(files))
+	for _, file := range files {
+		changes = append(changes, DiffFile(file.path, file.content))
+	}
+	return changes
+}
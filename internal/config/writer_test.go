@@ -0,0 +1,95 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMultiRegionProviderGetsBaseUrl checks that the gateway is told the
+// endpoint the models were listed from even when no region was chosen.
+func TestMultiRegionProviderGetsBaseUrl(t *testing.T) {
+	configDir := t.TempDir()
+	err := WriteConfigAndEnv(WriteOptions{
+		ConfigDir:    configDir,
+		Model:        "moonshot/kimi-latest",
+		GatewayToken: "writer-test-gateway-token",
+		Providers: []ProviderKey{
+			{Key: "MOONSHOT_API_KEY", Value: "moonshot-test-key-0001"},
+			{Key: "MISTRAL_API_KEY", Value: "mistral-test-key-0001"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg openclawConfig
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Models == nil {
+		t.Fatalf("no models section:\n%s", content)
+	}
+	listed, _, err := ResolveEndpoint("moonshot", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Models.Providers["moonshot"].BaseUrl; got != listed {
+		t.Errorf("moonshot baseUrl = %q, want the listing endpoint %q", got, listed)
+	}
+	if _, ok := cfg.Models.Providers["mistral"]; ok {
+		t.Error("a single-region provider got a block it does not need")
+	}
+
+	opts, err := CurrentWriteOptions(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, provider := range opts.Providers {
+		if provider.ID() == "moonshot" && (provider.Region != RegionCN || provider.BaseUrl != "") {
+			t.Errorf("moonshot read back as %+v, want the cn region", provider)
+		}
+	}
+}
+
+// TestRenamedEnvKeyGetsProviderBlock checks that a key kept under another
+// variable is named in a block for the gateway and read back as the same
+// provider.
+func TestRenamedEnvKeyGetsProviderBlock(t *testing.T) {
+	configDir := t.TempDir()
+	state := DesiredState{
+		Model:     "openai/gpt-4o",
+		Providers: []StateProvider{{ID: "openai", ApiKey: "sk-renamed-key-0001", EnvKey: "MY_OPENAI_KEY"}},
+		Gateway:   StateGateway{Token: "writer-test-gateway-token"},
+	}
+	opts, err := state.WriteOptions(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteConfigAndEnv(opts); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg openclawConfig
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Models == nil || cfg.Models.Providers["openai"].ApiKey != "${MY_OPENAI_KEY}" {
+		t.Fatalf("no openai block naming MY_OPENAI_KEY:\n%s", content)
+	}
+
+	current, err := CurrentWriteOptions(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(current.Providers) != 1 || current.Providers[0].ID() != "openai" || current.Providers[0].Key != "MY_OPENAI_KEY" {
+		t.Errorf("read back %+v, want openai under MY_OPENAI_KEY", current.Providers)
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+const (
+	auditOutcomeSuccess = "success"
+	auditOutcomeFailure = "failure"
+)
+
+// AuditEntry is one line of the audit log. ChangedKeys holds .env variable
+// names and openclaw.json paths, never their values.
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	ClientIP    string    `json:"clientIp"`
+	Action      string    `json:"action"`
+	ChangedKeys []string  `json:"changedKeys,omitempty"`
+	Outcome     string    `json:"outcome"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// AuditLog appends JSON lines to a file that is only ever opened for
+// appending. A nil *AuditLog records nothing.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewAuditLog(path string) *AuditLog {
+	if path == "" {
+		return nil
+	}
+	return &AuditLog{path: path}
+}
+
+func (a *AuditLog) Record(entry AuditEntry) error {
+	if a == nil {
+		return nil
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.Error = config.Secrets.Redact(entry.Error)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(a.path), 0o700); err != nil {
+		return fmt.Errorf("create audit dir: %w", err)
+	}
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// record is the handler-side helper: it fills in the client and outcome
+// and logs rather than fails the request when the log cannot be written.
+func (a *AuditLog) record(r *http.Request, action string, keys []string, err error) {
+	entry := AuditEntry{
+		ClientIP:    clientIP(r),
+		Action:      action,
+		ChangedKeys: keys,
+		Outcome:     auditOutcomeSuccess,
+	}
+	if err != nil {
+		entry.Outcome = auditOutcomeFailure
+		entry.Error = redactorFor(r.Context()).Redact(err.Error())
+	}
+	if recordErr := a.Record(entry); recordErr != nil {
+		slog.Default().Error("write audit log", "error", recordErr)
+	}
+}
+
+// changedKeys collects the keys of changes, prefixed with the file name.
+func changedKeys(changes []config.FileChange) []string {
+	var keys []string
+	for _, change := range changes {
+		name := filepath.Base(change.Path)
+		for _, key := range change.Keys {
+			keys = append(keys, name+":"+key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+const maxBundleUploadSize = 16 << 20
+
+type ExportRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+type ImportResponse struct {
+	OK      bool                 `json:"ok"`
+	Message string               `json:"message"`
+	Result  *config.ImportResult `json:"result,omitempty"`
+}
+
+func NewExportHandler(cfg ServerConfig, audit *AuditLog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, ImportResponse{Message: "method not allowed"})
+			return
+		}
+
+		var req ExportRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, ImportResponse{Message: "invalid json"})
+				return
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := config.ExportBundle(&buf, config.ExportOptions{
+			ConfigDir:  cfg.ConfigDir,
+			Version:    cfg.Version,
+			Passphrase: req.Passphrase,
+		}); err != nil {
+			audit.record(r, "export", nil, err)
+			writeJSON(w, http.StatusInternalServerError, ImportResponse{Message: err.Error()})
+			return
+		}
+		audit.record(r, "export", nil, nil)
+
+		filename := fmt.Sprintf("openclaw-setup-%s.tar.gz", time.Now().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(buf.Bytes())
+	})
+}
+
+// NewImportHandler accepts a multipart upload with the bundle in the
+// "bundle" field and optional "passphrase" and "dryRun" fields.
+func NewImportHandler(cfg ServerConfig, audit *AuditLog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, ImportResponse{Message: "method not allowed"})
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBundleUploadSize)
+		if err := r.ParseMultipartForm(maxBundleUploadSize); err != nil {
+			writeJSON(w, http.StatusBadRequest, ImportResponse{Message: "invalid upload"})
+			return
+		}
+		file, _, err := r.FormFile("bundle")
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ImportResponse{Message: "bundle is required"})
+			return
+		}
+		defer file.Close()
+
+		dryRun, _ := strconv.ParseBool(r.FormValue("dryRun"))
+		if !dryRun {
+			unlock, err := config.LockComposeDir(cfg.ComposeDir)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, ImportResponse{Message: err.Error()})
+				return
+			}
+			defer unlock()
+		}
+		result, err := config.ImportBundle(file, config.ImportOptions{
+			ConfigDir:  cfg.ConfigDir,
+			ComposeDir: cfg.ComposeDir,
+			Passphrase: r.FormValue("passphrase"),
+			DryRun:     dryRun,
+		})
+		if err != nil {
+			if !dryRun {
+				audit.record(r, "import", nil, err)
+			}
+			writeJSON(w, http.StatusBadRequest, ImportResponse{Message: err.Error()})
+			return
+		}
+		if !dryRun {
+			audit.record(r, "import", changedKeys(result.Changes), nil)
+		}
+
+		message := "配置包已导入，重启后生效"
+		if dryRun {
+			message = "预览完成，未写入任何文件"
+		}
+		writeJSON(w, http.StatusOK, ImportResponse{OK: true, Message: message, Result: result})
+	})
+}
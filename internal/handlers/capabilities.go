@@ -0,0 +1,154 @@
+package handlers
+
+import "strings"
+
+const (
+	modelKindChat       = "chat"
+	modelKindEmbedding  = "embedding"
+	modelKindAudio      = "audio"
+	modelKindImage      = "image"
+	modelKindModeration = "moderation"
+	modelKindCompletion = "completion"
+)
+
+type ModelInfo struct {
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Tools  bool   `json:"tools"`
+	Vision bool   `json:"vision"`
+}
+
+type ModelFilter struct {
+	ChatOnly bool `json:"chatOnly"`
+	Tools    bool `json:"tools"`
+	Vision   bool `json:"vision"`
+}
+
+// Providers rarely report capabilities in their list endpoints, so they are
+// inferred from well-known model id fragments.
+var (
+	nonChatFragments = []struct {
+		fragment string
+		kind     string
+	}{
+		{"embed", modelKindEmbedding},
+		{"rerank", modelKindEmbedding},
+		{"whisper", modelKindAudio},
+		{"tts", modelKindAudio},
+		{"transcribe", modelKindAudio},
+		{"speech", modelKindAudio},
+		{"audio", modelKindAudio},
+		{"dall-e", modelKindImage},
+		{"gpt-image", modelKindImage},
+		{"imagen", modelKindImage},
+		{"stable-diffusion", modelKindImage},
+		{"flux", modelKindImage},
+		{"moderation", modelKindModeration},
+		{"guard", modelKindModeration},
+		{"davinci", modelKindCompletion},
+		{"babbage", modelKindCompletion},
+		{"turbo-instruct", modelKindCompletion},
+	}
+	visionFragments = []string{
+		"vision", "-vl", "vl-", "4o", "gpt-4.1", "gpt-4-turbo", "gpt-5", "o1", "o3", "o4",
+		"claude-3", "claude-sonnet", "claude-opus", "gemini", "pixtral", "llava", "glm-4v",
+		"moonshot-v1-vision", "minimax-vl", "qwen-vl", "qvq",
+	}
+	noToolFragments = []string{"o1-mini", "o1-preview", "deepseek-reasoner", "gemma"}
+)
+
+func classifyModel(id string) ModelInfo {
+	lower := strings.ToLower(id)
+	info := ModelInfo{ID: id, Kind: modelKindChat}
+	for _, item := range nonChatFragments {
+		if strings.Contains(lower, item.fragment) {
+			info.Kind = item.kind
+			return info
+		}
+	}
+	info.Tools = !containsAny(lower, noToolFragments)
+	info.Vision = containsAny(lower, visionFragments)
+	return info
+}
+
+// classifyGeminiModel uses the generation methods Gemini does report:
+// generateContent means chat, embedContent alone means embeddings.
+func classifyGeminiModel(id string, methods []string) ModelInfo {
+	info := classifyModel(id)
+	if len(methods) == 0 {
+		return info
+	}
+	if !containsString(methods, "generateContent") {
+		if info.Kind == modelKindChat {
+			info.Kind = modelKindEmbedding
+		}
+		info.Tools = false
+		info.Vision = false
+	}
+	return info
+}
+
+// classifyCohereModel trusts the endpoints and features Cohere reports.
+func classifyCohereModel(id string, endpoints, features []string) ModelInfo {
+	info := ModelInfo{ID: id, Kind: modelKindCompletion}
+	switch {
+	case containsString(endpoints, "chat"):
+		info.Kind = modelKindChat
+	case containsString(endpoints, "embed"), containsString(endpoints, "rerank"):
+		info.Kind = modelKindEmbedding
+	}
+	if info.Kind == modelKindChat {
+		info.Tools = containsString(features, "tools")
+		info.Vision = containsString(features, "vision")
+	}
+	return info
+}
+
+func (f ModelFilter) match(info ModelInfo) bool {
+	if (f.ChatOnly || f.Tools || f.Vision) && info.Kind != modelKindChat {
+		return false
+	}
+	if f.Tools && !info.Tools {
+		return false
+	}
+	if f.Vision && !info.Vision {
+		return false
+	}
+	return true
+}
+
+func filterModels(models []ModelInfo, filter ModelFilter) []ModelInfo {
+	result := make([]ModelInfo, 0, len(models))
+	for _, info := range models {
+		if filter.match(info) {
+			result = append(result, info)
+		}
+	}
+	return result
+}
+
+func modelIDs(models []ModelInfo) []string {
+	ids := make([]string, 0, len(models))
+	for _, info := range models {
+		ids = append(ids, info.ID)
+	}
+	return ids
+}
+
+func containsAny(value string, fragments []string) bool {
+	for _, fragment := range fragments {
+		if strings.Contains(value, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
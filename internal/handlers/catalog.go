@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ModelCatalog remembers the last model list fetched for each provider and
+// endpoint so model references can still be checked when the provider is
+// unreachable. It is persisted to disk when a path is given.
+type ModelCatalog struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]catalogEntry
+	cache   *modelCache
+}
+
+type catalogEntry struct {
+	Models    []string  `json:"models"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// NewModelCatalog sends provider requests through client, or a default
+// client when it is nil.
+func NewModelCatalog(path string, client *http.Client) *ModelCatalog {
+	if client == nil {
+		client, _ = NewOutboundClient(OutboundConfig{})
+	}
+	catalog := &ModelCatalog{path: path, entries: make(map[string]catalogEntry)}
+	fetch := func(src modelSource) ([]ModelInfo, string, error) {
+		return fetchModels(client, src)
+	}
+	catalog.cache = newModelCache(fetch, func(src modelSource, list modelList) {
+		catalog.store(src.catalogKey(), modelIDs(list.Models))
+	})
+	if path == "" {
+		return catalog
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return catalog
+	}
+	if err := json.Unmarshal(content, &catalog.entries); err != nil {
+		log.Printf("ignore model catalog %s: %v", path, err)
+		catalog.entries = make(map[string]catalogEntry)
+	}
+	return catalog
+}
+
+// Lookup returns the last list fetched for the provider at the endpoint
+// creds resolve to.
+func (c *ModelCatalog) Lookup(provider string, creds ProviderCredentials) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[creds.source(provider).catalogKey()]
+	if !ok || len(entry.Models) == 0 {
+		return nil, false
+	}
+	return entry.Models, true
+}
+
+func (c *ModelCatalog) Store(provider string, creds ProviderCredentials, models []string) {
+	c.store(creds.source(provider).catalogKey(), models)
+}
+
+func (c *ModelCatalog) store(key string, models []string) {
+	if len(models) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = catalogEntry{
+		Models:    append([]string(nil), models...),
+		FetchedAt: time.Now().UTC(),
+	}
+	// Base URLs come from clients too, so the catalog keeps only the most
+	// recently fetched lists.
+	for len(c.entries) > maxModelCacheEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for key, entry := range c.entries {
+			if oldestKey == "" || entry.FetchedAt.Before(oldest) {
+				oldestKey, oldest = key, entry.FetchedAt
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+	if c.path == "" {
+		return
+	}
+	if err := c.save(); err != nil {
+		log.Printf("save model catalog: %v", err)
+	}
+}
+
+func (c *ModelCatalog) save() error {
+	payload, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, payload, 0o600)
+}
+
+// Models returns the provider's model list, fetched live unless offline is
+// set, falling back to the cached catalog. The source is "live" or "cache";
+// an empty list with no error means the provider cannot list models.
+func (c *ModelCatalog) Models(provider string, creds ProviderCredentials, offline bool) ([]string, string, error) {
+	var fetchErr error
+	if !offline {
+		list, err := c.list(creds.source(provider))
+		if err == nil && len(list.Models) > 0 {
+			return modelIDs(list.Models), "live", nil
+		}
+		fetchErr = err
+	}
+	if models, ok := c.Lookup(provider, creds); ok {
+		return models, "cache", nil
+	}
+	return nil, "", fetchErr
+}
+
+// list returns the model list for src through the in-memory cache.
+func (c *ModelCatalog) list(src modelSource) (modelList, error) {
+	return c.cache.get(src)
+}
@@ -1,13 +1,14 @@
 package handlers
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
-	"os/exec"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"openclaw-setup/internal/config"
 )
@@ -16,30 +17,80 @@ type ConfigRequest struct {
 	Model        string               `json:"model"`
 	GatewayToken string               `json:"gatewayToken"`
 	Providers    []config.ProviderKey `json:"providers"`
+	DryRun       bool                 `json:"dryRun"`
+	// RewriteLoopback replaces 127.0.0.1 and localhost base URLs with an
+	// address of the Docker host; CheckReachability also tests them from
+	// inside the gateway container.
+	RewriteLoopback   bool `json:"rewriteLoopback,omitempty"`
+	CheckReachability bool `json:"checkReachability,omitempty"`
+	// Fallbacks, Gateway and Channels replace the current ones when set.
+	// Otherwise they are kept, like extra env values, which a save never
+	// changes.
+	Fallbacks []string                `json:"fallbacks,omitempty"`
+	Gateway   *config.GatewaySettings `json:"gateway,omitempty"`
+	Channels  json.RawMessage         `json:"channels,omitempty"`
+	// Force saves a model the provider's list does not include, with a
+	// warning, for lists that are known to be incomplete.
+	Force bool `json:"force,omitempty"`
+	// replaceProviders makes Providers the whole list, as for a draft that
+	// carries every provider; a request from a client adds to the list.
+	replaceProviders bool
 }
 
 type ConfigResponse struct {
-	OK           bool   `json:"ok"`
-	Restarted    bool   `json:"restarted"`
-	Message      string `json:"message"`
-	RestartError string `json:"restartError,omitempty"`
+	OK           bool                    `json:"ok"`
+	Restarted    bool                    `json:"restarted"`
+	Message      string                  `json:"message"`
+	RestartError string                  `json:"restartError,omitempty"`
+	DryRun       bool                    `json:"dryRun,omitempty"`
+	Changes      []config.FileChange     `json:"changes,omitempty"`
+	Errors       config.ValidationErrors `json:"errors,omitempty"`
+	ModelCheck   *ModelCheck             `json:"modelCheck,omitempty"`
+	Suggestions  []string                `json:"suggestions,omitempty"`
+	Reachability []ReachabilityCheck     `json:"reachability,omitempty"`
+	// Revision is the configuration revision after a save, or the current
+	// one when a save was refused as stale.
+	Revision string `json:"revision,omitempty"`
 }
 
 type ConfigHandler struct {
 	composeDir    string
 	configDir     string
 	containerName string
+	runtime       ContainerRuntime
+	catalog       *ModelCatalog
+	offline       bool
+	proxyEnv      *config.ProxySettings
+	gatewayToken  string
+	audit         *AuditLog
 }
 
-func NewConfigHandler(cfg ServerConfig) http.Handler {
+func NewConfigHandler(cfg ServerConfig, catalog *ModelCatalog, audit *AuditLog) http.Handler {
+	return newConfigHandler(cfg, catalog, audit)
+}
+
+func newConfigHandler(cfg ServerConfig, catalog *ModelCatalog, audit *AuditLog) *ConfigHandler {
+	if cfg.Runtime == nil {
+		cfg.Runtime = DockerRuntime{}
+	}
 	return &ConfigHandler{
 		composeDir:    cfg.ComposeDir,
 		configDir:     cfg.ConfigDir,
 		containerName: cfg.ContainerName,
+		runtime:       cfg.Runtime,
+		catalog:       catalog,
+		offline:       cfg.Offline,
+		proxyEnv:      cfg.ProxyEnv,
+		gatewayToken:  cfg.GatewayToken,
+		audit:         audit,
 	}
 }
 
 func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		h.serveSnapshot(w)
+		return
+	}
 	if r.Method != http.MethodPost {
 		writeJSON(w, http.StatusMethodNotAllowed, ConfigResponse{
 			OK:      false,
@@ -56,92 +107,354 @@ func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	h.save(w, r, req, r.Header.Get("If-Match"), "config.save")
+}
 
+// save validates req and then previews or writes it, restarting once after
+// a write. It answers the request itself and reports whether the
+// configuration was written, which a draft apply needs to know.
+func (h *ConfigHandler) save(w http.ResponseWriter, r *http.Request, req ConfigRequest, ifMatch, action string) bool {
+	w, r, secrets := requestSecrets(w, r)
 	model := strings.TrimSpace(req.Model)
 	if model == "" {
 		writeJSON(w, http.StatusBadRequest, ConfigResponse{
 			OK:      false,
 			Message: "model is required",
 		})
-		return
+		return false
 	}
 
-	token := strings.TrimSpace(req.GatewayToken)
-	if token == "" {
-		token = generateToken()
+	// A provider counts as configured with a key, or with a base URL for
+	// keyless local runtimes such as Ollama.
+	providers := make(map[string]ProviderCredentials)
+	for _, provider := range req.Providers {
+		id := provider.ID()
+		value := strings.TrimSpace(provider.Value)
+		baseUrl := strings.TrimSpace(provider.BaseUrl)
+		if id == "" || (value == "" && baseUrl == "") {
+			continue
+		}
+		secrets.Add(value)
+		providers[id] = ProviderCredentials{
+			ApiKey:  value,
+			Region:  provider.Region,
+			BaseUrl: baseUrl,
+			Api:     strings.TrimSpace(provider.Api),
+		}
 	}
+	modelCheck, err := CheckModelRef(h.catalog, model, providers, h.offline, req.Force)
+	if err != nil {
+		resp := ConfigResponse{OK: false, Message: err.Error()}
+		var refErr *ModelRefError
+		if errors.As(err, &refErr) {
+			resp.Suggestions = refErr.Suggestions
+		}
+		writeJSON(w, http.StatusBadRequest, resp)
+		return false
+	}
+	model = modelCheck.Model
 
-	if err := config.WriteConfigAndEnv(config.WriteOptions{
-		ConfigDir:    h.configDir,
-		Model:        model,
-		GatewayToken: token,
-		Providers:    req.Providers,
-	}); err != nil {
-		writeJSON(w, http.StatusInternalServerError, ConfigResponse{
-			OK:      false,
-			Message: err.Error(),
+	// The model check above ran from the setup server; the gateway reaches
+	// the same base URLs from inside its container.
+	reachOpts := ReachabilityOptions{Rewrite: req.RewriteLoopback}
+	if req.CheckReachability {
+		reachOpts.Runtime = h.runtime
+		reachOpts.Container = h.containerName
+	}
+	reachability, writeProviders := CheckReachability(r.Context(), req.Providers, reachOpts)
+
+	token, err := h.resolveToken(req.GatewayToken)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ConfigResponse{OK: false, Message: err.Error()})
+		return false
+	}
+	secrets.Add(token)
+
+	if req.DryRun {
+		if !h.checkRevision(w, ifMatch) {
+			return false
+		}
+		writeOpts, err := h.writeOptions(req, model, token, writeProviders)
+		if err != nil {
+			writeConfigError(w, http.StatusInternalServerError, err)
+			return false
+		}
+		changes, err := config.PreviewConfigAndEnv(writeOpts)
+		if err != nil {
+			writeConfigError(w, http.StatusBadRequest, err)
+			return false
+		}
+		writeJSON(w, http.StatusOK, ConfigResponse{
+			OK:           true,
+			Message:      "预览完成，未写入任何文件",
+			DryRun:       true,
+			Changes:      changes,
+			ModelCheck:   &modelCheck,
+			Reachability: reachability,
 		})
-		return
+		return false
 	}
 
-	restarted, restartErr := restartContainer(h.containerName, h.composeDir)
+	// The lock is held across the revision check, the write and the restart
+	// so concurrent saves, or a save during init, cannot interleave.
+	unlock, err := config.LockComposeDir(h.lockDir())
+	if err != nil {
+		writeConfigError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	defer unlock()
+	if !h.checkRevision(w, ifMatch) {
+		return false
+	}
+	writeOpts, err := h.writeOptions(req, model, token, writeProviders)
+	if err != nil {
+		writeConfigError(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	// The preview is only used for the audit trail: it names the keys the
+	// write is about to change.
+	pending, _ := config.PreviewConfigAndEnv(writeOpts)
+	keys := changedKeys(pending)
+
+	if err := config.WriteConfigAndEnv(writeOpts); err != nil {
+		configSavesTotal.inc(auditOutcomeFailure)
+		h.audit.record(r, action, keys, err)
+		writeConfigError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	configSavesTotal.inc(auditOutcomeSuccess)
+	// What was written is now part of the config dir, so it is redacted
+	// for every later request too.
+	config.Secrets.AddFromConfigDir(h.configDir)
+
+	restartStart := time.Now()
+	restarted, restartErr := h.restart(context.WithoutCancel(r.Context()))
+	if restarted || restartErr != nil {
+		outcome := auditOutcomeSuccess
+		if restartErr != nil {
+			outcome = auditOutcomeFailure
+		}
+		restartDuration.observe(time.Since(restartStart), outcome)
+	}
+	h.audit.record(r, action, keys, restartErr)
 	resp := ConfigResponse{
-		OK:        restartErr == nil,
-		Restarted: restarted,
-		Message:   "配置已保存",
+		OK:           restartErr == nil,
+		Restarted:    restarted,
+		Message:      "配置已保存",
+		ModelCheck:   &modelCheck,
+		Reachability: reachability,
 	}
 	if restartErr != nil {
 		resp.OK = false
 		resp.Message = "配置已保存，但重启失败"
 		resp.RestartError = restartErr.Error()
 	}
+	if revision, err := config.ConfigRevision(h.configDir); err == nil {
+		resp.Revision = revision
+		w.Header().Set("ETag", quoteETag(revision))
+	}
 
 	writeJSON(w, http.StatusOK, resp)
+	return true
 }
 
-func restartContainer(_ string, composeDir string) (bool, error) {
-	if strings.TrimSpace(composeDir) == "" {
-		return false, nil
+// writeOptions starts from what is on disk, so a save keeps what it does
+// not edit, such as the channels, fallbacks and other providers written by
+// apply. For a write it is called under the config lock.
+func (h *ConfigHandler) writeOptions(req ConfigRequest, model, token string, providers []config.ProviderKey) (config.WriteOptions, error) {
+	opts, err := config.CurrentWriteOptions(h.configDir)
+	if err != nil {
+		return config.WriteOptions{}, err
+	}
+	opts.Model = model
+	opts.GatewayToken = token
+	if req.replaceProviders {
+		opts.Providers = providers
+	} else {
+		opts.MergeProviders(providers)
 	}
+	opts.Proxy = h.proxyEnv
+	if req.Fallbacks != nil {
+		opts.Fallbacks = req.Fallbacks
+	} else if dropped := opts.PruneFallbacks(); len(dropped) > 0 {
+		// Fallbacks given in the request are checked by the writer
+		// instead, so the client learns about them.
+		slog.Default().Info("drop fallbacks of unconfigured providers", "fallbacks", dropped)
+	}
+	if req.Gateway != nil {
+		opts.Gateway = *req.Gateway
+	}
+	switch {
+	case string(req.Channels) == "null":
+		opts.Channels = nil
+	case len(req.Channels) > 0:
+		opts.Channels = req.Channels
+	}
+	return opts, nil
+}
 
-	if err := chownDataDir(composeDir); err != nil {
-		return false, err
+// writeConfigError reports validation failures as 400 with every problem
+// listed, and anything else with the given status.
+func writeConfigError(w http.ResponseWriter, status int, err error) {
+	var validationErrs config.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		writeJSON(w, http.StatusBadRequest, ConfigResponse{
+			OK:      false,
+			Message: "配置校验失败",
+			Errors:  validationErrs,
+		})
+		return
 	}
+	writeJSON(w, status, ConfigResponse{
+		OK:      false,
+		Message: err.Error(),
+	})
+}
 
-	downCmd := exec.Command("docker", "compose", "down")
-	downCmd.Dir = composeDir
-	if err := downCmd.Run(); err != nil {
-		return false, err
+// serveSnapshot answers GET with the redacted configuration and its
+// revision as the ETag, for use in If-Match on the next save.
+func (h *ConfigHandler) serveSnapshot(w http.ResponseWriter) {
+	snapshot, err := config.ReadConfigSnapshot(h.configDir)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ConfigResponse{OK: false, Message: err.Error()})
+		return
 	}
+	w.Header().Set("ETag", quoteETag(snapshot.Revision))
+	writeJSON(w, http.StatusOK, snapshot)
+}
 
-	upCmd := exec.Command("docker", "compose", "up", "-d")
-	upCmd.Dir = composeDir
-	if err := upCmd.Run(); err != nil {
-		return false, err
+// checkRevision enforces If-Match, answering 409 with the current revision
+// when the client edited an older configuration. Requests without If-Match
+// are not checked.
+func (h *ConfigHandler) checkRevision(w http.ResponseWriter, ifMatch string) bool {
+	if strings.TrimSpace(ifMatch) == "" {
+		return true
+	}
+	revision, err := config.ConfigRevision(h.configDir)
+	if err != nil {
+		writeConfigError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if matchesRevision(ifMatch, revision) {
+		return true
+	}
+	w.Header().Set("ETag", quoteETag(revision))
+	writeJSON(w, http.StatusConflict, ConfigResponse{
+		OK:       false,
+		Message:  "配置已被其他人修改，请刷新后重试",
+		Revision: revision,
+	})
+	return false
+}
+
+// lockDir is the directory whose config lock guards this handler's
+// writes: the compose dir, or the config dir when there is none.
+func (h *ConfigHandler) lockDir() string {
+	if h.composeDir != "" {
+		return h.composeDir
+	}
+	return h.configDir
+}
+
+func quoteETag(revision string) string {
+	return `"` + revision + `"`
+}
+
+// matchesRevision reports whether an If-Match value names revision. It
+// accepts "*", lists, and weak or unquoted tags.
+func matchesRevision(ifMatch, revision string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.Trim(strings.TrimPrefix(tag, "W/"), `"`) == revision {
+			return true
+		}
 	}
+	return false
+}
 
+// restart recreates the containers; there is nothing to restart without a
+// compose dir.
+func (h *ConfigHandler) restart(ctx context.Context) (bool, error) {
+	if strings.TrimSpace(h.composeDir) == "" {
+		return false, nil
+	}
+	if err := h.runtime.Restart(ctx, h.composeDir); err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
-func chownDataDir(composeDir string) error {
-	dataDir := filepath.Join(composeDir, "data")
-	chownCmd := exec.Command("chown", "-R", "1000:1000", dataDir)
-	if err := chownCmd.Run(); err != nil {
-		return err
+// resolveToken is the requested token, else the one given to the server,
+// else the one already configured so paired clients keep working, else a
+// new one.
+func (h *ConfigHandler) resolveToken(requested string) (string, error) {
+	if token := strings.TrimSpace(requested); token != "" {
+		return token, nil
+	}
+	if h.gatewayToken != "" {
+		return h.gatewayToken, nil
+	}
+	if h.composeDir != "" {
+		token, _, err := config.ExistingGatewayToken(h.composeDir)
+		if err != nil {
+			return "", err
+		}
+		if token != "" {
+			return token, nil
+		}
+	}
+	return config.GenerateGatewayToken()
+}
+
+// secretsWriter carries the redactor of one request to writeJSON.
+type secretsWriter struct {
+	http.ResponseWriter
+	secrets *config.SecretSet
+}
+
+type secretsContextKey struct{}
+
+// requestSecrets scopes a redactor to one request. Values the client sent
+// are added to it rather than to config.Secrets, which only holds what was
+// read from the config dir, so a client cannot make a string disappear
+// from everyone else's responses. A w that already carries one keeps it.
+func requestSecrets(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, *config.SecretSet) {
+	if scoped, ok := w.(*secretsWriter); ok {
+		return w, r, scoped.secrets
 	}
-	return nil
+	secrets := config.Secrets.Scoped()
+	r = r.WithContext(context.WithValue(r.Context(), secretsContextKey{}, secrets))
+	return &secretsWriter{ResponseWriter: w, secrets: secrets}, r, secrets
 }
 
-func generateToken() string {
-	bytes := make([]byte, 24)
-	if _, err := rand.Read(bytes); err != nil {
-		return ""
+// redactorFor returns the request's redactor, or config.Secrets when the
+// request has none.
+func redactorFor(ctx context.Context) *config.SecretSet {
+	if secrets, ok := ctx.Value(secretsContextKey{}).(*config.SecretSet); ok {
+		return secrets
 	}
-	return hex.EncodeToString(bytes)
+	return config.Secrets
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload interface{}) {
+	// Secrets are scrubbed from the encoded body, so HTML escaping is off to
+	// keep query strings such as ?key=...&x=... intact for the patterns.
+	var body strings.Builder
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(payload); err != nil {
+		http.Error(w, "encode response", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(payload)
+	secrets := config.Secrets
+	if scoped, ok := w.(*secretsWriter); ok {
+		secrets = scoped.secrets
+	}
+	_, _ = io.WriteString(w, secrets.Redact(body.String()))
 }
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"openclaw-setup/internal/config"
+)
+
+// applyMultiProviderState writes what apply would for a state with
+// fallbacks on two other providers, then adds keys the writer does not
+// manage: plugins, a provider header and a tuned model entry.
+func applyMultiProviderState(t *testing.T) (composeDir, configDir string) {
+	t.Helper()
+	composeDir = t.TempDir()
+	configDir = filepath.Join(composeDir, "data", "conf")
+	state := config.DesiredState{
+		Model:     "openai/gpt-4o",
+		Fallbacks: []string{"anthropic/claude-sonnet-4-5", "ollama/llama3"},
+		Providers: []config.StateProvider{
+			{ID: "openai", ApiKey: "sk-openai-state-key-0001"},
+			{ID: "anthropic", ApiKey: "anthropic-state-key-0001"},
+			{ID: "ollama", BaseUrl: "http://172.17.0.1:11434/v1"},
+		},
+		Gateway: config.StateGateway{Token: "state-gateway-token-0001"},
+	}
+	opts, err := state.WriteOptions(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.WriteConfigAndEnv(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(configDir, "openclaw.json")
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	doc["plugins"] = map[string]any{"entries": map[string]any{"memory": map[string]any{"enabled": true}}}
+	ollama := doc["models"].(map[string]any)["providers"].(map[string]any)["ollama"].(map[string]any)
+	ollama["headers"] = map[string]any{"X-Team": "setup"}
+	entry := ollama["models"].([]any)[0].(map[string]any)
+	entry["contextWindow"] = 32768
+	entry["maxTokens"] = 4096
+	entry["reasoning"] = true
+	content, err = json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return composeDir, configDir
+}
+
+func postConfig(t *testing.T, handler http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/config", strings.NewReader(body)))
+	return rec
+}
+
+func TestSaveOneProviderKeepsTheOthers(t *testing.T) {
+	composeDir, configDir := applyMultiProviderState(t)
+	cfg := ServerConfig{ComposeDir: composeDir, ConfigDir: configDir, Offline: true, Runtime: &fakeRuntime{}}
+	handler := newConfigHandler(cfg, NewModelCatalog("", nil), nil)
+
+	rec := postConfig(t, handler, `{"model":"openai/gpt-4o-mini","providers":[{"key":"OPENAI_API_KEY","value":"sk-openai-new-key-0002"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", rec.Code, rec.Body)
+	}
+
+	env, err := os.ReadFile(filepath.Join(configDir, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"OPENAI_API_KEY=sk-openai-new-key-0002", "ANTHROPIC_API_KEY=anthropic-state-key-0001"} {
+		if !strings.Contains(string(env), want) {
+			t.Errorf(".env lacks %s:\n%s", want, env)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Plugins map[string]any `json:"plugins"`
+		Agents  struct {
+			Defaults struct {
+				Model struct {
+					Primary   string   `json:"primary"`
+					Fallbacks []string `json:"fallbacks"`
+				} `json:"model"`
+			} `json:"defaults"`
+		} `json:"agents"`
+		Models struct {
+			Providers map[string]struct {
+				Headers map[string]string `json:"headers"`
+				Models  []struct {
+					ID            string `json:"id"`
+					ContextWindow int    `json:"contextWindow"`
+					Reasoning     bool   `json:"reasoning"`
+				} `json:"models"`
+			} `json:"providers"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Agents.Defaults.Model.Primary != "openai/gpt-4o-mini" {
+		t.Errorf("primary = %q", doc.Agents.Defaults.Model.Primary)
+	}
+	if got := strings.Join(doc.Agents.Defaults.Model.Fallbacks, ","); got != "anthropic/claude-sonnet-4-5,ollama/llama3" {
+		t.Errorf("fallbacks = %q, want both kept", got)
+	}
+	if doc.Plugins == nil {
+		t.Error("plugins were dropped")
+	}
+	ollama, ok := doc.Models.Providers["ollama"]
+	if !ok {
+		t.Fatalf("the ollama block was dropped:\n%s", content)
+	}
+	if ollama.Headers["X-Team"] != "setup" {
+		t.Errorf("ollama headers = %v, want them kept", ollama.Headers)
+	}
+	if len(ollama.Models) != 1 || ollama.Models[0].ContextWindow != 32768 || !ollama.Models[0].Reasoning {
+		t.Errorf("ollama models = %+v, want the tuned entry kept", ollama.Models)
+	}
+}
+
+func TestSaveRejectsFallbacksOfUnconfiguredProviders(t *testing.T) {
+	composeDir, configDir := applyMultiProviderState(t)
+	cfg := ServerConfig{ComposeDir: composeDir, ConfigDir: configDir, Offline: true, Runtime: &fakeRuntime{}}
+	handler := newConfigHandler(cfg, NewModelCatalog("", nil), nil)
+
+	rec := postConfig(t, handler, `{"model":"openai/gpt-4o","fallbacks":["mistral/mistral-large"],"providers":[{"key":"OPENAI_API_KEY","value":"sk-openai-new-key-0002"}]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "fallbacks[0]") {
+		t.Errorf("save: %d %s, want a validation error on the fallback", rec.Code, rec.Body)
+	}
+
+	// A draft that removes a provider drops it from the write, so its
+	// fallback must go too.
+	store := mustDraftStore(t)
+	drafts := NewDraftHandler(cfg, store, handler, nil)
+	if rec := serveDraft(t, drafts, http.MethodPatch, "/api/draft", `{"removeProviders":["anthropic"]}`); rec.Code != http.StatusOK {
+		t.Fatalf("edit: %d %s", rec.Code, rec.Body)
+	}
+	rec = serveDraft(t, drafts, http.MethodPost, "/api/draft/apply", "")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "provider anthropic is not configured") {
+		t.Errorf("apply: %d %s, want the fallback on anthropic rejected", rec.Code, rec.Body)
+	}
+}
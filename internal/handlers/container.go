@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrContainerNotRunning is returned by Probe and Env when the gateway
+// container is not up, so nothing can be tested from its network.
+var ErrContainerNotRunning = errors.New("container is not running")
+
+// ContainerRuntime is how the setup server acts on the OpenClaw containers.
+// DockerRuntime drives the docker CLI; tests substitute a fake.
+type ContainerRuntime interface {
+	// Restart recreates the compose project so new configuration is loaded.
+	Restart(ctx context.Context, composeDir string) error
+	// Probe opens rawURL from inside the network namespace of container and
+	// returns nil if any HTTP response came back.
+	Probe(ctx context.Context, container, rawURL string) error
+	// Env returns the value of key in the environment container was
+	// started with, or "" when it is not set.
+	Env(ctx context.Context, container, key string) (string, error)
+}
+
+// DockerRuntime implements ContainerRuntime with the docker CLI.
+type DockerRuntime struct{}
+
+func (DockerRuntime) Restart(ctx context.Context, composeDir string) error {
+	if err := chownDataDir(composeDir); err != nil {
+		return err
+	}
+	if err := runDocker(ctx, composeDir, "compose", "down"); err != nil {
+		return err
+	}
+	return runDocker(ctx, composeDir, "compose", "up", "-d")
+}
+
+// probeScript fetches a URL with the Node runtime the gateway image ships
+// with, since curl and wget are not guaranteed to be there. Any response
+// counts: reachability is the question, not the status.
+const probeScript = `fetch(process.argv[1],{signal:AbortSignal.timeout(5000)}).then(()=>process.exit(0),(e)=>{console.error(e.cause?e.cause.message:e.message);process.exit(1)})`
+
+func (DockerRuntime) Probe(ctx context.Context, container, rawURL string) error {
+	state, err := outputDocker(ctx, "", "inspect", "--format", "{{.State.Running}}", container)
+	if err != nil || strings.TrimSpace(state) != "true" {
+		return ErrContainerNotRunning
+	}
+	return runDocker(ctx, "", "exec", container, "node", "-e", probeScript, rawURL)
+}
+
+func (DockerRuntime) Env(ctx context.Context, container, key string) (string, error) {
+	output, err := outputDocker(ctx, "", "inspect", "--format", "{{.State.Running}}\n{{range .Config.Env}}{{println .}}{{end}}", container)
+	if err != nil {
+		return "", err
+	}
+	state, env, _ := strings.Cut(output, "\n")
+	if strings.TrimSpace(state) != "true" {
+		return "", ErrContainerNotRunning
+	}
+	for _, line := range strings.Split(env, "\n") {
+		if name, value, ok := strings.Cut(line, "="); ok && name == key {
+			return value, nil
+		}
+	}
+	return "", nil
+}
+
+func runDocker(ctx context.Context, dir string, args ...string) error {
+	_, err := outputDocker(ctx, dir, args...)
+	return err
+}
+
+// outputDocker runs docker and returns stdout, folding stderr into the
+// error so failures say why.
+func outputDocker(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			return "", fmt.Errorf("docker %s: %s", args[0], detail)
+		}
+		return "", fmt.Errorf("docker %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+func chownDataDir(composeDir string) error {
+	dataDir := filepath.Join(composeDir, "data")
+	chownCmd := exec.Command("chown", "-R", "1000:1000", dataDir)
+	if err := chownCmd.Run(); err != nil {
+		return err
+	}
+	return nil
+}
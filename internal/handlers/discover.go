@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+const (
+	discoverTimeout = 2 * time.Second
+	dockerHostName  = "host.docker.internal"
+)
+
+// LocalRuntime is a model server that usually runs on the Docker host.
+// ModelsPath answers with the runtime's model list; BasePath is appended to
+// the host to form the base URL the gateway should use.
+type LocalRuntime struct {
+	ID         string
+	Name       string
+	Port       int
+	ModelsPath string
+	BasePath   string
+	// Provider is the models.providers id to configure. Runtimes other than
+	// Ollama are configured as custom providers under their own id.
+	Provider string
+	parse    func(body []byte) ([]string, bool)
+}
+
+var localRuntimes = []LocalRuntime{
+	{ID: "ollama", Name: "Ollama", Port: 11434, ModelsPath: "/api/tags", BasePath: "/v1", Provider: "ollama", parse: parseOllamaTags},
+	{ID: "lmstudio", Name: "LM Studio", Port: 1234, ModelsPath: "/v1/models", BasePath: "/v1", Provider: "lmstudio", parse: parseOpenAIModelIDs},
+	{ID: "llamacpp", Name: "llama.cpp server", Port: 8080, ModelsPath: "/v1/models", BasePath: "/v1", Provider: "llamacpp", parse: parseOpenAIModelIDs},
+	{ID: "vllm", Name: "vLLM", Port: 8000, ModelsPath: "/v1/models", BasePath: "/v1", Provider: "vllm", parse: parseOpenAIModelIDs},
+}
+
+// DiscoveredRuntime is a runtime that answered. BaseUrl is the address the
+// gateway container should use, which for a runtime found on loopback is a
+// host alias that answered from inside the container; Reachability tells
+// how that was decided.
+type DiscoveredRuntime struct {
+	Runtime      string             `json:"runtime"`
+	Name         string             `json:"name"`
+	Host         string             `json:"host"`
+	BaseUrl      string             `json:"baseUrl"`
+	Provider     string             `json:"provider"`
+	Models       []string           `json:"models"`
+	Reachability *ReachabilityCheck `json:"reachability,omitempty"`
+}
+
+type DiscoverResponse struct {
+	Runtimes []DiscoveredRuntime `json:"runtimes"`
+	Hosts    []string            `json:"hosts"`
+	Message  string              `json:"message,omitempty"`
+}
+
+// NewDiscoverHandler serves GET /api/discover. Requests go straight to the
+// local hosts, never through the outbound proxy. The base URLs found are
+// then checked from the gateway container named in cfg.
+func NewDiscoverHandler(cfg ServerConfig) http.Handler {
+	if cfg.Runtime == nil {
+		cfg.Runtime = DockerRuntime{}
+	}
+	reachOpts := ReachabilityOptions{Rewrite: true, Runtime: cfg.Runtime, Container: cfg.ContainerName}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	client := &http.Client{Transport: transport, Timeout: discoverTimeout}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, DiscoverResponse{Message: "method not allowed"})
+			return
+		}
+		hosts := DiscoveryHosts(r.Context())
+		found := DiscoverRuntimes(r.Context(), client, hosts, localRuntimes)
+		found = checkDiscovered(r.Context(), found, reachOpts)
+		resp := DiscoverResponse{Runtimes: found, Hosts: hosts}
+		if len(found) == 0 {
+			resp.Message = "未发现本地模型服务"
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// DiscoveryHosts lists where local runtimes may listen: loopback, the
+// Docker bridge gateway and host.docker.internal when it resolves.
+func DiscoveryHosts(ctx context.Context) []string {
+	hosts := []string{"127.0.0.1"}
+	if gateway := dockerBridgeGateway(); gateway != "" {
+		hosts = append(hosts, gateway)
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, discoverTimeout)
+	defer cancel()
+	if addrs, err := net.DefaultResolver.LookupHost(lookupCtx, dockerHostName); err == nil && len(addrs) > 0 {
+		hosts = append(hosts, dockerHostName)
+	}
+	return hosts
+}
+
+// DiscoverRuntimes probes every runtime on every host concurrently and
+// returns the ones that answered with a model list, ordered by host and
+// then runtime.
+func DiscoverRuntimes(ctx context.Context, client *http.Client, hosts []string, runtimes []LocalRuntime) []DiscoveredRuntime {
+	type hit struct {
+		hostIndex, runtimeIndex int
+		runtime                 DiscoveredRuntime
+	}
+	var (
+		mu   sync.Mutex
+		hits []hit
+		wg   sync.WaitGroup
+	)
+	for hi, host := range hosts {
+		for ri, runtime := range runtimes {
+			wg.Add(1)
+			go func(hi, ri int, host string, runtime LocalRuntime) {
+				defer wg.Done()
+				found, ok := probeRuntime(ctx, client, host, runtime)
+				if !ok {
+					return
+				}
+				mu.Lock()
+				hits = append(hits, hit{hi, ri, found})
+				mu.Unlock()
+			}(hi, ri, host, runtime)
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].hostIndex != hits[j].hostIndex {
+			return hits[i].hostIndex < hits[j].hostIndex
+		}
+		return hits[i].runtimeIndex < hits[j].runtimeIndex
+	})
+	found := make([]DiscoveredRuntime, 0, len(hits))
+	for _, h := range hits {
+		found = append(found, h.runtime)
+	}
+	return found
+}
+
+// checkDiscovered passes every base URL through CheckReachability, since
+// one found on loopback is the setup server's host but the gateway
+// container's own address. A loopback URL is replaced with the first host
+// alias the container reached; when none could be tested it is kept with
+// the check's warning.
+func checkDiscovered(ctx context.Context, found []DiscoveredRuntime, opts ReachabilityOptions) []DiscoveredRuntime {
+	for i, runtime := range found {
+		checks, providers := CheckReachability(ctx, []config.ProviderKey{{Provider: runtime.Provider, BaseUrl: runtime.BaseUrl}}, opts)
+		if len(checks) == 0 {
+			continue
+		}
+		found[i].BaseUrl = providers[0].BaseUrl
+		found[i].Reachability = &checks[0]
+	}
+	return found
+}
+
+func probeRuntime(ctx context.Context, client *http.Client, host string, runtime LocalRuntime) (DiscoveredRuntime, bool) {
+	origin := "http://" + net.JoinHostPort(host, fmt.Sprint(runtime.Port))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+runtime.ModelsPath, nil)
+	if err != nil {
+		return DiscoveredRuntime{}, false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return DiscoveredRuntime{}, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return DiscoveredRuntime{}, false
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return DiscoveredRuntime{}, false
+	}
+	models, ok := runtime.parse(body)
+	if !ok {
+		return DiscoveredRuntime{}, false
+	}
+	return DiscoveredRuntime{
+		Runtime:  runtime.ID,
+		Name:     runtime.Name,
+		Host:     host,
+		BaseUrl:  origin + runtime.BasePath,
+		Provider: runtime.Provider,
+		Models:   models,
+	}, true
+}
+
+func parseOllamaTags(body []byte) ([]string, bool) {
+	var payload struct {
+		Models *[]struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Models == nil {
+		return nil, false
+	}
+	models := []string{}
+	for _, item := range *payload.Models {
+		if name := strings.TrimSpace(item.Name); name != "" {
+			models = append(models, name)
+		}
+	}
+	return models, true
+}
+
+func parseOpenAIModelIDs(body []byte) ([]string, bool) {
+	var payload struct {
+		Data *[]struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Data == nil {
+		return nil, false
+	}
+	models := []string{}
+	for _, item := range *payload.Data {
+		if id := strings.TrimSpace(item.ID); id != "" {
+			models = append(models, id)
+		}
+	}
+	return models, true
+}
+
+// dockerBridgeGateway returns the address of the Docker host as seen from a
+// container: the docker0 bridge address when running on the host, or the
+// default route's gateway when running inside a container.
+func dockerBridgeGateway() string {
+	if iface, err := net.InterfaceByName("docker0"); err == nil {
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+					return ipNet.IP.String()
+				}
+			}
+		}
+	}
+	if _, err := os.Stat("/.dockerenv"); err != nil {
+		return ""
+	}
+	return defaultRouteGateway("/proc/net/route")
+}
+
+// defaultRouteGateway reads the IPv4 default gateway from a Linux route
+// table, where addresses are little-endian hex.
+func defaultRouteGateway(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		return net.IPv4(raw[3], raw[2], raw[1], raw[0]).String()
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestDiscoverReturnsContainerAddresses finds an Ollama on loopback and
+// expects the base URL the gateway container can reach.
+func TestDiscoverReturnsContainerAddresses(t *testing.T) {
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"models":[{"name":"qwen2.5:7b"}]}`))
+	}))
+	defer ollama.Close()
+	_, portText, err := net.SplitHostPort(strings.TrimPrefix(ollama.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(portText)
+	runtimes := []LocalRuntime{{ID: "ollama", Name: "Ollama", Port: port, ModelsPath: "/api/tags", BasePath: "/v1", Provider: "ollama", parse: parseOllamaTags}}
+	bridge := "http://172.17.0.1:" + portText + "/v1"
+
+	tests := []struct {
+		name        string
+		runtime     *fakeRuntime
+		wantBaseUrl string
+		wantWarning bool
+	}{
+		{
+			name:        "bridge reachable from the container",
+			runtime:     &fakeRuntime{reachable: map[string]bool{bridge: true}},
+			wantBaseUrl: bridge,
+		},
+		{
+			name:        "gateway stopped",
+			runtime:     &fakeRuntime{stopped: true},
+			wantBaseUrl: "http://127.0.0.1:" + portText + "/v1",
+			wantWarning: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := DiscoverRuntimes(context.Background(), ollama.Client(), []string{"127.0.0.1"}, runtimes)
+			found = checkDiscovered(context.Background(), found, ReachabilityOptions{
+				Rewrite:     true,
+				Runtime:     tt.runtime,
+				Container:   "openclaw-gateway",
+				HostAliases: []string{"172.17.0.1", dockerHostName},
+			})
+			if len(found) != 1 || strings.Join(found[0].Models, ",") != "qwen2.5:7b" {
+				t.Fatalf("found = %+v, want the one Ollama model", found)
+			}
+			got := found[0]
+			if got.BaseUrl != tt.wantBaseUrl {
+				t.Errorf("baseUrl = %q, want %q", got.BaseUrl, tt.wantBaseUrl)
+			}
+			if got.Reachability == nil || !got.Reachability.Loopback {
+				t.Fatalf("reachability = %+v, want a loopback check", got.Reachability)
+			}
+			if (got.Reachability.Warning != "" && got.Reachability.Rewritten == "") != tt.wantWarning {
+				t.Errorf("reachability = %+v, want warning %v", got.Reachability, tt.wantWarning)
+			}
+		})
+	}
+}
@@ -0,0 +1,585 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+// Doctor finding severities. Only errors make the report fail.
+const (
+	SeverityOK      = "ok"
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// Automatic fixes the doctor may offer. They only touch data/ and the
+// token copies, and never restart anything, so sync-token is only offered
+// when the token the gateway runs with is known.
+const (
+	DoctorFixChownData = "chown-data"
+	DoctorFixSyncToken = "sync-token"
+)
+
+const (
+	defaultGatewayPort = 18789
+	defaultSetupPort   = 8188
+	dataOwnerUID       = 1000
+	doctorTimeout      = 10 * time.Second
+)
+
+// composeFileNames are the files docker compose looks for, in its order.
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+type DoctorFinding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	// Fix names the automatic fix for this finding, if one is safe.
+	Fix string `json:"fix,omitempty"`
+}
+
+type DoctorReport struct {
+	OK       bool            `json:"ok"`
+	Findings []DoctorFinding `json:"findings"`
+	Fixed    []string        `json:"fixed,omitempty"`
+	Message  string          `json:"message,omitempty"`
+}
+
+// DoctorOptions describe the installation to diagnose.
+type DoctorOptions struct {
+	ComposeDir    string
+	ContainerName string
+	Runtime       ContainerRuntime
+	// Catalog checks provider keys by listing models; nil or Offline
+	// skips that check.
+	Catalog *ModelCatalog
+	Offline bool
+	// ServerAddr is the setup server's own listen address when the doctor
+	// runs inside it, so its port is not reported as taken.
+	ServerAddr string
+}
+
+// Fixes lists the distinct fixes offered by the report, in order.
+func (r DoctorReport) Fixes() []string {
+	var fixes []string
+	seen := make(map[string]bool)
+	for _, finding := range r.Findings {
+		if finding.Fix != "" && !seen[finding.Fix] {
+			seen[finding.Fix] = true
+			fixes = append(fixes, finding.Fix)
+		}
+	}
+	return fixes
+}
+
+type doctor struct {
+	opts        DoctorOptions
+	configDir   string
+	findings    []DoctorFinding
+	dockerOK    bool
+	composeOK   bool
+	gatewayPort int
+}
+
+// RunDoctor checks docker and compose, the compose file, ownership of
+// data/, the gateway and setup ports, openclaw.json, the gateway token
+// copies, provider keys and whether the gateway answers.
+func RunDoctor(ctx context.Context, opts DoctorOptions) DoctorReport {
+	if opts.Runtime == nil {
+		opts.Runtime = DockerRuntime{}
+	}
+	d := &doctor{
+		opts:        opts,
+		configDir:   filepath.Join(opts.ComposeDir, "data", "conf"),
+		gatewayPort: defaultGatewayPort,
+	}
+	d.checkDocker(ctx)
+	d.checkComposeFile(ctx)
+	d.checkDataOwner()
+	d.checkConfig()
+	d.checkPorts(ctx)
+	d.checkTokens(ctx)
+	d.checkProviderKeys()
+	d.checkGateway(ctx)
+
+	report := DoctorReport{OK: true, Findings: d.findings}
+	for _, finding := range d.findings {
+		if finding.Severity == SeverityError {
+			report.OK = false
+		}
+	}
+	return report
+}
+
+func (d *doctor) add(check, severity, fix, format string, args ...interface{}) {
+	d.findings = append(d.findings, DoctorFinding{
+		Check:    check,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Fix:      fix,
+	})
+}
+
+func (d *doctor) checkDocker(ctx context.Context) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		d.add("docker", SeverityError, "", "docker is not installed or not on PATH")
+		d.add("compose", SeverityError, "", "docker compose is not available without docker")
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	version, err := outputDocker(ctx, "", "version", "--format", "{{.Server.Version}}")
+	if err != nil {
+		d.add("docker", SeverityError, "", "docker daemon is not reachable: %v", err)
+	} else {
+		d.dockerOK = true
+		d.add("docker", SeverityOK, "", "docker %s", strings.TrimSpace(version))
+	}
+
+	version, err = outputDocker(ctx, "", "compose", "version", "--short")
+	if err != nil {
+		d.add("compose", SeverityError, "", "docker compose is not available: %v", err)
+		return
+	}
+	d.composeOK = true
+	d.add("compose", SeverityOK, "", "docker compose %s", strings.TrimSpace(version))
+}
+
+func (d *doctor) checkComposeFile(ctx context.Context) {
+	name := ""
+	for _, candidate := range composeFileNames {
+		if _, err := os.Stat(filepath.Join(d.opts.ComposeDir, candidate)); err == nil {
+			name = candidate
+			break
+		}
+	}
+	if name == "" {
+		d.add("compose-file", SeverityError, "", "no compose file in %s", d.opts.ComposeDir)
+		return
+	}
+	if !d.composeOK {
+		d.add("compose-file", SeverityWarning, "", "%s was not validated: docker compose is not available", name)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	if err := runDocker(ctx, d.opts.ComposeDir, "compose", "config", "--quiet"); err != nil {
+		d.add("compose-file", SeverityError, "", "%s is invalid: %v", name, err)
+		return
+	}
+	d.add("compose-file", SeverityOK, "", "%s is valid", name)
+}
+
+// checkDataOwner compares data/ with the UID the gateway runs as, which
+// is what chownDataDir sets before every restart.
+func (d *doctor) checkDataOwner() {
+	dataDir := filepath.Join(d.opts.ComposeDir, "data")
+	info, err := os.Stat(dataDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			d.add("data-owner", SeverityWarning, DoctorFixChownData, "data/ does not exist")
+			return
+		}
+		d.add("data-owner", SeverityError, "", "stat data/: %v", err)
+		return
+	}
+	if _, ok := fileOwner(info); !ok {
+		d.add("data-owner", SeverityInfo, "", "file ownership is not checked on this platform")
+		return
+	}
+
+	var wrong []string
+	count := 0
+	_ = filepath.WalkDir(dataDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if uid, ok := fileOwner(info); ok && uid != dataOwnerUID {
+			count++
+			if len(wrong) < 3 {
+				rel, _ := filepath.Rel(d.opts.ComposeDir, path)
+				wrong = append(wrong, fmt.Sprintf("%s (uid %d)", rel, uid))
+			}
+		}
+		return nil
+	})
+	if count > 0 {
+		d.add("data-owner", SeverityWarning, DoctorFixChownData, "%d path(s) under data/ are not owned by uid %d, e.g. %s", count, dataOwnerUID, strings.Join(wrong, ", "))
+		return
+	}
+	d.add("data-owner", SeverityOK, "", "data/ is owned by uid %d", dataOwnerUID)
+}
+
+func (d *doctor) checkConfig() {
+	path := filepath.Join(d.configDir, "openclaw.json")
+	errs, err := config.ValidateFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			d.add("openclaw-json", SeverityError, "", "openclaw.json does not exist; run init or save from the web UI")
+			return
+		}
+		d.add("openclaw-json", SeverityError, "", "%v", err)
+		return
+	}
+	if len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, item := range errs {
+			messages = append(messages, item.Error())
+		}
+		d.add("openclaw-json", SeverityError, "", "openclaw.json is invalid: %s", strings.Join(messages, "; "))
+		return
+	}
+	if port := configuredGatewayPort(path); port != 0 {
+		d.gatewayPort = port
+	}
+	d.add("openclaw-json", SeverityOK, "", "openclaw.json is valid")
+}
+
+func (d *doctor) checkPorts(ctx context.Context) {
+	gatewayRunning := d.gatewayRunning(ctx)
+	gatewayCheck := fmt.Sprintf("port-%d", d.gatewayPort)
+	switch {
+	case portFree(d.gatewayPort):
+		if gatewayRunning {
+			d.add(gatewayCheck, SeverityWarning, "", "port %d is free although the gateway container is running; check its port mapping", d.gatewayPort)
+		} else {
+			d.add(gatewayCheck, SeverityOK, "", "port %d is free for the gateway", d.gatewayPort)
+		}
+	case gatewayRunning:
+		d.add(gatewayCheck, SeverityOK, "", "port %d is in use by the gateway", d.gatewayPort)
+	case d.opts.ContainerName == "":
+		d.add(gatewayCheck, SeverityWarning, "", "port %d is in use; set OPENCLAW_CONTAINER_NAME to tell whether by the gateway", d.gatewayPort)
+	default:
+		d.add(gatewayCheck, SeverityError, "", "port %d is in use by another process while the gateway is down", d.gatewayPort)
+	}
+
+	setupPort, servedHere := defaultSetupPort, false
+	if _, port, err := net.SplitHostPort(d.opts.ServerAddr); err == nil {
+		if value, err := strconv.Atoi(port); err == nil {
+			setupPort, servedHere = value, true
+		}
+	}
+	setupCheck := fmt.Sprintf("port-%d", setupPort)
+	switch {
+	case servedHere:
+		d.add(setupCheck, SeverityOK, "", "port %d is served by this setup server", setupPort)
+	case portFree(setupPort):
+		d.add(setupCheck, SeverityOK, "", "port %d is free for the setup server", setupPort)
+	default:
+		d.add(setupCheck, SeverityWarning, "", "port %d is in use; another setup server may already be running", setupPort)
+	}
+}
+
+// checkTokens compares every copy of the gateway token. A mismatch locks
+// paired clients out depending on which copy the gateway ends up using.
+func (d *doctor) checkTokens(ctx context.Context) {
+	copies, err := config.GatewayTokenCopies(d.opts.ComposeDir)
+	if err != nil {
+		d.add("gateway-token", SeverityError, "", "%v", err)
+		return
+	}
+	if len(copies) == 0 {
+		d.add("gateway-token", SeverityError, "", "no gateway token is configured; run init or save from the web UI")
+		return
+	}
+	distinct := make(map[string]bool)
+	var parts []string
+	problem := ""
+	for _, item := range copies {
+		if item.Token == "" {
+			problem = item.Source + " is not set"
+			break
+		}
+		distinct[item.Token] = true
+		parts = append(parts, item.Source+" "+item.Fingerprint)
+	}
+	if problem == "" && len(distinct) > 1 {
+		problem = "gateway token copies differ: " + strings.Join(parts, ", ")
+	}
+	if problem == "" {
+		d.add("gateway-token", SeverityOK, "", "%d gateway token copies agree", len(copies))
+		return
+	}
+
+	token, source, err := gatewayTokenInUse(ctx, d.opts)
+	if err != nil {
+		d.add("gateway-token", SeverityError, "", "%s; %v, so make the copies match by hand and restart the gateway", problem, err)
+		return
+	}
+	fingerprint := "matching none of the copies"
+	for _, item := range copies {
+		if item.Token == token {
+			fingerprint = item.Fingerprint
+			break
+		}
+	}
+	d.add("gateway-token", SeverityError, DoctorFixSyncToken, "%s; %s copies the token of %s (%s) to the others, no restart needed", problem, DoctorFixSyncToken, source, fingerprint)
+}
+
+// gatewayTokenInUse is the token the gateway runs with: the one in its
+// container's environment, or, while it is stopped, the one it will be
+// handed on the next start. It fails when that cannot be told, because
+// copying any other token would lock paired clients out once the gateway
+// is restarted, or right away.
+func gatewayTokenInUse(ctx context.Context, opts DoctorOptions) (token, source string, err error) {
+	if opts.ContainerName == "" {
+		return "", "", errors.New("the token the gateway runs with is unknown without OPENCLAW_CONTAINER_NAME")
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	token, err = opts.Runtime.Env(ctx, opts.ContainerName, "OPENCLAW_GATEWAY_TOKEN")
+	switch {
+	case errors.Is(err, ErrContainerNotRunning):
+		token, source, err = config.ExistingGatewayToken(opts.ComposeDir)
+		if err != nil {
+			return "", "", err
+		}
+		if token == "" {
+			return "", "", errors.New("the gateway is stopped and the compose .env has no token")
+		}
+		return token, source + " (the gateway is stopped)", nil
+	case err != nil:
+		return "", "", fmt.Errorf("the token the gateway runs with could not be read: %w", err)
+	case token == "":
+		return "", "", fmt.Errorf("%s does not run with OPENCLAW_GATEWAY_TOKEN, so the token it loaded is unknown", opts.ContainerName)
+	}
+	return token, "the running gateway", nil
+}
+
+func (d *doctor) checkProviderKeys() {
+	configured, err := config.ConfiguredProviders(d.configDir)
+	if err != nil {
+		d.add("providers", SeverityError, "", "%v", err)
+		return
+	}
+	var keyed []config.ConfiguredProvider
+	for _, provider := range configured {
+		if provider.EnvKey != "" && provider.ApiKey != "" {
+			keyed = append(keyed, provider)
+		}
+	}
+	if len(keyed) == 0 {
+		return
+	}
+	if d.opts.Catalog == nil || d.opts.Offline {
+		d.add("providers", SeverityInfo, "", "provider keys were not checked (offline)")
+		return
+	}
+
+	results := make([]DoctorFinding, len(keyed))
+	var wg sync.WaitGroup
+	for i, provider := range keyed {
+		wg.Add(1)
+		go func(i int, provider config.ConfiguredProvider) {
+			defer wg.Done()
+			results[i] = d.checkProviderKey(provider)
+		}(i, provider)
+	}
+	wg.Wait()
+	d.findings = append(d.findings, results...)
+}
+
+func (d *doctor) checkProviderKey(provider config.ConfiguredProvider) DoctorFinding {
+	check := "provider-" + provider.ID
+	config.Secrets.Add(provider.ApiKey)
+	list, err := d.opts.Catalog.list(modelSource{
+		Provider: provider.ID,
+		Region:   provider.Region,
+		BaseUrl:  provider.BaseUrl,
+		Api:      provider.Api,
+		ApiKey:   provider.ApiKey,
+	})
+	if err == nil {
+		if len(list.Models) == 0 {
+			return DoctorFinding{Check: check, Severity: SeverityInfo, Message: fmt.Sprintf("%s cannot list models, so its key was not verified", provider.EnvKey)}
+		}
+		return DoctorFinding{Check: check, Severity: SeverityOK, Message: fmt.Sprintf("%s is valid (%d models)", provider.EnvKey, len(list.Models))}
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		switch providerErr.Code {
+		case ProviderErrInvalidKey, ProviderErrInsufficientQuota, ProviderErrRegionBlocked:
+			return DoctorFinding{Check: check, Severity: SeverityError, Message: fmt.Sprintf("%s: %v", provider.EnvKey, err)}
+		}
+	}
+	return DoctorFinding{Check: check, Severity: SeverityWarning, Message: fmt.Sprintf("%s could not be verified: %v", provider.EnvKey, err)}
+}
+
+// checkGateway asks the gateway for any response: from inside its
+// container when the name is known, else on the local port.
+func (d *doctor) checkGateway(ctx context.Context) {
+	target := fmt.Sprintf("http://127.0.0.1:%d/", d.gatewayPort)
+	if d.opts.ContainerName != "" && d.dockerOK {
+		ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+		defer cancel()
+		err := d.opts.Runtime.Probe(ctx, d.opts.ContainerName, target)
+		switch {
+		case errors.Is(err, ErrContainerNotRunning):
+			d.add("gateway", SeverityError, "", "gateway container %s is not running", d.opts.ContainerName)
+		case err != nil:
+			d.add("gateway", SeverityError, "", "gateway does not answer on port %d inside %s: %v", d.gatewayPort, d.opts.ContainerName, err)
+		default:
+			d.add("gateway", SeverityOK, "", "gateway answers on port %d", d.gatewayPort)
+		}
+		return
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	client := &http.Client{Transport: transport, Timeout: 3 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = client.Do(req); err == nil {
+			resp.Body.Close()
+			d.add("gateway", SeverityOK, "", "gateway answers on %s", target)
+			return
+		}
+	}
+	d.add("gateway", SeverityWarning, "", "gateway does not answer on %s (set OPENCLAW_CONTAINER_NAME to test from its container): %v", target, err)
+}
+
+func (d *doctor) gatewayRunning(ctx context.Context) bool {
+	if d.opts.ContainerName == "" || !d.dockerOK {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	defer cancel()
+	state, err := outputDocker(ctx, "", "inspect", "--format", "{{.State.Running}}", d.opts.ContainerName)
+	return err == nil && strings.TrimSpace(state) == "true"
+}
+
+// ApplyDoctorFixes runs the named fixes and returns those that were
+// applied. Callers hold the compose dir lock.
+func ApplyDoctorFixes(ctx context.Context, opts DoctorOptions, fixes []string) ([]string, error) {
+	if opts.Runtime == nil {
+		opts.Runtime = DockerRuntime{}
+	}
+	for _, fix := range fixes {
+		if !isDoctorFix(fix) {
+			return nil, fmt.Errorf("unknown fix %q", fix)
+		}
+	}
+	var applied []string
+	for _, fix := range fixes {
+		switch fix {
+		case DoctorFixChownData:
+			if err := os.MkdirAll(filepath.Join(opts.ComposeDir, "data"), 0o755); err != nil {
+				return applied, fmt.Errorf("create data dir: %w", err)
+			}
+			if err := chownDataDir(opts.ComposeDir); err != nil {
+				return applied, fmt.Errorf("chown data: %w", err)
+			}
+		case DoctorFixSyncToken:
+			token, _, err := gatewayTokenInUse(ctx, opts)
+			if err != nil {
+				return applied, fmt.Errorf("sync-token: %w", err)
+			}
+			if _, err := config.SyncGatewayToken(opts.ComposeDir, token); err != nil {
+				return applied, err
+			}
+		}
+		applied = append(applied, fix)
+	}
+	return applied, nil
+}
+
+func isDoctorFix(name string) bool {
+	return name == DoctorFixChownData || name == DoctorFixSyncToken
+}
+
+func portFree(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+func configuredGatewayPort(path string) int {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	var cfg struct {
+		Gateway struct {
+			Port int `json:"port"`
+		} `json:"gateway"`
+	}
+	if json.Unmarshal(content, &cfg) != nil {
+		return 0
+	}
+	return cfg.Gateway.Port
+}
+
+// NewDoctorHandler serves /api/doctor: GET reports, POST with
+// {"fixes": [...]} applies the named fixes first and reports again.
+func NewDoctorHandler(cfg ServerConfig, catalog *ModelCatalog, audit *AuditLog) http.Handler {
+	opts := DoctorOptions{
+		ComposeDir:    cfg.ComposeDir,
+		ContainerName: cfg.ContainerName,
+		Runtime:       cfg.Runtime,
+		Catalog:       catalog,
+		Offline:       cfg.Offline,
+		ServerAddr:    cfg.ListenAddr,
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var fixed []string
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var req struct {
+				Fixes []string `json:"fixes"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, DoctorReport{Message: "invalid json"})
+				return
+			}
+			for _, fix := range req.Fixes {
+				if !isDoctorFix(fix) {
+					writeJSON(w, http.StatusBadRequest, DoctorReport{Message: fmt.Sprintf("unknown fix %q", fix)})
+					return
+				}
+			}
+			unlock, err := config.LockComposeDir(cfg.ComposeDir)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, DoctorReport{Message: err.Error()})
+				return
+			}
+			fixed, err = ApplyDoctorFixes(r.Context(), opts, req.Fixes)
+			unlock()
+			audit.record(r, "doctor.fix", fixed, err)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, DoctorReport{Fixed: fixed, Message: err.Error()})
+				return
+			}
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, DoctorReport{Message: "method not allowed"})
+			return
+		}
+
+		report := RunDoctor(r.Context(), opts)
+		report.Fixed = fixed
+		writeJSON(w, http.StatusOK, report)
+	})
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"openclaw-setup/internal/config"
+)
+
+const (
+	composeToken = "compose-env-token-0001"
+	configToken  = "conf-dir-token-0002"
+)
+
+// writeTokenCopies leaves the compose .env with one token and data/conf
+// with another, which openclaw.json also uses for a channel secret.
+func writeTokenCopies(t *testing.T) string {
+	t.Helper()
+	composeDir := t.TempDir()
+	configDir := filepath.Join(composeDir, "data", "conf")
+	if err := os.MkdirAll(configDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(composeDir, ".env"): "OPENCLAW_GATEWAY_TOKEN=" + composeToken + "\n",
+		filepath.Join(configDir, ".env"):  "OPENCLAW_GATEWAY_TOKEN=" + configToken + "\n",
+		filepath.Join(configDir, "openclaw.json"): `{
+  "gateway": {"mode": "local", "bind": "lan", "port": 18789, "auth": {"mode": "token", "token": "` + configToken + `"}},
+  "agents": {"defaults": {"model": {"primary": "openai/gpt-4o"}}},
+  "channels": {"webhook": {"secret": "` + configToken + `"}}
+}`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return composeDir
+}
+
+func tokenFinding(t *testing.T, opts DoctorOptions) DoctorFinding {
+	t.Helper()
+	d := &doctor{opts: opts, configDir: filepath.Join(opts.ComposeDir, "data", "conf")}
+	d.checkTokens(context.Background())
+	if len(d.findings) != 1 {
+		t.Fatalf("findings = %+v, want one", d.findings)
+	}
+	return d.findings[0]
+}
+
+func TestDoctorSyncTokenUsesTheGatewayToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		runtime   *fakeRuntime
+		container string
+		wantToken string
+		wantFrom  string
+	}{
+		{
+			name:      "running gateway",
+			runtime:   &fakeRuntime{env: map[string]string{"OPENCLAW_GATEWAY_TOKEN": configToken}},
+			container: "openclaw-gateway",
+			wantToken: configToken,
+			wantFrom:  "the running gateway",
+		},
+		{
+			name:      "stopped gateway",
+			runtime:   &fakeRuntime{stopped: true},
+			container: "openclaw-gateway",
+			wantToken: composeToken,
+			wantFrom:  "the gateway is stopped",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			composeDir := writeTokenCopies(t)
+			opts := DoctorOptions{ComposeDir: composeDir, ContainerName: tt.container, Runtime: tt.runtime, Offline: true}
+
+			finding := tokenFinding(t, opts)
+			if finding.Severity != SeverityError || finding.Fix != DoctorFixSyncToken {
+				t.Fatalf("finding = %+v, want an error with the sync-token fix", finding)
+			}
+			if !strings.Contains(finding.Message, tt.wantFrom) || !strings.Contains(finding.Message, "no restart needed") {
+				t.Errorf("message = %q, want it to name %q and say no restart is needed", finding.Message, tt.wantFrom)
+			}
+
+			applied, err := ApplyDoctorFixes(context.Background(), opts, []string{DoctorFixSyncToken})
+			if err != nil || len(applied) != 1 {
+				t.Fatalf("ApplyDoctorFixes = %v, %v", applied, err)
+			}
+			copies, err := config.GatewayTokenCopies(composeDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range copies {
+				if item.Token != tt.wantToken {
+					t.Errorf("%s = %q, want %q", item.Source, item.Token, tt.wantToken)
+				}
+			}
+			content, err := os.ReadFile(filepath.Join(composeDir, "data", "conf", "openclaw.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(content), `"secret": "`+configToken+`"`) {
+				t.Errorf("a field other than gateway.auth.token was rewritten:\n%s", content)
+			}
+			if tt.runtime.restarts != 0 {
+				t.Errorf("restarts = %d, want none", tt.runtime.restarts)
+			}
+			if after := tokenFinding(t, opts); after.Severity != SeverityOK {
+				t.Errorf("after the fix: %+v, want ok", after)
+			}
+		})
+	}
+}
+
+func TestDoctorSyncTokenNotOfferedWhenGatewayTokenUnknown(t *testing.T) {
+	tests := []struct {
+		name      string
+		runtime   *fakeRuntime
+		container string
+	}{
+		{"no container name", &fakeRuntime{}, ""},
+		{"token not in the container env", &fakeRuntime{env: map[string]string{}}, "openclaw-gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			composeDir := writeTokenCopies(t)
+			before, err := config.GatewayTokenCopies(composeDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := DoctorOptions{ComposeDir: composeDir, ContainerName: tt.container, Runtime: tt.runtime, Offline: true}
+
+			finding := tokenFinding(t, opts)
+			if finding.Severity != SeverityError || finding.Fix != "" {
+				t.Errorf("finding = %+v, want an error without a fix", finding)
+			}
+			if !strings.Contains(finding.Message, "restart the gateway") {
+				t.Errorf("message = %q, want the manual steps", finding.Message)
+			}
+			if _, err := ApplyDoctorFixes(context.Background(), opts, []string{DoctorFixSyncToken}); err == nil {
+				t.Error("sync-token ran without knowing the gateway's token")
+			}
+			after, err := config.GatewayTokenCopies(composeDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range before {
+				if after[i].Token != before[i].Token {
+					t.Errorf("%s changed although the fix failed", after[i].Source)
+				}
+			}
+		})
+	}
+}
+
+func TestDoctorTokensAgree(t *testing.T) {
+	composeDir := writeTokenCopies(t)
+	if _, err := config.SyncGatewayToken(composeDir, composeToken); err != nil {
+		t.Fatal(err)
+	}
+	finding := tokenFinding(t, DoctorOptions{ComposeDir: composeDir, Runtime: &fakeRuntime{}})
+	if finding.Severity != SeverityOK || finding.Fix != "" {
+		t.Errorf("finding = %+v, want ok", finding)
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"openclaw-setup/internal/config"
+)
+
+type DraftResponse struct {
+	OK      bool          `json:"ok"`
+	Message string        `json:"message,omitempty"`
+	Draft   *config.Draft `json:"draft"`
+}
+
+// DraftActionRequest is the optional body of a draft preview or apply.
+type DraftActionRequest struct {
+	CheckReachability bool `json:"checkReachability,omitempty"`
+	Force             bool `json:"force,omitempty"`
+}
+
+// DraftHandler serves the server-side draft: GET, PATCH and DELETE on
+// /api/draft edit it, and POST to /api/draft/preview and /api/draft/apply
+// validate and diff it, or write it with a single restart. The store's
+// lock is only held to snapshot or discard the draft, never across a save.
+type DraftHandler struct {
+	store     *config.DraftStore
+	configDir string
+	saver     *ConfigHandler
+	audit     *AuditLog
+}
+
+func NewDraftHandler(cfg ServerConfig, store *config.DraftStore, saver *ConfigHandler, audit *AuditLog) *DraftHandler {
+	return &DraftHandler{store: store, configDir: cfg.ConfigDir, saver: saver, audit: audit}
+}
+
+func (h *DraftHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The draft holds keys a client sent, so they are only redacted from
+	// the responses that carry the draft.
+	w, r, secrets := requestSecrets(w, r)
+	secrets.Add(h.store.Current().SecretValues()...)
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/api/draft":
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, DraftResponse{OK: true, Draft: h.store.Current()})
+		case http.MethodPatch:
+			h.edit(w, r)
+		case http.MethodDelete:
+			err := h.store.Discard()
+			h.audit.record(r, "draft.discard", nil, err)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, DraftResponse{Message: err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, DraftResponse{OK: true, Message: "草稿已丢弃"})
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, DraftResponse{Message: "method not allowed"})
+		}
+	case "/api/draft/preview":
+		h.submit(w, r, true)
+	case "/api/draft/apply":
+		h.submit(w, r, false)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// edit applies one DraftEdit, starting a draft from the current
+// configuration if there is none.
+func (h *DraftHandler) edit(w http.ResponseWriter, r *http.Request) {
+	var edit config.DraftEdit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		writeJSON(w, http.StatusBadRequest, DraftResponse{Message: "invalid json"})
+		return
+	}
+	draft, err := h.store.Update(h.configDir, func(draft *config.Draft) error {
+		return draft.Apply(edit, h.configDir)
+	})
+	h.audit.record(r, "draft.edit", draftEditKeys(edit), err)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, DraftResponse{Message: err.Error()})
+		return
+	}
+	_, _, secrets := requestSecrets(w, r)
+	secrets.Add(draft.SecretValues()...)
+	writeJSON(w, http.StatusOK, DraftResponse{OK: true, Message: "草稿已更新", Draft: draft})
+}
+
+// submit previews or applies the draft through the same path as a direct
+// save. The draft's base revision is the If-Match, so a draft started
+// before someone else's save is refused until it is rebased.
+func (h *DraftHandler) submit(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ConfigResponse{Message: "method not allowed"})
+		return
+	}
+	var action DraftActionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
+			writeJSON(w, http.StatusBadRequest, ConfigResponse{Message: "invalid json"})
+			return
+		}
+	}
+
+	draft := h.store.Current()
+	if draft == nil {
+		writeJSON(w, http.StatusNotFound, ConfigResponse{Message: "没有待应用的草稿"})
+		return
+	}
+	if !dryRun && len(draft.MissingSecrets) > 0 {
+		writeJSON(w, http.StatusBadRequest, ConfigResponse{
+			Message: "草稿缺少密钥，请重新填写：" + strings.Join(draft.MissingSecrets, ", "),
+		})
+		return
+	}
+
+	channels := draft.Channels
+	if len(channels) == 0 {
+		channels = json.RawMessage("null")
+	}
+	req := ConfigRequest{
+		Model:             draft.Model,
+		GatewayToken:      draft.GatewayToken,
+		Providers:         draft.Providers,
+		DryRun:            dryRun,
+		RewriteLoopback:   draft.RewriteLoopback,
+		CheckReachability: action.CheckReachability,
+		Fallbacks:         append([]string{}, draft.Fallbacks...),
+		Gateway:           &draft.Gateway,
+		Channels:          channels,
+		Force:             action.Force,
+		replaceProviders:  true,
+	}
+	if !h.saver.save(w, r, req, quoteETag(draft.BaseRevision), "draft.apply") {
+		return
+	}
+	// The configuration is written even if the restart failed, so the
+	// draft has been applied either way. An edit made during the save
+	// is kept; its base revision is now stale, so it needs a rebase.
+	discarded, err := h.store.DiscardIfUnchanged(draft)
+	if err != nil {
+		slog.Default().Error("discard applied draft", "error", err)
+	} else if !discarded {
+		slog.Default().Info("draft was edited while it was applied and is kept")
+	}
+}
+
+// draftEditKeys names what an edit touches for the audit log, without
+// any values.
+func draftEditKeys(edit config.DraftEdit) []string {
+	var keys []string
+	if edit.Model != nil {
+		keys = append(keys, "model")
+	}
+	if edit.Fallbacks != nil {
+		keys = append(keys, "fallbacks")
+	}
+	if edit.Gateway != nil {
+		keys = append(keys, "gateway")
+	}
+	if len(edit.Channels) > 0 {
+		keys = append(keys, "channels")
+	}
+	if edit.GatewayToken != nil || edit.RotateToken {
+		keys = append(keys, "gatewayToken")
+	}
+	for _, provider := range edit.Providers {
+		keys = append(keys, "providers."+provider.ID())
+	}
+	for _, id := range edit.RemoveProviders {
+		keys = append(keys, "providers."+strings.ToLower(strings.TrimSpace(id)))
+	}
+	if edit.RewriteLoopback != nil {
+		keys = append(keys, "rewriteLoopback")
+	}
+	if edit.Rebase {
+		keys = append(keys, "baseRevision")
+	}
+	return keys
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+// writeDraftBase writes a configuration with everything a draft must carry:
+// a region, fallbacks, a custom port and a channel.
+func writeDraftBase(t *testing.T) (composeDir, configDir string) {
+	t.Helper()
+	composeDir = t.TempDir()
+	configDir = filepath.Join(composeDir, "data", "conf")
+	err := config.WriteConfigAndEnv(config.WriteOptions{
+		ConfigDir:    configDir,
+		Model:        "moonshot/kimi-k2-0905-preview",
+		GatewayToken: "draft-test-gateway-token",
+		Providers: []config.ProviderKey{
+			{Key: "MOONSHOT_API_KEY", Value: "sk-moonshot-test-0001", Region: "intl"},
+		},
+		Fallbacks: []string{"moonshot/kimi-latest"},
+		Gateway:   config.GatewaySettings{Port: 19001},
+		Channels:  json.RawMessage(`{"telegram":{"enabled":true,"botToken":"${TELEGRAM_BOT_TOKEN}"}}`),
+		Env:       map[string]string{"TELEGRAM_BOT_TOKEN": "123456:telegram-test-token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return composeDir, configDir
+}
+
+func serveDraft(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDraftCarriesCurrentConfig(t *testing.T) {
+	composeDir, configDir := writeDraftBase(t)
+	before, err := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime := &fakeRuntime{}
+	cfg := ServerConfig{ComposeDir: composeDir, ConfigDir: configDir, Offline: true, Runtime: runtime}
+	handler := NewDraftHandler(cfg, mustDraftStore(t), newConfigHandler(cfg, NewModelCatalog("", nil), nil), nil)
+
+	rec := serveDraft(t, handler, http.MethodPatch, "/api/draft", `{"rewriteLoopback":false}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("edit: %d %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Draft struct {
+			Fallbacks []string               `json:"fallbacks"`
+			Gateway   config.GatewaySettings `json:"gateway"`
+			Channels  json.RawMessage        `json:"channels"`
+			Providers []map[string]any       `json:"providers"`
+		} `json:"draft"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(resp.Draft.Fallbacks, ",") != "moonshot/kimi-latest" || resp.Draft.Gateway.Port != 19001 || len(resp.Draft.Channels) == 0 {
+		t.Errorf("draft = %+v, want the fallbacks, port and channels of the config", resp.Draft)
+	}
+	if len(resp.Draft.Providers) != 1 || resp.Draft.Providers[0]["provider"] != "moonshot" || resp.Draft.Providers[0]["region"] != "intl" {
+		t.Errorf("providers = %v, want moonshot in the intl region with lowercase fields", resp.Draft.Providers)
+	}
+
+	rec = serveDraft(t, handler, http.MethodPost, "/api/draft/apply", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply: %d %s", rec.Code, rec.Body)
+	}
+	after, err := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("applying an unchanged draft rewrote openclaw.json:\n%s\nwant\n%s", after, before)
+	}
+}
+
+// TestDraftApplyDoesNotBlockEdits edits the draft while its apply waits
+// on the restart, and expects the edit to be served and kept.
+func TestDraftApplyDoesNotBlockEdits(t *testing.T) {
+	composeDir, configDir := writeDraftBase(t)
+	runtime := &fakeRuntime{restartGate: make(chan struct{})}
+	cfg := ServerConfig{ComposeDir: composeDir, ConfigDir: configDir, Offline: true, Runtime: runtime}
+	store := mustDraftStore(t)
+	handler := NewDraftHandler(cfg, store, newConfigHandler(cfg, NewModelCatalog("", nil), nil), nil)
+
+	if rec := serveDraft(t, handler, http.MethodPatch, "/api/draft", `{"model":"moonshot/kimi-latest"}`); rec.Code != http.StatusOK {
+		t.Fatalf("edit: %d %s", rec.Code, rec.Body)
+	}
+	applied := make(chan *httptest.ResponseRecorder)
+	go func() {
+		applied <- serveDraft(t, handler, http.MethodPost, "/api/draft/apply", "")
+	}()
+
+	// Wait for the apply to reach the restart.
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		content, _ := os.ReadFile(filepath.Join(configDir, "openclaw.json"))
+		if strings.Contains(string(content), `"primary": "moonshot/kimi-latest"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("apply did not write the config")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	edited := make(chan *httptest.ResponseRecorder)
+	go func() {
+		edited <- serveDraft(t, handler, http.MethodPatch, "/api/draft", `{"fallbacks":[]}`)
+	}()
+	select {
+	case rec := <-edited:
+		if rec.Code != http.StatusOK {
+			t.Errorf("edit during apply: %d %s", rec.Code, rec.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("an edit was blocked by the apply's restart")
+	}
+	close(runtime.restartGate)
+	if rec := <-applied; rec.Code != http.StatusOK {
+		t.Fatalf("apply: %d %s", rec.Code, rec.Body)
+	}
+
+	draft := store.Current()
+	if draft == nil {
+		t.Fatal("the draft edited during the apply was discarded")
+	}
+	if len(draft.Fallbacks) != 0 {
+		t.Errorf("fallbacks = %v, want the edit made during the apply", draft.Fallbacks)
+	}
+}
+
+func mustDraftStore(t *testing.T) *config.DraftStore {
+	t.Helper()
+	store, err := config.NewDraftStore("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
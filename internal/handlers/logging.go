@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+// NewLogger returns a structured logger writing text, or JSON when
+// jsonFormat is set. Every string attribute passes through config.Secrets.
+func NewLogger(w io.Writer, jsonFormat bool) *slog.Logger {
+	opts := &slog.HandlerOptions{ReplaceAttr: redactAttr}
+	if jsonFormat {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+func redactAttr(_ []string, attr slog.Attr) slog.Attr {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(config.Secrets.Redact(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			attr.Value = slog.StringValue(config.Secrets.Redact(err.Error()))
+		}
+	}
+	return attr
+}
+
+// withRequestLog logs one line per request and counts it in
+// openclaw_setup_http_requests_total. Query strings are left out of the log
+// since they may carry credentials.
+func withRequestLog(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		duration := time.Since(start)
+		route := metricRoute(r.URL.Path)
+		httpRequestsTotal.inc(metricMethod(r.Method), route, strconv.Itoa(recorder.status))
+		logger.Info("request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Int64("bytes", recorder.bytes),
+			slog.Duration("duration", duration),
+			slog.String("client", clientIP(r)),
+		)
+	})
+}
+
+// metricRoutes are the paths served by NewServer. Only these become route
+// labels, so a client cannot grow the metric by requesting new paths.
+var metricRoutes = map[string]bool{
+	"/api/config":        true,
+	"/api/draft":         true,
+	"/api/draft/preview": true,
+	"/api/draft/apply":   true,
+	"/api/models":        true,
+	"/api/models/all":    true,
+	"/api/probe":         true,
+	"/api/discover":      true,
+	"/api/doctor":        true,
+	"/api/migrate":       true,
+	"/api/export":        true,
+	"/api/import":        true,
+	"/metrics":           true,
+}
+
+// metricRoute keeps the route label bounded: known routes are kept, other
+// API paths are "other" and anything else is the static UI.
+func metricRoute(path string) string {
+	if trimmed := strings.TrimSuffix(path, "/"); metricRoutes[trimmed] {
+		return trimmed
+	}
+	if strings.HasPrefix(path, "/api/") {
+		return "other"
+	}
+	return "static"
+}
+
+// metricMethod keeps the method label to the standard methods.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+// metricProvider keeps the provider label bounded: ids a client makes up
+// for a custom endpoint share one label.
+func metricProvider(id string) string {
+	if info, known := config.LookupProvider(id); known {
+		return info.ID
+	}
+	return "custom"
+}
+
+// clientIP is the remote address of the connection, or "unix" for Unix
+// socket peers. Forwarding headers are ignored because nothing vouches for
+// them.
+func clientIP(r *http.Request) string {
+	if r.RemoteAddr == "" || r.RemoteAddr == "@" {
+		return "unix"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import "testing"
+
+func TestMetricLabelsAreBounded(t *testing.T) {
+	routes := map[string]string{
+		"/api/config":       "/api/config",
+		"/api/draft/":       "/api/draft",
+		"/api/draft/apply":  "/api/draft/apply",
+		"/api/draft/x1y2z3": "other",
+		"/api/random-123":   "other",
+		"/metrics":          "/metrics",
+		"/assets/index.js":  "static",
+		"/some/client/path": "static",
+	}
+	for path, want := range routes {
+		if got := metricRoute(path); got != want {
+			t.Errorf("metricRoute(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	methods := map[string]string{"GET": "GET", "PATCH": "PATCH", "BREW": "other"}
+	for method, want := range methods {
+		if got := metricMethod(method); got != want {
+			t.Errorf("metricMethod(%q) = %q, want %q", method, got, want)
+		}
+	}
+
+	providers := map[string]string{"OpenAI": "openai", "moonshot": "moonshot", "my-local-llm-42": "custom"}
+	for id, want := range providers {
+		if got := metricProvider(id); got != want {
+			t.Errorf("metricProvider(%q) = %q, want %q", id, got, want)
+		}
+	}
+}
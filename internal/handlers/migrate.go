@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"openclaw-setup/internal/config"
+)
+
+type MigrateResponse struct {
+	OK      bool                  `json:"ok"`
+	Message string                `json:"message"`
+	Report  *config.MigrateReport `json:"report,omitempty"`
+}
+
+func NewMigrateHandler(cfg ServerConfig, audit *AuditLog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, MigrateResponse{Message: "method not allowed"})
+			return
+		}
+
+		unlock, err := config.LockComposeDir(cfg.ComposeDir)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, MigrateResponse{Message: err.Error()})
+			return
+		}
+		defer unlock()
+
+		report, err := config.Migrate(config.MigrateOptions{
+			ComposeDir: cfg.ComposeDir,
+			ConfigDir:  cfg.ConfigDir,
+		})
+		if err != nil {
+			audit.record(r, "migrate", nil, err)
+			writeJSON(w, http.StatusBadRequest, MigrateResponse{Message: err.Error()})
+			return
+		}
+		audit.record(r, "migrate", migratedKeys(report), nil)
+
+		writeJSON(w, http.StatusOK, MigrateResponse{
+			OK:      true,
+			Message: "配置已迁移，重启后生效",
+			Report:  report,
+		})
+	})
+}
+
+// migratedKeys lists the fields a migration wrote, under their new names.
+func migratedKeys(report *config.MigrateReport) []string {
+	keys := append([]string(nil), report.Mapped...)
+	keys = append(keys, report.Kept...)
+	for _, rename := range report.Renamed {
+		keys = append(keys, rename.To)
+	}
+	return keys
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+const (
+	modelCacheTTL      = 10 * time.Minute
+	modelCacheStaleTTL = 24 * time.Hour
+	// maxModelCacheEntries bounds the cache, whose keys include base URLs
+	// and keys sent by clients.
+	maxModelCacheEntries = 256
+)
+
+// modelSource identifies one model listing: the provider, its endpoint
+// (region preset or base URL override), the API dialect spoken there and
+// the key used to authenticate.
+type modelSource struct {
+	Provider string
+	Region   string
+	BaseUrl  string
+	Api      string
+	ApiKey   string
+}
+
+func (s modelSource) cacheKey() string {
+	sum := sha256.Sum256([]byte(s.ApiKey))
+	return s.catalogKey() + "|" + s.Api + "|" + hex.EncodeToString(sum[:8])
+}
+
+// catalogKey names the provider and the endpoint it resolves to, so lists
+// from different regions or base URLs are kept apart.
+func (s modelSource) catalogKey() string {
+	endpoint := strings.TrimRight(s.BaseUrl, "/")
+	if resolved, _, err := config.ResolveEndpoint(s.Provider, s.Region, s.BaseUrl); err == nil {
+		endpoint = resolved
+	}
+	return strings.ToLower(s.Provider) + "|" + endpoint
+}
+
+type modelList struct {
+	Models    []ModelInfo
+	Message   string
+	FetchedAt time.Time
+	Stale     bool
+}
+
+// modelCache keeps model lists per source for ttl and keeps serving them
+// for up to staleTTL while a background refresh runs. Concurrent requests
+// for the same source share a single upstream call. Errors are not cached.
+// Lists past staleTTL are dropped, and the oldest go first beyond
+// maxEntries.
+type modelCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	staleTTL   time.Duration
+	maxEntries int
+	entries    map[string]modelList
+	flights    flightGroup
+	fetch      func(modelSource) ([]ModelInfo, string, error)
+	onFetch    func(modelSource, modelList)
+}
+
+func newModelCache(fetch func(modelSource) ([]ModelInfo, string, error), onFetch func(modelSource, modelList)) *modelCache {
+	return &modelCache{
+		ttl:        modelCacheTTL,
+		staleTTL:   modelCacheStaleTTL,
+		maxEntries: maxModelCacheEntries,
+		entries:    make(map[string]modelList),
+		fetch:      fetch,
+		onFetch:    onFetch,
+	}
+}
+
+func (c *modelCache) get(src modelSource) (modelList, error) {
+	key := src.cacheKey()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok {
+		age := time.Since(entry.FetchedAt)
+		if age < c.ttl {
+			return entry, nil
+		}
+		if age < c.staleTTL {
+			go func() { _, _ = c.refresh(key, src) }()
+			entry.Stale = true
+			return entry, nil
+		}
+	}
+	return c.refresh(key, src)
+}
+
+func (c *modelCache) refresh(key string, src modelSource) (modelList, error) {
+	value, err := c.flights.do(key, func() (interface{}, error) {
+		models, message, err := c.fetch(src)
+		if err != nil {
+			return modelList{}, err
+		}
+		list := modelList{Models: models, Message: message, FetchedAt: time.Now()}
+		c.mu.Lock()
+		c.entries[key] = list
+		c.evictLocked()
+		c.mu.Unlock()
+		if c.onFetch != nil {
+			c.onFetch(src, list)
+		}
+		return list, nil
+	})
+	if err != nil {
+		return modelList{}, err
+	}
+	return value.(modelList), nil
+}
+
+// evictLocked drops the lists past staleTTL and then the oldest ones
+// until at most maxEntries are left. c.mu must be held.
+func (c *modelCache) evictLocked() {
+	for key, entry := range c.entries {
+		if time.Since(entry.FetchedAt) >= c.staleTTL {
+			delete(c.entries, key)
+		}
+	}
+	for len(c.entries) > c.maxEntries {
+		oldestKey := ""
+		var oldest time.Time
+		for key, entry := range c.entries {
+			if oldestKey == "" || entry.FetchedAt.Before(oldest) {
+				oldestKey, oldest = key, entry.FetchedAt
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+}
+
+// flightGroup deduplicates concurrent calls that share a key.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+	call := &flightCall{}
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.value, call.err = fn()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return call.value, call.err
+}
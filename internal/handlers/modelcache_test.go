@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+func TestModelCacheEvicts(t *testing.T) {
+	cache := newModelCache(func(src modelSource) ([]ModelInfo, string, error) {
+		return []ModelInfo{{ID: src.Provider + "-model"}}, "", nil
+	}, nil)
+	cache.maxEntries = 2
+
+	sources := []modelSource{
+		{Provider: "a", BaseUrl: "https://a.example.com/v1"},
+		{Provider: "b", BaseUrl: "https://b.example.com/v1"},
+		{Provider: "c", BaseUrl: "https://c.example.com/v1"},
+	}
+	for _, src := range sources {
+		if _, err := cache.get(src); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(cache.entries) != 2 {
+		t.Fatalf("%d entries, want the cap of 2", len(cache.entries))
+	}
+	if _, ok := cache.entries[sources[0].cacheKey()]; ok {
+		t.Error("the oldest list was kept over the cap")
+	}
+
+	// A list past staleTTL is swept on the next fetch.
+	cache.mu.Lock()
+	entry := cache.entries[sources[1].cacheKey()]
+	entry.FetchedAt = time.Now().Add(-cache.staleTTL)
+	cache.entries[sources[1].cacheKey()] = entry
+	cache.mu.Unlock()
+	if _, err := cache.get(modelSource{Provider: "d", BaseUrl: "https://d.example.com/v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.entries[sources[1].cacheKey()]; ok {
+		t.Error("a list past staleTTL was kept")
+	}
+}
+
+// TestBulkModelsUsesStoredDialect configures a custom provider that speaks
+// the Anthropic dialect and expects the GET listing to use it.
+func TestBulkModelsUsesStoredDialect(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" || r.Header.Get("x-api-key") != "bulk-test-key-0001" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"id":"claude-local"}],"has_more":false}`))
+	}))
+	defer upstream.Close()
+
+	configDir := filepath.Join(t.TempDir(), "data", "conf")
+	err := config.WriteConfigAndEnv(config.WriteOptions{
+		ConfigDir:    configDir,
+		Model:        "local/claude-local",
+		GatewayToken: "bulk-test-gateway-token",
+		Providers: []config.ProviderKey{
+			{Key: "LOCAL_API_KEY", Value: "bulk-test-key-0001", Provider: "local", BaseUrl: upstream.URL, Api: "anthropic-messages"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewBulkModelsHandler(ServerConfig{ConfigDir: configDir}, NewModelCatalog("", upstream.Client()))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/models/all", nil))
+	var resp BulkModelsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || len(resp.Results[0].Models) != 1 || resp.Results[0].Models[0] != "claude-local" {
+		t.Errorf("results = %+v, want the list fetched in the anthropic dialect", resp.Results)
+	}
+}
+
+// TestBulkModelsBoundsConcurrency lists more providers than there are
+// workers and checks that no more than bulkWorkers reach the upstream at
+// once and that each result stays in its slot.
+func TestBulkModelsBoundsConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		id := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[0]
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data":[{"id":"model-%s"}]}`, id)
+	}))
+	defer upstream.Close()
+
+	var req BulkModelsRequest
+	for i := 0; i < 3*bulkWorkers; i++ {
+		req.Providers = append(req.Providers, ModelsRequest{
+			Provider: fmt.Sprintf("local%d", i),
+			ApiKey:   "bulk-test-key-0001",
+			BaseUrl:  fmt.Sprintf("%s/%d/v1", upstream.URL, i),
+		})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewBulkModelsHandler(ServerConfig{}, NewModelCatalog("", upstream.Client()))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/models/all", bytes.NewReader(body)))
+	var resp BulkModelsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != len(req.Providers) {
+		t.Fatalf("%d results, want %d: %s", len(resp.Results), len(req.Providers), rec.Body)
+	}
+	for i, result := range resp.Results {
+		if want := fmt.Sprintf("model-%d", i); len(result.Models) != 1 || result.Models[0] != want {
+			t.Errorf("results[%d] = %+v, want %s", i, result, want)
+		}
+	}
+	if got := peak.Load(); got > bulkWorkers {
+		t.Errorf("%d concurrent upstream requests, want at most %d", got, bulkWorkers)
+	}
+
+	req.Providers = make([]ModelsRequest, maxBulkProviders+1)
+	body, err = json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/models/all", bytes.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("%d providers: status %d, want 400", maxBulkProviders+1, rec.Code)
+	}
+}
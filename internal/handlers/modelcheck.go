@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maxModelSuggestions = 5
+
+type ModelCheck struct {
+	Model    string `json:"model"`
+	Verified bool   `json:"verified"`
+	Source   string `json:"source,omitempty"`
+	Warning  string `json:"warning,omitempty"`
+	// Code is the provider error code when the model list could not be
+	// fetched.
+	Code string `json:"code,omitempty"`
+}
+
+// ProviderCredentials is what CheckModelRef needs to list the models of a
+// configured provider.
+type ProviderCredentials struct {
+	ApiKey  string
+	Region  string
+	BaseUrl string
+	Api     string
+}
+
+func (c ProviderCredentials) source(provider string) modelSource {
+	return modelSource{Provider: provider, Region: c.Region, BaseUrl: c.BaseUrl, Api: c.Api, ApiKey: c.ApiKey}
+}
+
+type ModelRefError struct {
+	Message     string
+	Suggestions []string
+}
+
+func (e *ModelRefError) Error() string {
+	if len(e.Suggestions) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s; did you mean %s?", e.Message, strings.Join(e.Suggestions, ", "))
+}
+
+// CheckModelRef verifies that model is a provider/model reference for one of
+// the configured providers and, when a catalog is available,
+// that the provider actually serves it. Failures are returned as
+// *ModelRefError with close matches as suggestions. A model missing from a
+// cached list, which may predate it, or from any list when force is set,
+// only gets a warning.
+func CheckModelRef(catalog *ModelCatalog, model string, providers map[string]ProviderCredentials, offline, force bool) (ModelCheck, error) {
+	model = strings.TrimSpace(model)
+	if len(providers) == 0 {
+		return ModelCheck{}, &ModelRefError{Message: "no provider is configured"}
+	}
+
+	providerID, modelID, ok := strings.Cut(model, "/")
+	if !ok || strings.TrimSpace(providerID) == "" || strings.TrimSpace(modelID) == "" {
+		return ModelCheck{}, &ModelRefError{
+			Message:     fmt.Sprintf("model %q must have the form provider/model", model),
+			Suggestions: suggestAcrossProviders(catalog, model, providers, offline, true),
+		}
+	}
+	providerID = strings.ToLower(providerID)
+
+	creds, configured := providers[providerID]
+	if !configured {
+		return ModelCheck{}, &ModelRefError{
+			Message:     fmt.Sprintf("provider %s is not configured", providerID),
+			Suggestions: suggestAcrossProviders(catalog, modelID, providers, offline, false),
+		}
+	}
+
+	check := ModelCheck{Model: providerID + "/" + modelID}
+	models, source, err := catalog.Models(providerID, creds, offline)
+	if len(models) == 0 {
+		check.Warning = fmt.Sprintf("model list for %s is unavailable, %s was not verified", providerID, check.Model)
+		if err != nil {
+			check.Warning += ": " + err.Error()
+			var providerErr *ProviderError
+			if errors.As(err, &providerErr) {
+				check.Code = providerErr.Code
+			}
+		}
+		return check, nil
+	}
+
+	for _, item := range models {
+		if item == modelID {
+			check.Verified = true
+			check.Source = source
+			return check, nil
+		}
+	}
+
+	matches := closeMatches(modelID, models)
+	suggestions := make([]string, 0, len(matches))
+	for _, match := range matches {
+		suggestions = append(suggestions, providerID+"/"+match)
+	}
+	refErr := &ModelRefError{
+		Message:     fmt.Sprintf("model %s is not offered by %s", modelID, providerID),
+		Suggestions: suggestions,
+	}
+	if !force && source != "cache" {
+		return ModelCheck{}, refErr
+	}
+	check.Source = source
+	check.Warning = fmt.Sprintf("%s, %s was not verified", refErr.Error(), check.Model)
+	if source == "cache" {
+		check.Warning = fmt.Sprintf("the cached model list of %s may be out of date: %s", providerID, check.Warning)
+	}
+	return check, nil
+}
+
+// suggestAcrossProviders looks modelID up in every configured provider's
+// catalog. With fallbackPrefix set it suggests provider/modelID for each
+// provider when no catalog has a match.
+func suggestAcrossProviders(catalog *ModelCatalog, modelID string, providers map[string]ProviderCredentials, offline, fallbackPrefix bool) []string {
+	ids := make([]string, 0, len(providers))
+	for id := range providers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var suggestions []string
+	for _, id := range ids {
+		models, _, _ := catalog.Models(id, providers[id], offline)
+		for _, match := range closeMatches(modelID, models) {
+			suggestions = append(suggestions, id+"/"+match)
+		}
+	}
+	if len(suggestions) == 0 && fallbackPrefix && modelID != "" {
+		for _, id := range ids {
+			suggestions = append(suggestions, id+"/"+modelID)
+		}
+	}
+	if len(suggestions) > maxModelSuggestions {
+		suggestions = suggestions[:maxModelSuggestions]
+	}
+	return suggestions
+}
+
+// closeMatches ranks candidates by how likely they are what target meant:
+// case-insensitive equality first, then substring matches, then small edit
+// distances.
+func closeMatches(target string, candidates []string) []string {
+	type scored struct {
+		value string
+		score int
+	}
+	lowerTarget := strings.ToLower(target)
+	threshold := len(target) / 4
+	if threshold < 2 {
+		threshold = 2
+	}
+
+	var matches []scored
+	for _, candidate := range candidates {
+		lower := strings.ToLower(candidate)
+		switch {
+		case lower == lowerTarget:
+			matches = append(matches, scored{candidate, 0})
+		case strings.Contains(lower, lowerTarget) || strings.Contains(lowerTarget, lower):
+			matches = append(matches, scored{candidate, 1 + abs(len(lower)-len(lowerTarget))})
+		default:
+			if distance := levenshtein(lowerTarget, lower); distance <= threshold {
+				matches = append(matches, scored{candidate, 100 + distance})
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score < matches[j].score })
+
+	result := make([]string, 0, maxModelSuggestions)
+	for _, match := range matches {
+		if len(result) == maxModelSuggestions {
+			break
+		}
+		result = append(result, match.value)
+	}
+	return result
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckModelRefMissingModel(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"id":"llama-3.1-8b"},{"id":"llama-3.1-70b"}]}`))
+	}))
+	defer upstream.Close()
+	providers := map[string]ProviderCredentials{"local": {ApiKey: "local-test-key", BaseUrl: upstream.URL + "/v1"}}
+
+	catalog := NewModelCatalog("", upstream.Client())
+	_, err := CheckModelRef(catalog, "local/llama-3.1-8", providers, false, false)
+	var refErr *ModelRefError
+	if !errors.As(err, &refErr) || len(refErr.Suggestions) == 0 || refErr.Suggestions[0] != "local/llama-3.1-8b" {
+		t.Fatalf("err = %v, want a ModelRefError suggesting local/llama-3.1-8b", err)
+	}
+
+	check, err := CheckModelRef(catalog, "local/llama-3.1-8", providers, false, true)
+	if err != nil || check.Verified || !strings.Contains(check.Warning, "not verified") {
+		t.Errorf("forced: %+v, %v, want an unverified check with a warning", check, err)
+	}
+
+	// The live fetch above filled the catalog, which is a cache offline.
+	check, err = CheckModelRef(catalog, "local/llama-3.2-1b", providers, true, false)
+	if err != nil || check.Source != "cache" || !strings.Contains(check.Warning, "out of date") {
+		t.Errorf("cached: %+v, %v, want a warning that the cache may be out of date", check, err)
+	}
+}
+
+func TestModelCatalogIsKeyedByEndpoint(t *testing.T) {
+	catalog := NewModelCatalog("", nil)
+	catalog.Store("moonshot", ProviderCredentials{Region: "cn"}, []string{"kimi-latest"})
+
+	if _, ok := catalog.Lookup("moonshot", ProviderCredentials{}); !ok {
+		t.Error("the default region did not find the cn list")
+	}
+	if models, ok := catalog.Lookup("moonshot", ProviderCredentials{Region: "intl"}); ok {
+		t.Errorf("the intl region found the cn list %v", models)
+	}
+	if _, ok := catalog.Lookup("moonshot", ProviderCredentials{BaseUrl: "https://proxy.example.com/v1"}); ok {
+		t.Error("a custom base URL found the cn list")
+	}
+}
@@ -2,24 +2,53 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"openclaw-setup/internal/config"
 )
 
 type ModelsRequest struct {
-	Provider string `json:"provider"`
-	ApiKey   string `json:"apiKey"`
+	Provider string      `json:"provider"`
+	ApiKey   string      `json:"apiKey"`
+	Region   string      `json:"region,omitempty"`
+	BaseUrl  string      `json:"baseUrl,omitempty"`
+	Api      string      `json:"api,omitempty"`
+	Filter   ModelFilter `json:"filter"`
 }
 
 type ModelsResponse struct {
-	Models  []string `json:"models"`
-	Message string   `json:"message,omitempty"`
+	Provider  string      `json:"provider,omitempty"`
+	Models    []string    `json:"models"`
+	Details   []ModelInfo `json:"details,omitempty"`
+	Message   string      `json:"message,omitempty"`
+	FetchedAt *time.Time  `json:"fetchedAt,omitempty"`
+	Stale     bool        `json:"stale,omitempty"`
+	// Code, UpstreamStatus and Detail describe a failed listing; Message
+	// then holds the localized explanation.
+	Code           string `json:"code,omitempty"`
+	UpstreamStatus int    `json:"upstreamStatus,omitempty"`
+	Detail         string `json:"detail,omitempty"`
+}
+
+type BulkModelsRequest struct {
+	Providers []ModelsRequest `json:"providers"`
+	Filter    ModelFilter     `json:"filter"`
 }
 
-func NewModelsHandler() http.Handler {
+type BulkModelsResponse struct {
+	Results []ModelsResponse `json:"results"`
+	Message string           `json:"message,omitempty"`
+}
+
+func NewModelsHandler(catalog *ModelCatalog) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeJSON(w, http.StatusMethodNotAllowed, ModelsResponse{Message: "method not allowed"})
@@ -34,159 +63,380 @@ func NewModelsHandler() http.Handler {
 
 		provider := strings.TrimSpace(req.Provider)
 		apiKey := strings.TrimSpace(req.ApiKey)
-		if provider == "" || apiKey == "" {
+		if provider == "" || (apiKey == "" && strings.TrimSpace(req.BaseUrl) == "") {
 			writeJSON(w, http.StatusBadRequest, ModelsResponse{Message: "provider and apiKey required"})
 			return
 		}
 
-		models, message, err := fetchModels(provider, apiKey)
+		w, _, secrets := requestSecrets(w, r)
+		secrets.Add(apiKey)
+		resp, err := listModels(catalog, req, requestLanguage(r))
 		if err != nil {
-			writeJSON(w, http.StatusBadRequest, ModelsResponse{Message: err.Error()})
+			writeJSON(w, providerErrorStatus(err), resp)
 			return
 		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+const (
+	// maxBulkProviders caps the providers of one bulk request, since each
+	// may cost an upstream request.
+	maxBulkProviders = 32
+	// bulkWorkers is how many providers of a bulk request are listed at
+	// the same time.
+	bulkWorkers = 8
+)
 
-		writeJSON(w, http.StatusOK, ModelsResponse{Models: models, Message: message})
+// NewBulkModelsHandler lists models for several providers in parallel. A GET
+// uses the providers configured in data/conf; a POST takes an explicit list
+// of at most maxBulkProviders.
+func NewBulkModelsHandler(cfg ServerConfig, catalog *ModelCatalog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req BulkModelsRequest
+		switch r.Method {
+		case http.MethodGet:
+			configured, err := config.ConfiguredProviders(cfg.ConfigDir)
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, BulkModelsResponse{Message: err.Error()})
+				return
+			}
+			req.Filter = ModelFilter{
+				ChatOnly: queryBool(r, "chatOnly"),
+				Tools:    queryBool(r, "tools"),
+				Vision:   queryBool(r, "vision"),
+			}
+			for _, provider := range configured {
+				req.Providers = append(req.Providers, ModelsRequest{
+					Provider: provider.ID,
+					ApiKey:   provider.ApiKey,
+					Region:   provider.Region,
+					BaseUrl:  provider.BaseUrl,
+					Api:      provider.Api,
+				})
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSON(w, http.StatusBadRequest, BulkModelsResponse{Message: "invalid json"})
+				return
+			}
+			if len(req.Providers) > maxBulkProviders {
+				writeJSON(w, http.StatusBadRequest, BulkModelsResponse{Message: fmt.Sprintf("too many providers (max %d)", maxBulkProviders)})
+				return
+			}
+		default:
+			writeJSON(w, http.StatusMethodNotAllowed, BulkModelsResponse{Message: "method not allowed"})
+			return
+		}
+
+		w, _, secrets := requestSecrets(w, r)
+		lang := requestLanguage(r)
+		results := make([]ModelsResponse, len(req.Providers))
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for worker := 0; worker < bulkWorkers && worker < len(req.Providers); worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					results[i], _ = listModels(catalog, req.Providers[i], lang)
+				}
+			}()
+		}
+		for i := range req.Providers {
+			secrets.Add(req.Providers[i].ApiKey)
+			if req.Providers[i].Filter == (ModelFilter{}) {
+				req.Providers[i].Filter = req.Filter
+			}
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		writeJSON(w, http.StatusOK, BulkModelsResponse{Results: results})
 	})
 }
 
+func queryBool(r *http.Request, key string) bool {
+	value, _ := strconv.ParseBool(r.URL.Query().Get(key))
+	return value
+}
+
+func listModels(catalog *ModelCatalog, req ModelsRequest, lang string) (ModelsResponse, error) {
+	provider := strings.ToLower(strings.TrimSpace(req.Provider))
+	resp := ModelsResponse{Provider: provider}
+	list, err := catalog.list(modelSource{
+		Provider: provider,
+		Region:   strings.TrimSpace(req.Region),
+		BaseUrl:  strings.TrimSpace(req.BaseUrl),
+		Api:      strings.TrimSpace(req.Api),
+		ApiKey:   strings.TrimSpace(req.ApiKey),
+	})
+	if err != nil {
+		var providerErr *ProviderError
+		if errors.As(err, &providerErr) {
+			resp.Code = providerErr.Code
+			resp.UpstreamStatus = providerErr.Status
+			resp.Detail = providerErr.Detail
+			resp.Message = providerErr.LocalizedMessage(lang)
+			return resp, err
+		}
+		resp.Code = ProviderErrInvalidRequest
+		resp.Message = err.Error()
+		return resp, err
+	}
+	fetchedAt := list.FetchedAt.UTC()
+	resp.Details = filterModels(list.Models, req.Filter)
+	resp.Models = modelIDs(resp.Details)
+	resp.Message = list.Message
+	resp.FetchedAt = &fetchedAt
+	resp.Stale = list.Stale
+	return resp, nil
+}
+
 type openAIModelsResponse struct {
 	Data []struct {
 		ID string `json:"id"`
 	} `json:"data"`
+	HasMore bool   `json:"has_more"`
+	LastID  string `json:"last_id"`
 }
 
 type geminiModelsResponse struct {
 	Models []struct {
-		Name string `json:"name"`
+		Name                       string   `json:"name"`
+		SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
 	} `json:"models"`
+	NextPageToken string `json:"nextPageToken"`
 }
 
-func fetchModels(provider, apiKey string) ([]string, string, error) {
-	provider = strings.ToLower(provider)
-	client := &http.Client{Timeout: 15 * time.Second}
-
-	switch provider {
-	case "openai":
-		return fetchOpenAICompatible(client, "https://api.openai.com/v1/models", apiKey)
-	case "groq":
-		return fetchOpenAICompatible(client, "https://api.groq.com/openai/v1/models", apiKey)
-	case "mistral":
-		return fetchOpenAICompatible(client, "https://api.mistral.ai/v1/models", apiKey)
-	case "moonshot":
-		return fetchOpenAICompatible(client, "https://api.moonshot.cn/v1/models", apiKey)
-	case "deepseek":
-		return fetchOpenAICompatible(client, "https://api.deepseek.com/v1/models", apiKey)
-	case "qwen":
-		return fetchOpenAICompatible(client, "https://dashscope.aliyuncs.com/compatible-mode/v1/models", apiKey)
-	case "anthropic":
-		return fetchAnthropic(client, apiKey)
-	case "gemini":
-		return fetchGemini(client, apiKey)
-	case "cohere", "minimax", "zai", "custom":
-		return nil, "该提供商暂不支持自动拉取模型，请手动填写", nil
-	default:
-		return nil, "", fmt.Errorf("unknown provider")
-	}
+type cohereModelsResponse struct {
+	Models []struct {
+		Name      string   `json:"name"`
+		Endpoints []string `json:"endpoints"`
+		Features  []string `json:"features"`
+	} `json:"models"`
+	NextPageToken string `json:"next_page_token"`
 }
 
-func fetchOpenAICompatible(client *http.Client, url, apiKey string) ([]string, string, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, "", err
-	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+// maxModelPages bounds pagination in case a provider keeps returning new
+// cursors. A cursor seen before ends the listing as well.
+const maxModelPages = 50
 
-	resp, err := client.Do(req)
+func fetchModels(client *http.Client, src modelSource) ([]ModelInfo, string, error) {
+	provider := strings.ToLower(src.Provider)
+	apiKey := src.ApiKey
+
+	if provider == "custom" && strings.TrimSpace(src.BaseUrl) == "" {
+		return nil, "该提供商暂不支持自动拉取模型，请手动填写", nil
+	}
+	baseUrl, _, err := config.ResolveEndpoint(provider, src.Region, src.BaseUrl)
 	if err != nil {
 		return nil, "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, "", fmt.Errorf("provider error: %s", strings.TrimSpace(string(body)))
+	start := time.Now()
+	var models []ModelInfo
+	var message string
+	switch {
+	case src.Api == "anthropic-messages", src.Api == "" && provider == "anthropic":
+		models, message, err = fetchAnthropic(client, baseUrl, apiKey)
+	case src.Api == "google-generative-ai", src.Api == "" && provider == "gemini":
+		models, message, err = fetchGemini(client, baseUrl, apiKey)
+	case src.Api == "" && provider == "cohere":
+		models, message, err = fetchCohere(client, baseUrl, apiKey)
+	default:
+		models, message, err = fetchOpenAICompatible(client, baseUrl+"/models", apiKey)
+	}
+	label := metricProvider(provider)
+	providerFetchDuration.observe(time.Since(start), label)
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		providerErr.Provider = provider
+		providerFetchErrors.inc(label, providerErr.Code)
+	} else if err != nil {
+		providerFetchErrors.inc(label, ProviderErrUpstream)
 	}
+	return models, message, err
+}
 
-	var payload openAIModelsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, "", err
+// providerErrorStatus is the HTTP status for a failed model listing.
+func providerErrorStatus(err error) int {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.HTTPStatus()
 	}
+	return http.StatusBadRequest
+}
 
-	models := make([]string, 0, len(payload.Data))
-	for _, item := range payload.Data {
-		if strings.TrimSpace(item.ID) == "" {
-			continue
+func fetchOpenAICompatible(client *http.Client, endpoint, apiKey string) ([]ModelInfo, string, error) {
+	var models []ModelInfo
+	after := ""
+	seen := make(map[string]bool)
+	for page := 0; page < maxModelPages; page++ {
+		pageURL := endpoint
+		if after != "" {
+			pageURL = withQuery(endpoint, "after", after)
 		}
-		models = append(models, item.ID)
+		req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+
+		var payload openAIModelsResponse
+		if err := doProviderRequest(client, req, &payload); err != nil {
+			return nil, "", err
+		}
+		for _, item := range payload.Data {
+			if strings.TrimSpace(item.ID) == "" {
+				continue
+			}
+			models = append(models, classifyModel(item.ID))
+		}
+		if !payload.HasMore || payload.LastID == "" || seen[payload.LastID] {
+			break
+		}
+		after = payload.LastID
+		seen[after] = true
 	}
 	return models, "", nil
 }
 
-func fetchAnthropic(client *http.Client, apiKey string) ([]string, string, error) {
-	req, err := http.NewRequest(http.MethodGet, "https://api.anthropic.com/v1/models", nil)
-	if err != nil {
-		return nil, "", err
-	}
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, "", err
-	}
-	defer resp.Body.Close()
+func fetchAnthropic(client *http.Client, baseUrl, apiKey string) ([]ModelInfo, string, error) {
+	var models []ModelInfo
+	after := ""
+	seen := make(map[string]bool)
+	for page := 0; page < maxModelPages; page++ {
+		pageURL := withQuery(baseUrl+"/v1/models", "limit", "1000")
+		if after != "" {
+			pageURL = withQuery(pageURL, "after_id", after)
+		}
+		req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
 
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, "", fmt.Errorf("provider error: %s", strings.TrimSpace(string(body)))
+		var payload openAIModelsResponse
+		if err := doProviderRequest(client, req, &payload); err != nil {
+			return nil, "", err
+		}
+		for _, item := range payload.Data {
+			if strings.TrimSpace(item.ID) == "" {
+				continue
+			}
+			models = append(models, ModelInfo{ID: item.ID, Kind: modelKindChat, Tools: true, Vision: true})
+		}
+		if !payload.HasMore || payload.LastID == "" || seen[payload.LastID] {
+			break
+		}
+		after = payload.LastID
+		seen[after] = true
 	}
+	return models, "", nil
+}
 
-	var payload openAIModelsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, "", err
-	}
+func fetchGemini(client *http.Client, baseUrl, apiKey string) ([]ModelInfo, string, error) {
+	var models []ModelInfo
+	pageToken := ""
+	seen := make(map[string]bool)
+	for page := 0; page < maxModelPages; page++ {
+		pageURL := withQuery(baseUrl+"/models", "pageSize", "1000")
+		if pageToken != "" {
+			pageURL = withQuery(pageURL, "pageToken", pageToken)
+		}
+		req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("x-goog-api-key", apiKey)
 
-	models := make([]string, 0, len(payload.Data))
-	for _, item := range payload.Data {
-		if strings.TrimSpace(item.ID) == "" {
-			continue
+		var payload geminiModelsResponse
+		if err := doProviderRequest(client, req, &payload); err != nil {
+			return nil, "", err
 		}
-		models = append(models, item.ID)
+		for _, item := range payload.Models {
+			name := strings.TrimSpace(item.Name)
+			name = strings.TrimPrefix(name, "models/")
+			if name == "" {
+				continue
+			}
+			models = append(models, classifyGeminiModel(name, item.SupportedGenerationMethods))
+		}
+		if payload.NextPageToken == "" || seen[payload.NextPageToken] {
+			break
+		}
+		pageToken = payload.NextPageToken
+		seen[pageToken] = true
 	}
 	return models, "", nil
 }
 
-func fetchGemini(client *http.Client, apiKey string) ([]string, string, error) {
-	url := "https://generativelanguage.googleapis.com/v1beta/models?key=" + apiKey
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, "", err
+// fetchCohere uses Cohere's native list endpoint, which reports the
+// endpoints and features of each model instead of leaving them to guesswork.
+func fetchCohere(client *http.Client, baseUrl, apiKey string) ([]ModelInfo, string, error) {
+	var models []ModelInfo
+	pageToken := ""
+	seen := make(map[string]bool)
+	for page := 0; page < maxModelPages; page++ {
+		pageURL := withQuery(baseUrl+"/v1/models", "page_size", "1000")
+		if pageToken != "" {
+			pageURL = withQuery(pageURL, "page_token", pageToken)
+		}
+		req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+
+		var payload cohereModelsResponse
+		if err := doProviderRequest(client, req, &payload); err != nil {
+			return nil, "", err
+		}
+		for _, item := range payload.Models {
+			name := strings.TrimSpace(item.Name)
+			if name == "" {
+				continue
+			}
+			models = append(models, classifyCohereModel(name, item.Endpoints, item.Features))
+		}
+		if payload.NextPageToken == "" || seen[payload.NextPageToken] {
+			break
+		}
+		pageToken = payload.NextPageToken
+		seen[pageToken] = true
 	}
+	return models, "", nil
+}
 
+// doProviderRequest sends req and decodes a successful JSON response into out.
+func doProviderRequest(client *http.Client, req *http.Request, out interface{}) error {
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, "", err
+		return classifyTransportError(err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, "", fmt.Errorf("provider error: %s", strings.TrimSpace(string(body)))
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return classifyStatusError(resp.StatusCode, body)
 	}
 
-	var payload geminiModelsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, "", err
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &ProviderError{Code: ProviderErrUnexpectedSchema, Status: resp.StatusCode, Err: err}
 	}
+	return nil
+}
 
-	models := make([]string, 0, len(payload.Models))
-	for _, item := range payload.Models {
-		name := strings.TrimSpace(item.Name)
-		name = strings.TrimPrefix(name, "models/")
-		if name == "" {
-			continue
-		}
-		models = append(models, name)
+func withQuery(rawURL, key, value string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
 	}
-	return models, "", nil
+	query := parsed.Query()
+	query.Set(key, value)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
 }
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// serveFixture answers requests for path with the recorded response in
+// testdata, after checking the bearer key.
+func serveFixture(t *testing.T, path, fixture string) http.HandlerFunc {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q, want the bearer key", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+func TestFetchModelsRecordedLists(t *testing.T) {
+	tests := []struct {
+		provider string
+		basePath string
+		handler  func(t *testing.T) http.HandlerFunc
+		want     []ModelInfo
+	}{
+		{
+			provider: "cohere",
+			handler: func(t *testing.T) http.HandlerFunc {
+				first := serveFixture(t, "/v1/models", "cohere_models_page1.json")
+				second := serveFixture(t, "/v1/models", "cohere_models_page2.json")
+				return func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Query().Get("page_size") == "" {
+						t.Errorf("page_size is not set: %s", r.URL)
+					}
+					switch r.URL.Query().Get("page_token") {
+					case "":
+						first(w, r)
+					case "page-2":
+						second(w, r)
+					default:
+						t.Errorf("unexpected page_token in %s", r.URL)
+						http.NotFound(w, r)
+					}
+				}
+			},
+			want: []ModelInfo{
+				{ID: "command-r-plus-08-2024", Kind: modelKindChat, Tools: true},
+				{ID: "embed-multilingual-v3.0", Kind: modelKindEmbedding},
+				{ID: "command-a-vision-07-2025", Kind: modelKindChat, Vision: true},
+				{ID: "rerank-v3.5", Kind: modelKindEmbedding},
+			},
+		},
+		{
+			provider: "minimax",
+			basePath: "/v1",
+			handler: func(t *testing.T) http.HandlerFunc {
+				return serveFixture(t, "/v1/models", "minimax_models.json")
+			},
+			want: []ModelInfo{
+				{ID: "MiniMax-M1", Kind: modelKindChat, Tools: true},
+				{ID: "MiniMax-Text-01", Kind: modelKindChat, Tools: true},
+				{ID: "speech-02-hd", Kind: modelKindAudio},
+			},
+		},
+		{
+			provider: "zai",
+			basePath: "/api/paas/v4",
+			handler: func(t *testing.T) http.HandlerFunc {
+				return serveFixture(t, "/api/paas/v4/models", "zai_models.json")
+			},
+			want: []ModelInfo{
+				{ID: "glm-4.5", Kind: modelKindChat, Tools: true},
+				{ID: "glm-4.5-air", Kind: modelKindChat, Tools: true},
+				{ID: "glm-4v-plus", Kind: modelKindChat, Tools: true, Vision: true},
+				{ID: "embedding-3", Kind: modelKindEmbedding},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler(t))
+			defer server.Close()
+
+			models, message, err := fetchModels(server.Client(), modelSource{
+				Provider: tt.provider,
+				BaseUrl:  server.URL + tt.basePath,
+				ApiKey:   "test-key",
+			})
+			if err != nil {
+				t.Fatalf("fetchModels: %v", err)
+			}
+			if message != "" {
+				t.Errorf("message = %q, want none", message)
+			}
+			if !reflect.DeepEqual(models, tt.want) {
+				t.Errorf("models = %+v\nwant %+v", models, tt.want)
+			}
+		})
+	}
+}
+
+// TestFetchModelsErrorsMatchOpenAICompatible serves the same failure to
+// each provider client and to fetchOpenAICompatible and expects the same
+// classification.
+func TestFetchModelsErrorsMatchOpenAICompatible(t *testing.T) {
+	responses := []struct {
+		name   string
+		status int
+		body   string
+		code   string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"error":{"message":"invalid api key"}}`, ProviderErrInvalidKey},
+		{"rate limited", http.StatusTooManyRequests, `{"error":{"message":"slow down"}}`, ProviderErrRateLimited},
+		{"not json", http.StatusOK, `<html><body>captive portal</body></html>`, ProviderErrUnexpectedSchema},
+		{"empty list", http.StatusOK, `{"object":"list","data":[],"models":[]}`, ""},
+	}
+	providers := []struct {
+		id       string
+		basePath string
+	}{
+		{"cohere", ""},
+		{"minimax", "/v1"},
+		{"zai", "/api/paas/v4"},
+	}
+	for _, response := range responses {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(response.status)
+			_, _ = w.Write([]byte(response.body))
+		}))
+
+		wantModels, _, wantErr := fetchOpenAICompatible(server.Client(), server.URL+"/models", "test-key")
+		wantCode := providerErrorCode(wantErr)
+		if wantCode != response.code {
+			t.Errorf("%s: fetchOpenAICompatible code = %q, want %q", response.name, wantCode, response.code)
+		}
+		for _, provider := range providers {
+			t.Run(response.name+"/"+provider.id, func(t *testing.T) {
+				models, _, err := fetchModels(server.Client(), modelSource{
+					Provider: provider.id,
+					BaseUrl:  server.URL + provider.basePath,
+					ApiKey:   "test-key",
+				})
+				if code := providerErrorCode(err); code != wantCode {
+					t.Errorf("error code = %q (%v), want %q like fetchOpenAICompatible", code, err, wantCode)
+				}
+				if err != nil {
+					var providerErr *ProviderError
+					if errors.As(err, &providerErr) && providerErr.Provider != provider.id {
+						t.Errorf("error provider = %q, want %q", providerErr.Provider, provider.id)
+					}
+				}
+				if len(models) != len(wantModels) {
+					t.Errorf("got %d models, want %d", len(models), len(wantModels))
+				}
+			})
+		}
+		server.Close()
+	}
+}
+
+func providerErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		return providerErr.Code
+	}
+	return "unclassified: " + err.Error()
+}
+
+// pagedDialect describes how one provider API pages its model list.
+type pagedDialect struct {
+	provider string
+	basePath string
+	path     string
+	cursor   string
+	render   func(ids []string, next string) interface{}
+}
+
+var pagedDialects = []pagedDialect{
+	{
+		provider: "openai", basePath: "/v1", path: "/v1/models", cursor: "after",
+		render: func(ids []string, next string) interface{} {
+			return openAIPage(ids, next)
+		},
+	},
+	{
+		provider: "anthropic", path: "/v1/models", cursor: "after_id",
+		render: func(ids []string, next string) interface{} {
+			return openAIPage(ids, next)
+		},
+	},
+	{
+		provider: "gemini", path: "/models", cursor: "pageToken",
+		render: func(ids []string, next string) interface{} {
+			models := make([]map[string]interface{}, 0, len(ids))
+			for _, id := range ids {
+				models = append(models, map[string]interface{}{"name": "models/" + id, "supportedGenerationMethods": []string{"generateContent"}})
+			}
+			return map[string]interface{}{"models": models, "nextPageToken": next}
+		},
+	},
+}
+
+func openAIPage(ids []string, next string) interface{} {
+	data := make([]map[string]string, 0, len(ids))
+	for _, id := range ids {
+		data = append(data, map[string]string{"id": id})
+	}
+	return map[string]interface{}{"data": data, "has_more": next != "", "last_id": next}
+}
+
+// TestFetchModelsPaginates serves several pages to each paging dialect:
+// a plain chain, a chain whose cursor loops back, and one that never ends.
+func TestFetchModelsPaginates(t *testing.T) {
+	type page struct {
+		ids  []string
+		next string
+	}
+	cases := []struct {
+		name         string
+		pages        func(cursor string) page
+		wantIDs      []string
+		wantRequests int
+	}{
+		{
+			name: "three pages",
+			pages: func(cursor string) page {
+				return map[string]page{
+					"":   {[]string{"m1", "m2"}, "c1"},
+					"c1": {[]string{"m3"}, "c2"},
+					"c2": {[]string{"m4"}, ""},
+				}[cursor]
+			},
+			wantIDs:      []string{"m1", "m2", "m3", "m4"},
+			wantRequests: 3,
+		},
+		{
+			name: "cursor cycle",
+			pages: func(cursor string) page {
+				return map[string]page{
+					"":   {[]string{"m1"}, "c1"},
+					"c1": {[]string{"m2"}, "c2"},
+					"c2": {[]string{"m3"}, "c1"},
+				}[cursor]
+			},
+			wantIDs:      []string{"m1", "m2", "m3"},
+			wantRequests: 3,
+		},
+		{
+			name: "endless cursors",
+			pages: func(cursor string) page {
+				n, _ := strconv.Atoi(strings.TrimPrefix(cursor, "c"))
+				return page{[]string{fmt.Sprintf("m%d", n)}, fmt.Sprintf("c%d", n+1)}
+			},
+			wantRequests: maxModelPages,
+		},
+	}
+	for _, dialect := range pagedDialects {
+		for _, tc := range cases {
+			t.Run(dialect.provider+"/"+tc.name, func(t *testing.T) {
+				var requests int
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != dialect.path {
+						http.NotFound(w, r)
+						return
+					}
+					requests++
+					p := tc.pages(r.URL.Query().Get(dialect.cursor))
+					w.Header().Set("Content-Type", "application/json")
+					_ = json.NewEncoder(w).Encode(dialect.render(p.ids, p.next))
+				}))
+				defer server.Close()
+
+				models, _, err := fetchModels(server.Client(), modelSource{
+					Provider: dialect.provider,
+					BaseUrl:  server.URL + dialect.basePath,
+					ApiKey:   "test-key",
+				})
+				if err != nil {
+					t.Fatalf("fetchModels: %v", err)
+				}
+				if requests != tc.wantRequests {
+					t.Errorf("%d requests, want %d", requests, tc.wantRequests)
+				}
+				ids := modelIDs(models)
+				if tc.wantIDs != nil && !reflect.DeepEqual(ids, tc.wantIDs) {
+					t.Errorf("ids = %v, want %v", ids, tc.wantIDs)
+				}
+				if tc.wantIDs == nil && len(ids) != maxModelPages {
+					t.Errorf("%d ids, want one per page up to %d", len(ids), maxModelPages)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"openclaw-setup/internal/config"
+)
+
+const defaultOutboundTimeout = 15 * time.Second
+
+// OutboundConfig controls how the server reaches model providers. Without
+// a ProxyURL the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables
+// of the process apply.
+type OutboundConfig struct {
+	ProxyURL string
+	NoProxy  string
+	CAFiles  []string
+	Timeout  time.Duration
+}
+
+// NewOutboundClient builds the HTTP client used for every provider request.
+func NewOutboundClient(cfg OutboundConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if strings.TrimSpace(cfg.ProxyURL) != "" {
+		proxyURL, err := config.ParseProxyURL(cfg.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		if password, ok := proxyURL.User.Password(); ok {
+			config.Secrets.Add(password)
+		}
+		bypass := parseNoProxy(cfg.NoProxy)
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if bypass.match(req.URL) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+
+	if len(cfg.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, path := range cfg.CAFiles {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("read ca bundle: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(content) {
+				return nil, fmt.Errorf("ca bundle %s contains no PEM certificates", path)
+			}
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultOutboundTimeout
+	}
+	if timeout < 0 {
+		return nil, fmt.Errorf("outbound timeout must be positive")
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// ProxyEnv returns the proxy settings to mirror into the gateway's .env, or
+// nil when no explicit proxy is configured.
+func (c OutboundConfig) ProxyEnv() *config.ProxySettings {
+	if strings.TrimSpace(c.ProxyURL) == "" {
+		return nil
+	}
+	return &config.ProxySettings{URL: strings.TrimSpace(c.ProxyURL), NoProxy: strings.TrimSpace(c.NoProxy)}
+}
+
+// noProxyList follows the usual NO_PROXY conventions: "*" disables the
+// proxy, entries are host names (matching subdomains too, with or without a
+// leading dot), IP addresses or CIDR ranges, each optionally with a port.
+// Loopback hosts always bypass the proxy, like Go's default behaviour.
+type noProxyList struct {
+	all     bool
+	domains []noProxyEntry
+	ips     []noProxyEntry
+	nets    []*net.IPNet
+}
+
+type noProxyEntry struct {
+	host string
+	port string
+}
+
+func parseNoProxy(value string) noProxyList {
+	var list noProxyList
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "*" {
+			list.all = true
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(field); err == nil {
+			list.nets = append(list.nets, ipNet)
+			continue
+		}
+		host, port := field, ""
+		if h, p, err := net.SplitHostPort(field); err == nil {
+			host, port = h, p
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			list.ips = append(list.ips, noProxyEntry{host: ip.String(), port: port})
+			continue
+		}
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "*"), ".")
+		if host != "" {
+			list.domains = append(list.domains, noProxyEntry{host: host, port: port})
+		}
+	}
+	return list
+}
+
+func (l noProxyList) match(target *url.URL) bool {
+	if l.all {
+		return true
+	}
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	if port == "" {
+		// An entry such as api.openai.com:443 applies to URLs that leave
+		// the default port out.
+		switch target.Scheme {
+		case "https":
+			port = "443"
+		case "http":
+			port = "80"
+		}
+	}
+	if host == "localhost" {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsLoopback() {
+			return true
+		}
+		for _, ipNet := range l.nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		for _, entry := range l.ips {
+			if entry.host == ip.String() && (entry.port == "" || entry.port == port) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, entry := range l.domains {
+		if entry.port != "" && entry.port != port {
+			continue
+		}
+		if host == entry.host || strings.HasSuffix(host, "."+entry.host) {
+			return true
+		}
+	}
+	return false
+}
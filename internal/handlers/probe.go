@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"openclaw-setup/internal/config"
+)
+
+type ProbeRequest struct {
+	BaseUrl string `json:"baseUrl"`
+	ApiKey  string `json:"apiKey,omitempty"`
+}
+
+// DialectProbe is the outcome of probing one API dialect. BaseUrl is the
+// value to configure as models.providers.*.baseUrl for that dialect, which
+// differs between them: OpenAI style URLs end in /v1, Gemini in /v1beta and
+// Anthropic has neither.
+type DialectProbe struct {
+	Api       string `json:"api"`
+	Endpoint  string `json:"endpoint"`
+	BaseUrl   string `json:"baseUrl"`
+	Supported bool   `json:"supported"`
+	Status    int    `json:"status,omitempty"`
+	// Code is set when the endpoint exists but the request failed, such as
+	// invalid_key, or when it could not be reached at all.
+	Code   string `json:"code,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type ProbeResponse struct {
+	BaseUrl     string         `json:"baseUrl,omitempty"`
+	Results     []DialectProbe `json:"results,omitempty"`
+	Recommended string         `json:"recommended,omitempty"`
+	Message     string         `json:"message,omitempty"`
+	Code        string         `json:"code,omitempty"`
+}
+
+// dialectProbe describes how to recognise one dialect on a server root.
+// Listing endpoints must answer with the expected JSON; for endpoints that
+// only accept POST an empty request is sent, and a JSON validation error
+// shows the route exists. Auth and quota errors only count when their body
+// has the dialect's error shape, since proxies that check the key before
+// routing answer every path alike.
+type dialectProbe struct {
+	api        string
+	method     string
+	path       string
+	baseDir    string
+	auth       func(h http.Header, apiKey string)
+	accept     func(body []byte) bool
+	errorShape func(body []byte) bool
+}
+
+// dialectProbes is also the order of preference for Recommended.
+var dialectProbes = []dialectProbe{
+	{
+		api: "openai-completions", method: http.MethodGet, path: "/v1/models", baseDir: "/v1",
+		auth:       bearerAuth,
+		accept:     hasJSONField("data"),
+		errorShape: isOpenAIError,
+	},
+	{
+		api: "anthropic-messages", method: http.MethodPost, path: "/v1/messages",
+		auth: func(h http.Header, apiKey string) {
+			h.Set("x-api-key", apiKey)
+			h.Set("anthropic-version", "2023-06-01")
+		},
+		errorShape: isAnthropicError,
+	},
+	{
+		api: "google-generative-ai", method: http.MethodGet, path: "/v1beta/models", baseDir: "/v1beta",
+		auth: func(h http.Header, apiKey string) {
+			h.Set("x-goog-api-key", apiKey)
+		},
+		accept:     hasJSONField("models"),
+		errorShape: isGoogleError,
+	},
+	{
+		api: "openai-responses", method: http.MethodPost, path: "/v1/responses", baseDir: "/v1",
+		auth:       bearerAuth,
+		errorShape: isOpenAIError,
+	},
+}
+
+func bearerAuth(h http.Header, apiKey string) {
+	h.Set("Authorization", "Bearer "+apiKey)
+}
+
+func hasJSONField(name string) func([]byte) bool {
+	return func(body []byte) bool {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return false
+		}
+		_, ok := doc[name]
+		return ok
+	}
+}
+
+// errorEnvelope covers the error bodies of the three dialects:
+//
+//	OpenAI:    {"error": {"message": "...", "type": "..."}}
+//	Anthropic: {"type": "error", "error": {"type": "...", "message": "..."}}
+//	Google:    {"error": {"code": 401, "message": "...", "status": "..."}}
+type errorEnvelope struct {
+	Type  string `json:"type"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+func parseErrorEnvelope(body []byte) (errorEnvelope, bool) {
+	var envelope errorEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error == nil {
+		return errorEnvelope{}, false
+	}
+	return envelope, true
+}
+
+func isOpenAIError(body []byte) bool {
+	envelope, ok := parseErrorEnvelope(body)
+	return ok && envelope.Type == "" && envelope.Error.Message != "" && envelope.Error.Status == ""
+}
+
+func isAnthropicError(body []byte) bool {
+	envelope, ok := parseErrorEnvelope(body)
+	return ok && envelope.Type == "error" && envelope.Error.Type != ""
+}
+
+func isGoogleError(body []byte) bool {
+	envelope, ok := parseErrorEnvelope(body)
+	return ok && envelope.Error.Status != ""
+}
+
+// NewProbeHandler serves POST /api/probe, which reports the API dialects a
+// base URL speaks. A nil client means the default outbound client.
+func NewProbeHandler(client *http.Client) http.Handler {
+	if client == nil {
+		client, _ = NewOutboundClient(OutboundConfig{})
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, ProbeResponse{Message: "method not allowed"})
+			return
+		}
+		var req ProbeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, ProbeResponse{Message: "invalid json"})
+			return
+		}
+		w, r, secrets := requestSecrets(w, r)
+		secrets.Add(strings.TrimSpace(req.ApiKey))
+
+		resp, err := ProbeDialects(r.Context(), client, req.BaseUrl, req.ApiKey)
+		if err != nil {
+			resp.Message = err.Error()
+			var providerErr *ProviderError
+			if errors.As(err, &providerErr) {
+				resp.Code = providerErr.Code
+				resp.Message = providerErr.LocalizedMessage(requestLanguage(r))
+			}
+			writeJSON(w, providerErrorStatus(err), resp)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
+
+// ProbeDialects checks which API dialects the server at baseUrl answers.
+// baseUrl may be given with or without a trailing /v1 or /v1beta. It fails
+// only when the URL is invalid or the server cannot be reached at all.
+func ProbeDialects(ctx context.Context, client *http.Client, baseUrl, apiKey string) (ProbeResponse, error) {
+	root, err := probeRoot(baseUrl)
+	if err != nil {
+		return ProbeResponse{}, &ProviderError{Code: ProviderErrInvalidRequest, Detail: err.Error(), Err: err}
+	}
+	apiKey = strings.TrimSpace(apiKey)
+
+	results := make([]DialectProbe, len(dialectProbes))
+	errs := make([]error, len(dialectProbes))
+	var wg sync.WaitGroup
+	for i, probe := range dialectProbes {
+		wg.Add(1)
+		go func(i int, probe dialectProbe) {
+			defer wg.Done()
+			results[i], errs[i] = runDialectProbe(ctx, client, root, apiKey, probe)
+		}(i, probe)
+	}
+	wg.Wait()
+
+	resp := ProbeResponse{BaseUrl: root, Results: results}
+	unreachable := 0
+	for i, result := range results {
+		if errs[i] != nil {
+			unreachable++
+		}
+		if result.Supported && resp.Recommended == "" {
+			resp.Recommended = result.Api
+		}
+	}
+	if unreachable == len(results) {
+		return resp, errs[0]
+	}
+	return resp, nil
+}
+
+func runDialectProbe(ctx context.Context, client *http.Client, root, apiKey string, probe dialectProbe) (DialectProbe, error) {
+	result := DialectProbe{
+		Api:      probe.api,
+		Endpoint: root + probe.path,
+		BaseUrl:  root + probe.baseDir,
+	}
+
+	var body io.Reader
+	if probe.method == http.MethodPost {
+		body = bytes.NewReader([]byte("{}"))
+	}
+	req, err := http.NewRequestWithContext(ctx, probe.method, result.Endpoint, body)
+	if err != nil {
+		return result, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey != "" {
+		probe.auth(req.Header, apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		providerErr := classifyTransportError(err)
+		result.Code = providerErr.Code
+		result.Detail = redactorFor(ctx).Redact(err.Error())
+		return result, providerErr
+	}
+	defer resp.Body.Close()
+	payload, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	result.Status = resp.StatusCode
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusMethodNotAllowed:
+		return result, nil
+	case !json.Valid(payload):
+		result.Code = ProviderErrUnexpectedSchema
+		return result, nil
+	case resp.StatusCode == http.StatusBadRequest, resp.StatusCode == http.StatusUnprocessableEntity:
+		// The empty probe request was rejected as invalid, so the route is there.
+		result.Supported = true
+	case resp.StatusCode >= 400:
+		providerErr := classifyStatusError(resp.StatusCode, payload)
+		result.Code = providerErr.Code
+		result.Detail = providerErr.Detail
+		// An auth or quota error in the dialect's own error shape still
+		// shows the route exists; server errors prove nothing.
+		result.Supported = resp.StatusCode < 500 && probe.errorShape(payload)
+	case probe.accept != nil:
+		result.Supported = probe.accept(payload)
+		if !result.Supported {
+			result.Code = ProviderErrUnexpectedSchema
+		}
+	default:
+		result.Supported = true
+	}
+	return result, nil
+}
+
+// probeRoot strips the version segment from baseUrl so every dialect's
+// path can be appended.
+func probeRoot(baseUrl string) (string, error) {
+	if strings.TrimSpace(baseUrl) == "" {
+		return "", errors.New("base url is required")
+	}
+	root, _, err := config.ResolveEndpoint("", "", baseUrl)
+	if err != nil {
+		return "", err
+	}
+	for _, suffix := range []string{"/v1beta", "/v1"} {
+		if trimmed, ok := strings.CutSuffix(root, suffix); ok {
+			return trimmed, nil
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"openclaw-setup/internal/config"
+)
+
+const (
+	openAIAuthError    = `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`
+	anthropicAuthError = `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`
+	googleAuthError    = `{"error":{"code":403,"message":"API key not valid","status":"PERMISSION_DENIED"}}`
+)
+
+// routes answers each path with a fixed status and body and 404 otherwise.
+func routes(responses map[string]struct {
+	status int
+	body   string
+}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(response.status)
+		_, _ = w.Write([]byte(response.body))
+	}
+}
+
+// everyPath answers every path alike, like a proxy that checks the key
+// before routing.
+func everyPath(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func TestProbeDialectsAuthErrors(t *testing.T) {
+	type response = struct {
+		status int
+		body   string
+	}
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		supported   []string
+		recommended string
+	}{
+		{
+			name: "anthropic with a bad key",
+			handler: routes(map[string]response{
+				"/v1/messages": {http.StatusUnauthorized, anthropicAuthError},
+			}),
+			supported:   []string{"anthropic-messages"},
+			recommended: "anthropic-messages",
+		},
+		{
+			name: "google with a bad key",
+			handler: routes(map[string]response{
+				"/v1beta/models": {http.StatusForbidden, googleAuthError},
+			}),
+			supported:   []string{"google-generative-ai"},
+			recommended: "google-generative-ai",
+		},
+		{
+			name: "openai rate limited",
+			handler: routes(map[string]response{
+				"/v1/models":    {http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","type":"requests"}}`},
+				"/v1/responses": {http.StatusTooManyRequests, `{"error":{"message":"Rate limit reached","type":"requests"}}`},
+			}),
+			supported:   []string{"openai-completions", "openai-responses"},
+			recommended: "openai-completions",
+		},
+		{
+			name:        "auth-first proxy in the openai shape",
+			handler:     everyPath(http.StatusUnauthorized, openAIAuthError),
+			supported:   []string{"openai-completions", "openai-responses"},
+			recommended: "openai-completions",
+		},
+		{
+			name:    "auth-first proxy in its own shape",
+			handler: everyPath(http.StatusUnauthorized, `{"message":"Unauthorized"}`),
+		},
+		{
+			name:    "anthropic error shape on the google route",
+			handler: everyPath(http.StatusForbidden, anthropicAuthError),
+			// Only the Anthropic route accepts the Anthropic envelope.
+			supported:   []string{"anthropic-messages"},
+			recommended: "anthropic-messages",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			resp, err := ProbeDialects(context.Background(), server.Client(), server.URL+"/v1", "bad-key")
+			if err != nil {
+				t.Fatalf("ProbeDialects: %v", err)
+			}
+			want := make(map[string]bool)
+			for _, api := range tt.supported {
+				want[api] = true
+			}
+			for _, result := range resp.Results {
+				if result.Supported != want[result.Api] {
+					t.Errorf("%s: supported = %v, want %v (status %d, code %q)", result.Api, result.Supported, want[result.Api], result.Status, result.Code)
+				}
+			}
+			if resp.Recommended != tt.recommended {
+				t.Errorf("recommended = %q, want %q", resp.Recommended, tt.recommended)
+			}
+		})
+	}
+}
+
+func TestProbeDialectsKeepsErrorCode(t *testing.T) {
+	server := httptest.NewServer(everyPath(http.StatusUnauthorized, `{"message":"Unauthorized"}`))
+	defer server.Close()
+
+	resp, err := ProbeDialects(context.Background(), server.Client(), server.URL, "bad-key")
+	if err != nil {
+		t.Fatalf("ProbeDialects: %v", err)
+	}
+	for _, result := range resp.Results {
+		if result.Supported || result.Code != ProviderErrInvalidKey {
+			t.Errorf("%s: supported = %v, code = %q, want unsupported with %q", result.Api, result.Supported, result.Code, ProviderErrInvalidKey)
+		}
+	}
+}
+
+// TestProbeKeyStaysInItsRequest sends a key the upstream echoes back and
+// expects it redacted from that response only.
+func TestProbeKeyStaysInItsRequest(t *testing.T) {
+	const apiKey = "client-probe-key-0001"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		everyPath(http.StatusBadGateway, `{"error":{"message":"upstream rejected `+strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")+`"}}`)(w, r)
+	}))
+	defer upstream.Close()
+
+	rec := httptest.NewRecorder()
+	body := `{"baseUrl":"` + upstream.URL + `","apiKey":"` + apiKey + `"}`
+	NewProbeHandler(upstream.Client()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/probe", strings.NewReader(body)))
+	if strings.Contains(rec.Body.String(), apiKey) || !strings.Contains(rec.Body.String(), "upstream rejected") {
+		t.Errorf("response = %s, want the upstream error without the key", rec.Body)
+	}
+	if got := config.Secrets.Redact(apiKey); got != apiKey {
+		t.Errorf("the request's key reached the global redactor: %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	writeJSON(rec, http.StatusOK, map[string]string{"note": apiKey})
+	if !strings.Contains(rec.Body.String(), apiKey) {
+		t.Errorf("a later response was redacted: %s", rec.Body)
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Stable codes for provider failures. Clients match on these, so they must
+// not change once released.
+const (
+	ProviderErrInvalidKey        = "invalid_key"
+	ProviderErrInsufficientQuota = "insufficient_quota"
+	ProviderErrRateLimited       = "rate_limited"
+	ProviderErrRegionBlocked     = "region_blocked"
+	ProviderErrDNS               = "dns_error"
+	ProviderErrTLS               = "tls_error"
+	ProviderErrTimeout           = "timeout"
+	ProviderErrNetwork           = "network_error"
+	ProviderErrUnexpectedSchema  = "unexpected_schema"
+	ProviderErrUpstream          = "upstream_error"
+	ProviderErrInvalidRequest    = "invalid_request"
+)
+
+// maxProviderErrorDetail bounds how much of an upstream error body is kept.
+const maxProviderErrorDetail = 300
+
+// ProviderError is a classified failure talking to a model provider.
+// Status is the upstream HTTP status, or 0 when no response arrived.
+type ProviderError struct {
+	Code     string
+	Provider string
+	Status   int
+	Detail   string
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	var b strings.Builder
+	if e.Provider != "" {
+		b.WriteString(e.Provider + ": ")
+	}
+	b.WriteString(strings.ReplaceAll(e.Code, "_", " "))
+	if e.Status != 0 {
+		fmt.Fprintf(&b, " (HTTP %d)", e.Status)
+	}
+	switch {
+	case e.Detail != "":
+		b.WriteString(": " + e.Detail)
+	case e.Err != nil:
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus is the status the setup API answers with for this failure.
+func (e *ProviderError) HTTPStatus() int {
+	switch e.Code {
+	case ProviderErrInvalidKey, ProviderErrInsufficientQuota, ProviderErrRegionBlocked:
+		return http.StatusUnprocessableEntity
+	case ProviderErrRateLimited:
+		return http.StatusTooManyRequests
+	case ProviderErrTimeout:
+		return http.StatusGatewayTimeout
+	case ProviderErrInvalidRequest:
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+var providerErrorMessages = map[string]map[string]string{
+	ProviderErrInvalidKey: {
+		"zh": "API Key 无效或没有访问权限，请检查后重试",
+		"en": "The API key is invalid or lacks permission",
+	},
+	ProviderErrInsufficientQuota: {
+		"zh": "API Key 有效，但账户余额或额度不足",
+		"en": "The API key is valid but the account is out of credit or quota",
+	},
+	ProviderErrRateLimited: {
+		"zh": "请求过于频繁，已被提供商限流，请稍后重试",
+		"en": "The provider is rate limiting requests, try again later",
+	},
+	ProviderErrRegionBlocked: {
+		"zh": "提供商不支持当前所在地区，请切换接入地址或配置代理",
+		"en": "The provider does not serve this region, switch endpoint or use a proxy",
+	},
+	ProviderErrDNS: {
+		"zh": "无法解析提供商域名，请检查 DNS 或网络设置",
+		"en": "The provider host name could not be resolved, check DNS",
+	},
+	ProviderErrTLS: {
+		"zh": "TLS 握手失败，可能需要配置代理或信任企业 CA 证书",
+		"en": "TLS handshake failed, a proxy or extra CA bundle may be required",
+	},
+	ProviderErrTimeout: {
+		"zh": "连接提供商超时，请检查网络或代理",
+		"en": "The provider did not respond in time, check network or proxy",
+	},
+	ProviderErrNetwork: {
+		"zh": "无法连接提供商，请检查网络或代理",
+		"en": "The provider could not be reached, check network or proxy",
+	},
+	ProviderErrUnexpectedSchema: {
+		"zh": "提供商返回了无法识别的数据，请检查 Base URL",
+		"en": "The provider returned an unexpected response, check the base URL",
+	},
+	ProviderErrUpstream: {
+		"zh": "提供商返回错误",
+		"en": "The provider returned an error",
+	},
+}
+
+// LocalizedMessage returns a user-facing message in lang ("zh" or "en",
+// defaulting to Chinese like the web UI).
+func (e *ProviderError) LocalizedMessage(lang string) string {
+	messages, ok := providerErrorMessages[e.Code]
+	if !ok {
+		if e.Detail != "" {
+			return e.Detail
+		}
+		return e.Error()
+	}
+	if message, ok := messages[lang]; ok {
+		return message
+	}
+	return messages["zh"]
+}
+
+// requestLanguage picks "en" or "zh" from the Accept-Language header.
+func requestLanguage(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		switch {
+		case strings.HasPrefix(tag, "zh"):
+			return "zh"
+		case strings.HasPrefix(tag, "en"):
+			return "en"
+		}
+	}
+	return "zh"
+}
+
+// classifyTransportError maps errors from http.Client.Do.
+func classifyTransportError(err error) *ProviderError {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+
+	code := ProviderErrNetwork
+	switch {
+	case errors.As(err, &dnsErr):
+		code = ProviderErrDNS
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		code = ProviderErrTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		code = ProviderErrTimeout
+	}
+	return &ProviderError{Code: code, Err: err}
+}
+
+// classifyStatusError maps an upstream error response. Providers disagree
+// on status codes (Gemini answers 400 for bad keys, OpenAI 429 for empty
+// balances), so the body is consulted as well.
+func classifyStatusError(status int, body []byte) *ProviderError {
+	detail := strings.TrimSpace(string(body))
+	if len(detail) > maxProviderErrorDetail {
+		// Cut on a rune boundary so a Chinese or emoji message is not left
+		// with half a character.
+		cut := maxProviderErrorDetail
+		for cut > 0 && !utf8.RuneStart(detail[cut]) {
+			cut--
+		}
+		detail = detail[:cut] + "..."
+	}
+	lower := strings.ToLower(detail)
+
+	code := ProviderErrUpstream
+	switch {
+	case containsAny(lower, []string{"unsupported_country", "location is not supported", "not available in your region", "region is not supported", "unsupported region"}):
+		code = ProviderErrRegionBlocked
+	case status == http.StatusPaymentRequired,
+		containsAny(lower, []string{"insufficient_quota", "insufficient balance", "insufficient_balance", "credit balance", "exceeded your current quota", "billing"}):
+		code = ProviderErrInsufficientQuota
+	case status == http.StatusUnauthorized,
+		containsAny(lower, []string{"api_key_invalid", "api key not valid", "invalid api key", "invalid_api_key", "incorrect api key", "invalid x-api-key", "authentication"}):
+		code = ProviderErrInvalidKey
+	case status == http.StatusTooManyRequests:
+		code = ProviderErrRateLimited
+	case status == http.StatusForbidden:
+		code = ProviderErrInvalidKey
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		code = ProviderErrTimeout
+	}
+	return &ProviderError{Code: code, Status: status, Detail: detail}
+}
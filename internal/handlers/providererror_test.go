@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestClassifyStatusError(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"error":"nope"}`, ProviderErrInvalidKey},
+		{"forbidden", http.StatusForbidden, `{"error":"nope"}`, ProviderErrInvalidKey},
+		{"gemini bad key on 400", http.StatusBadRequest, `{"error":{"status":"INVALID_ARGUMENT","details":[{"reason":"API_KEY_INVALID"}]}}`, ProviderErrInvalidKey},
+		{"payment required", http.StatusPaymentRequired, `{}`, ProviderErrInsufficientQuota},
+		{"openai empty balance on 429", http.StatusTooManyRequests, `{"error":{"code":"insufficient_quota"}}`, ProviderErrInsufficientQuota},
+		{"deepseek balance", http.StatusBadRequest, `Insufficient Balance`, ProviderErrInsufficientQuota},
+		{"rate limited", http.StatusTooManyRequests, `{"error":"slow down"}`, ProviderErrRateLimited},
+		{"region blocked", http.StatusForbidden, `{"error":{"code":"unsupported_country_region_territory"}}`, ProviderErrRegionBlocked},
+		{"gemini location", http.StatusBadRequest, `User location is not supported for the API use.`, ProviderErrRegionBlocked},
+		{"request timeout", http.StatusRequestTimeout, ``, ProviderErrTimeout},
+		{"gateway timeout", http.StatusGatewayTimeout, ``, ProviderErrTimeout},
+		{"server error", http.StatusInternalServerError, `oops`, ProviderErrUpstream},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := classifyStatusError(tc.status, []byte(tc.body))
+			if err.Code != tc.want || err.Status != tc.status {
+				t.Errorf("code = %q, status = %d, want %q, %d", err.Code, err.Status, tc.want, tc.status)
+			}
+		})
+	}
+}
+
+func TestClassifyStatusErrorTruncatesOnRuneBoundary(t *testing.T) {
+	// The runes after the leading byte are three bytes each, so the byte
+	// limit falls inside one.
+	body := "!" + strings.Repeat("余额不足", maxProviderErrorDetail)
+	err := classifyStatusError(http.StatusBadRequest, []byte(body))
+	if !utf8.ValidString(err.Detail) {
+		t.Errorf("detail is not valid UTF-8: %q", err.Detail[len(err.Detail)-8:])
+	}
+	if !strings.HasSuffix(err.Detail, "...") || len(err.Detail) > maxProviderErrorDetail+len("...") {
+		t.Errorf("detail is %d bytes, want at most %d plus an ellipsis", len(err.Detail), maxProviderErrorDetail)
+	}
+
+	short := classifyStatusError(http.StatusBadRequest, []byte("  余额不足  "))
+	if short.Detail != "余额不足" {
+		t.Errorf("short detail = %q, want it trimmed and kept whole", short.Detail)
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"runtime"
+	"strings"
+
+	"openclaw-setup/internal/config"
+)
+
+// ReachabilityOptions control CheckReachability.
+type ReachabilityOptions struct {
+	// Rewrite replaces a loopback base URL with the first host alias that
+	// answered from inside the container. An alias that could not be tested
+	// is only suggested, never written.
+	Rewrite bool
+	// Runtime and Container, when both are set, test every base URL from
+	// inside the gateway container's network.
+	Runtime   ContainerRuntime
+	Container string
+	// HostAliases reach the Docker host from a container; see
+	// DefaultHostAliases.
+	HostAliases []string
+}
+
+// ReachabilityCheck reports on one provider base URL as the gateway
+// container sees it.
+type ReachabilityCheck struct {
+	Provider    string   `json:"provider"`
+	BaseUrl     string   `json:"baseUrl"`
+	Loopback    bool     `json:"loopback,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	Rewritten   string   `json:"rewritten,omitempty"`
+	Tested      bool     `json:"tested,omitempty"`
+	Reachable   bool     `json:"reachable,omitempty"`
+	Warning     string   `json:"warning,omitempty"`
+}
+
+// DefaultHostAliases are the names for the Docker host inside a container.
+// host.docker.internal needs extra_hosts: host-gateway on Linux, so there
+// the bridge gateway, which works without it, comes first.
+func DefaultHostAliases() []string {
+	gateway := dockerBridgeGateway()
+	if gateway == "" {
+		return []string{dockerHostName}
+	}
+	if runtime.GOOS == "linux" {
+		return []string{gateway, dockerHostName}
+	}
+	return []string{dockerHostName, gateway}
+}
+
+// CheckReachability looks at every custom base URL from the gateway
+// container's point of view, where 127.0.0.1 and localhost are the
+// container itself. It returns the checks and the providers to write, with
+// loopback hosts rewritten when opts.Rewrite is set and a host alias was
+// reachable from the container.
+func CheckReachability(ctx context.Context, providers []config.ProviderKey, opts ReachabilityOptions) ([]ReachabilityCheck, []config.ProviderKey) {
+	aliases := opts.HostAliases
+	if aliases == nil {
+		aliases = DefaultHostAliases()
+	}
+	canTest := opts.Runtime != nil && strings.TrimSpace(opts.Container) != ""
+
+	var checks []ReachabilityCheck
+	updated := append([]config.ProviderKey(nil), providers...)
+	for i, provider := range updated {
+		baseUrl := strings.TrimSpace(provider.BaseUrl)
+		if baseUrl == "" {
+			continue
+		}
+		parsed, err := url.Parse(baseUrl)
+		if err != nil || parsed.Host == "" {
+			continue
+		}
+		check := ReachabilityCheck{Provider: provider.ID(), BaseUrl: baseUrl}
+
+		if !isLoopbackHost(parsed.Hostname()) {
+			if canTest {
+				testReachability(ctx, opts, &check, baseUrl)
+			}
+			checks = append(checks, check)
+			continue
+		}
+
+		check.Loopback = true
+		for _, alias := range aliases {
+			check.Suggestions = append(check.Suggestions, withHost(parsed, alias))
+		}
+		chosen := ""
+		if canTest {
+			for _, candidate := range check.Suggestions {
+				err := opts.Runtime.Probe(ctx, opts.Container, candidate)
+				if errors.Is(err, ErrContainerNotRunning) {
+					break
+				}
+				check.Tested = true
+				if err == nil {
+					chosen = candidate
+					check.Reachable = true
+					break
+				}
+			}
+		}
+
+		switch {
+		case !check.Tested:
+			check.Warning = fmt.Sprintf("%s points at the gateway container itself; it was kept because no host address could be tested from the container", baseUrl)
+			if len(check.Suggestions) > 0 {
+				check.Warning += fmt.Sprintf(", try %s", strings.Join(check.Suggestions, " or "))
+			}
+		case chosen == "":
+			check.Warning = fmt.Sprintf("%s points at the gateway container itself and none of %s is reachable from it", baseUrl, strings.Join(check.Suggestions, ", "))
+		case opts.Rewrite:
+			check.Rewritten = chosen
+			updated[i].BaseUrl = chosen
+			check.Warning = fmt.Sprintf("%s points at the gateway container itself; rewritten to %s", baseUrl, chosen)
+		default:
+			check.Warning = fmt.Sprintf("%s points at the gateway container itself; use %s to reach the host", baseUrl, chosen)
+		}
+		checks = append(checks, check)
+	}
+	return checks, updated
+}
+
+func testReachability(ctx context.Context, opts ReachabilityOptions, check *ReachabilityCheck, rawURL string) {
+	err := opts.Runtime.Probe(ctx, opts.Container, rawURL)
+	if errors.Is(err, ErrContainerNotRunning) {
+		return
+	}
+	check.Tested = true
+	if err != nil {
+		check.Warning = fmt.Sprintf("%s is not reachable from the gateway container: %v", rawURL, err)
+		return
+	}
+	check.Reachable = true
+}
+
+// isLoopbackHost reports whether host means "this machine", which inside a
+// container is the container rather than the Docker host.
+func isLoopbackHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+func withHost(parsed *url.URL, host string) string {
+	rewritten := *parsed
+	if port := parsed.Port(); port != "" {
+		rewritten.Host = net.JoinHostPort(host, port)
+	} else {
+		rewritten.Host = host
+	}
+	return strings.TrimRight(rewritten.String(), "/")
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"openclaw-setup/internal/config"
+)
+
+// fakeRuntime stands in for docker: Probe succeeds for the reachable URLs
+// and fails for the rest, or reports the container as stopped, and Env
+// reads env. A restart waits for restartGate to close when it is set.
+type fakeRuntime struct {
+	mu          sync.Mutex
+	stopped     bool
+	reachable   map[string]bool
+	env         map[string]string
+	restartErr  error
+	restartGate chan struct{}
+	probed      []string
+	restarts    int
+}
+
+func (f *fakeRuntime) Restart(ctx context.Context, composeDir string) error {
+	if f.restartGate != nil {
+		<-f.restartGate
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.restarts++
+	return f.restartErr
+}
+
+func (f *fakeRuntime) Probe(ctx context.Context, container, rawURL string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped {
+		return ErrContainerNotRunning
+	}
+	f.probed = append(f.probed, rawURL)
+	if f.reachable[rawURL] {
+		return nil
+	}
+	return errors.New("connect: connection refused")
+}
+
+func (f *fakeRuntime) Env(ctx context.Context, container, key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped {
+		return "", ErrContainerNotRunning
+	}
+	return f.env[key], nil
+}
+
+func TestCheckReachabilityLoopback(t *testing.T) {
+	const (
+		loopback = "http://127.0.0.1:11434/v1"
+		hostName = "http://host.docker.internal:11434/v1"
+		bridge   = "http://172.17.0.1:11434/v1"
+	)
+	tests := []struct {
+		name      string
+		runtime   *fakeRuntime
+		rewrite   bool
+		wantURL   string
+		tested    bool
+		reachable bool
+		warning   string
+	}{
+		{
+			name:    "untested is kept",
+			rewrite: true,
+			wantURL: loopback,
+			warning: "it was kept because no host address could be tested",
+		},
+		{
+			name:    "stopped container is kept",
+			runtime: &fakeRuntime{stopped: true},
+			rewrite: true,
+			wantURL: loopback,
+			warning: "it was kept because no host address could be tested",
+		},
+		{
+			name:      "rewritten to the alias that answered",
+			runtime:   &fakeRuntime{reachable: map[string]bool{bridge: true}},
+			rewrite:   true,
+			wantURL:   bridge,
+			tested:    true,
+			reachable: true,
+			warning:   "rewritten to " + bridge,
+		},
+		{
+			name:    "nothing reachable is kept",
+			runtime: &fakeRuntime{},
+			rewrite: true,
+			wantURL: loopback,
+			tested:  true,
+			warning: "none of",
+		},
+		{
+			name:      "suggested without rewrite",
+			runtime:   &fakeRuntime{reachable: map[string]bool{hostName: true}},
+			wantURL:   loopback,
+			tested:    true,
+			reachable: true,
+			warning:   "use " + hostName,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ReachabilityOptions{
+				Rewrite:     tt.rewrite,
+				HostAliases: []string{"host.docker.internal", "172.17.0.1"},
+			}
+			if tt.runtime != nil {
+				opts.Runtime = tt.runtime
+				opts.Container = "openclaw-gateway"
+			}
+			providers := []config.ProviderKey{{Provider: "ollama", BaseUrl: loopback}}
+			checks, updated := CheckReachability(context.Background(), providers, opts)
+			if len(checks) != 1 {
+				t.Fatalf("got %d checks, want 1", len(checks))
+			}
+			check := checks[0]
+			if updated[0].BaseUrl != tt.wantURL {
+				t.Errorf("base url = %s, want %s", updated[0].BaseUrl, tt.wantURL)
+			}
+			if providers[0].BaseUrl != loopback {
+				t.Errorf("the input providers were modified")
+			}
+			if !check.Loopback || check.Tested != tt.tested || check.Reachable != tt.reachable {
+				t.Errorf("check = %+v, want tested %v reachable %v", check, tt.tested, tt.reachable)
+			}
+			if !strings.Contains(check.Warning, tt.warning) {
+				t.Errorf("warning = %q, want it to contain %q", check.Warning, tt.warning)
+			}
+			if len(check.Suggestions) != 2 {
+				t.Errorf("suggestions = %v, want both aliases", check.Suggestions)
+			}
+		})
+	}
+}
+
+func TestCheckReachabilityRemote(t *testing.T) {
+	runtime := &fakeRuntime{}
+	providers := []config.ProviderKey{
+		{Provider: "vllm", BaseUrl: "http://10.0.0.5:8000/v1"},
+		{Provider: "openai", Key: "OPENAI_API_KEY", Value: "sk-test"},
+	}
+	checks, updated := CheckReachability(context.Background(), providers, ReachabilityOptions{
+		Rewrite:   true,
+		Runtime:   runtime,
+		Container: "openclaw-gateway",
+	})
+	if len(checks) != 1 {
+		t.Fatalf("got %d checks, want only the provider with a base url", len(checks))
+	}
+	if checks[0].Loopback || !checks[0].Tested || checks[0].Reachable {
+		t.Errorf("check = %+v, want a tested, unreachable remote url", checks[0])
+	}
+	if !strings.Contains(checks[0].Warning, "not reachable from the gateway container") {
+		t.Errorf("warning = %q", checks[0].Warning)
+	}
+	if updated[0].BaseUrl != providers[0].BaseUrl {
+		t.Errorf("a remote base url was rewritten to %s", updated[0].BaseUrl)
+	}
+	if len(runtime.probed) != 1 || runtime.probed[0] != "http://10.0.0.5:8000/v1" {
+		t.Errorf("probed %v", runtime.probed)
+	}
+}
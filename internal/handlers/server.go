@@ -1,16 +1,46 @@
 package handlers
 
 import (
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+
+	"openclaw-setup/internal/config"
 )
 
 type ServerConfig struct {
 	ComposeDir    string
 	ConfigDir     string
 	ContainerName string
-	StaticDir     string
+	// StaticDir serves the UI from disk instead of StaticFS, for
+	// development against a live frontend build.
+	StaticDir string
+	// StaticFS holds the built UI, normally the one embedded in the binary.
+	StaticFS fs.FS
+	StateDir string
+	// ListenAddr is the server's own address, so the doctor does not
+	// report its port as taken.
+	ListenAddr string
+	Version    string
+	Offline    bool
+	// ProviderClient is used for all outbound provider requests.
+	ProviderClient *http.Client
+	// ProxyEnv, when set, is written into the gateway's .env on save.
+	ProxyEnv *config.ProxySettings
+	// Runtime restarts and probes the containers; DockerRuntime when nil.
+	Runtime ContainerRuntime
+	// GatewayToken, from OPENCLAW_GATEWAY_TOKEN or _FILE, is used when a
+	// save does not name a token.
+	GatewayToken string
+	// DraftPassphrase seals the secrets of a saved draft. Without it they
+	// are kept in memory only and must be re-entered after a restart.
+	DraftPassphrase string
+	// Logger receives the request log; slog.Default() when nil.
+	Logger *slog.Logger
 }
 
 type Server struct {
@@ -18,26 +48,88 @@ type Server struct {
 }
 
 func NewServer(cfg ServerConfig) http.Handler {
+	catalogPath := ""
+	if cfg.StateDir != "" {
+		catalogPath = filepath.Join(cfg.StateDir, "models-cache.json")
+	}
+	catalog := NewModelCatalog(catalogPath, cfg.ProviderClient)
+	config.Secrets.AddFromConfigDir(cfg.ConfigDir)
+
+	var audit *AuditLog
+	if cfg.StateDir != "" {
+		audit = NewAuditLog(filepath.Join(cfg.StateDir, "audit.log"))
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	draftPath := ""
+	if cfg.StateDir != "" {
+		draftPath = filepath.Join(cfg.StateDir, "draft.json")
+	}
+	drafts, err := config.NewDraftStore(draftPath, cfg.DraftPassphrase)
+	if err != nil {
+		logger.Warn("load draft", "error", err)
+	}
+
+	configHandler := newConfigHandler(cfg, catalog, audit)
+	draftHandler := NewDraftHandler(cfg, drafts, configHandler, audit)
+
 	mux := http.NewServeMux()
-	mux.Handle("/api/config", NewConfigHandler(cfg))
-	mux.Handle("/api/models", NewModelsHandler())
+	mux.Handle("/api/config", configHandler)
+	mux.Handle("/api/draft", draftHandler)
+	mux.Handle("/api/draft/", draftHandler)
+	mux.Handle("/api/models", NewModelsHandler(catalog))
+	mux.Handle("/api/models/all", NewBulkModelsHandler(cfg, catalog))
+	mux.Handle("/api/probe", NewProbeHandler(cfg.ProviderClient))
+	mux.Handle("/api/discover", NewDiscoverHandler(cfg))
+	mux.Handle("/api/doctor", NewDoctorHandler(cfg, catalog, audit))
+	mux.Handle("/api/migrate", NewMigrateHandler(cfg, audit))
+	mux.Handle("/api/export", NewExportHandler(cfg, audit))
+	mux.Handle("/api/import", NewImportHandler(cfg, audit))
+	mux.Handle("/metrics", NewMetricsHandler())
 
+	static := cfg.StaticFS
 	if cfg.StaticDir != "" {
-		fileServer := http.FileServer(http.Dir(cfg.StaticDir))
-		mux.Handle("/assets/", fileServer)
-		mux.Handle("/", spaHandler(cfg.StaticDir, "index.html"))
+		static = os.DirFS(cfg.StaticDir)
+	}
+	if static != nil {
+		mux.Handle("/assets/", assetsHandler(static))
+		mux.Handle("/", spaHandler(static, "index.html"))
 	}
 
-	return mux
+	return withRequestLog(logger, mux)
 }
 
-func spaHandler(staticDir, indexFile string) http.Handler {
+// assetsHandler serves the hashed build output under /assets/. File names
+// change with their content, so they may be cached forever.
+func assetsHandler(static fs.FS) http.Handler {
+	fileServer := http.FileServerFS(static)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := filepath.Join(staticDir, filepath.Clean(r.URL.Path))
-		if info, err := os.Stat(path); err == nil && !info.IsDir() {
-			http.ServeFile(w, r, path)
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if _, err := fs.Stat(static, name); err == nil {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// spaHandler serves existing files and falls back to indexFile for client
+// side routes. These responses are revalidated on every load so a new
+// release is picked up immediately.
+func spaHandler(static fs.FS, indexFile string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if info, err := fs.Stat(static, name); name != "" && err == nil && !info.IsDir() {
+			http.ServeFileFS(w, r, static, name)
+			return
+		}
+		if _, err := fs.Stat(static, indexFile); err != nil {
+			http.Error(w, "web UI is not built: run make build-web", http.StatusServiceUnavailable)
 			return
 		}
-		http.ServeFile(w, r, filepath.Join(staticDir, indexFile))
+		http.ServeFileFS(w, r, static, indexFile)
 	})
 }
@@ -0,0 +1,23 @@
+// Package web embeds the built setup UI so the release binary serves it
+// without any files next to it.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// dist is filled by `make build-web`. The committed .gitkeep keeps the
+// directory, and so the embed pattern, valid before the first build.
+//
+//go:embed all:dist
+var dist embed.FS
+
+// Dist returns the embedded UI rooted at dist/.
+func Dist() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
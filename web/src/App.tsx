@@ -1,21 +1,62 @@
-import { useEffect, useMemo, useState } from "react";
+import { useEffect, useMemo, useRef, useState } from "react";
+
+type DiscoveredRuntime = {
+  runtime: string;
+  name: string;
+  host: string;
+  baseUrl: string;
+  provider: string;
+  models: string[];
+  reachability?: { warning?: string };
+};
+
+type FileChange = {
+  path: string;
+  action: "create" | "update" | "unchanged";
+  diff?: string;
+};
 
 type SaveResponse = {
   ok: boolean;
   restarted: boolean;
   message: string;
   restartError?: string;
+  dryRun?: boolean;
+  changes?: FileChange[];
+  errors?: { path: string; message: string }[];
+  suggestions?: string[];
+  modelCheck?: { model: string; verified: boolean; source?: string; warning?: string };
+  reachability?: { baseUrl: string; rewritten?: string; warning?: string }[];
+  revision?: string;
 };
 
 type ProviderOption = {
   id: string;
   label: string;
   envKey?: string;
-  group: "mainstream" | "domestic";
+  group: "mainstream" | "domestic" | "local";
   supportsAutoModels: boolean;
+  keyless?: boolean;
+  defaultBaseUrl?: string;
   defaultModel?: string;
+  regions?: string[];
+  defaultRegion?: string;
 };
 
+const regionLabels: Record<string, string> = {
+  intl: "国际站",
+  cn: "国内站",
+  custom: "自定义地址",
+};
+
+const apiDialects = [
+  { id: "", label: "默认" },
+  { id: "openai-completions", label: "OpenAI Chat Completions" },
+  { id: "openai-responses", label: "OpenAI Responses" },
+  { id: "anthropic-messages", label: "Anthropic Messages" },
+  { id: "google-generative-ai", label: "Google Generative AI" },
+];
+
 const providerOptions: ProviderOption[] = [
   {
     id: "openai",
@@ -62,7 +103,7 @@ const providerOptions: ProviderOption[] = [
     label: "Cohere",
     envKey: "COHERE_API_KEY",
     group: "mainstream",
-    supportsAutoModels: false,
+    supportsAutoModels: true,
     defaultModel: "cohere/command-r-plus",
   },
   {
@@ -70,8 +111,10 @@ const providerOptions: ProviderOption[] = [
     label: "MiniMax",
     envKey: "MINIMAX_API_KEY",
     group: "domestic",
-    supportsAutoModels: false,
+    supportsAutoModels: true,
     defaultModel: "minimax/MiniMax-M2.1",
+    regions: ["intl", "cn"],
+    defaultRegion: "intl",
   },
   {
     id: "deepseek",
@@ -88,14 +131,18 @@ const providerOptions: ProviderOption[] = [
     group: "domestic",
     supportsAutoModels: true,
     defaultModel: "moonshot/kimi-k2.5",
+    regions: ["cn", "intl"],
+    defaultRegion: "cn",
   },
   {
     id: "zai",
     label: "ZAI / GLM",
     envKey: "ZAI_API_KEY",
     group: "domestic",
-    supportsAutoModels: false,
+    supportsAutoModels: true,
     defaultModel: "zai/glm-4.7",
+    regions: ["intl", "cn"],
+    defaultRegion: "intl",
   },
   {
     id: "qwen",
@@ -104,20 +151,60 @@ const providerOptions: ProviderOption[] = [
     group: "domestic",
     supportsAutoModels: true,
     defaultModel: "qwen/qwen2.5-coder-32b-instruct",
+    regions: ["cn", "intl"],
+    defaultRegion: "cn",
+  },
+  {
+    id: "ollama",
+    label: "Ollama",
+    group: "local",
+    supportsAutoModels: true,
+    keyless: true,
+    defaultBaseUrl: "http://host.docker.internal:11434/v1",
+    defaultModel: "ollama/qwen3:8b",
   },
   {
     id: "custom",
     label: "自定义提供商",
-    group: "domestic",
-    supportsAutoModels: false,
+    group: "local",
+    supportsAutoModels: true,
   },
 ];
 
+const actionLabels: Record<FileChange["action"], string> = {
+  create: "新建",
+  update: "修改",
+  unchanged: "无变化",
+};
+
+const diffLineClass = (line: string) => {
+  if (line.startsWith("+++") || line.startsWith("---")) return "diff-meta";
+  if (line.startsWith("@@")) return "diff-hunk";
+  if (line.startsWith("+")) return "diff-add";
+  if (line.startsWith("-")) return "diff-del";
+  return "";
+};
+
 export default function App() {
   const [providerId, setProviderId] = useState("openai");
   const [providerEnvKey, setProviderEnvKey] = useState("OPENAI_API_KEY");
   const [customEnvKey, setCustomEnvKey] = useState("");
   const [apiKey, setApiKey] = useState("");
+  const [region, setRegion] = useState("");
+  const [baseUrl, setBaseUrl] = useState("");
+  const [api, setApi] = useState("");
+  const [probing, setProbing] = useState(false);
+  const [rewriteLoopback, setRewriteLoopback] = useState(true);
+  // The configuration revision the form was loaded at; saves send it as
+  // If-Match so a stale page cannot overwrite newer changes.
+  const [revision, setRevision] = useState<string | null>(null);
+  const [runtimes, setRuntimes] = useState<DiscoveredRuntime[]>([]);
+  const [discovering, setDiscovering] = useState(false);
+  const [discoverMessage, setDiscoverMessage] = useState<string | null>(null);
+  // A discovered runtime is applied after the provider change has reset
+  // the form to that provider's defaults.
+  const pendingRuntime = useRef<{ baseUrl: string; model: string } | null>(null);
+  const [probeMessage, setProbeMessage] = useState<string | null>(null);
   const [model, setModel] = useState("openai/gpt-4o-mini");
   const [models, setModels] = useState<string[]>([]);
   const [modelsLoading, setModelsLoading] = useState(false);
@@ -125,14 +212,23 @@ export default function App() {
   const [gatewayToken, setGatewayToken] = useState("");
   const [status, setStatus] = useState<SaveResponse | null>(null);
   const [saving, setSaving] = useState(false);
+  const [preview, setPreview] = useState<FileChange[] | null>(null);
+  // Set when the user keeps a model the provider's list does not include.
+  const [forceModel, setForceModel] = useState(false);
 
   const canSave = useMemo(() => model.trim().length > 0, [model]);
+  const providerOption = providerOptions.find((item) => item.id === providerId);
+  const regionChoices = providerOption?.regions ? [...providerOption.regions, "custom"] : [];
+  const keyless = providerOption?.keyless ?? false;
+  const showBaseUrl =
+    providerId === "custom" || region === "custom" || Boolean(providerOption?.defaultBaseUrl);
 
   useEffect(() => {
-    if (!gatewayToken) {
-      setGatewayToken(createToken());
-    }
-  }, [gatewayToken]);
+    fetch("/api/config")
+      .then((resp) => resp.json())
+      .then((data) => setRevision(data.revision ?? null))
+      .catch(() => setRevision(null));
+  }, []);
 
   useEffect(() => {
     const option = providerOptions.find((item) => item.id === providerId);
@@ -144,10 +240,27 @@ export default function App() {
     if (option?.defaultModel) {
       setModel(option.defaultModel);
     }
+    setRegion(option?.defaultRegion ?? "");
+    setBaseUrl(option?.defaultBaseUrl ?? "");
+    setApi("");
+    setProbeMessage(null);
+    if (pendingRuntime.current) {
+      setBaseUrl(pendingRuntime.current.baseUrl);
+      setModel(pendingRuntime.current.model);
+      pendingRuntime.current = null;
+    }
     setModels([]);
     setModelsMessage(null);
   }, [providerId, customEnvKey]);
 
+  useEffect(() => {
+    setForceModel(false);
+  }, [model, providerId]);
+
+  useEffect(() => {
+    setPreview(null);
+  }, [model, apiKey, gatewayToken, providerEnvKey, region, baseUrl, api, rewriteLoopback]);
+
   const createToken = () => {
     const bytes = crypto.getRandomValues(new Uint8Array(24));
     return Array.from(bytes)
@@ -159,6 +272,43 @@ export default function App() {
     setGatewayToken(createToken());
   };
 
+  const endpoint = () => ({
+    region: region === "custom" ? "" : region,
+    baseUrl: showBaseUrl ? baseUrl.trim() : "",
+    api: showBaseUrl ? api : "",
+  });
+
+  const customProviderId = () => customEnvKey.trim().replace(/_API_KEY$/i, "").toLowerCase();
+
+  const providerEntries = () => {
+    if (keyless) {
+      return baseUrl.trim() ? [{ provider: providerId, key: "", value: "", ...endpoint() }] : [];
+    }
+    // Local runtimes configured as custom providers usually need no key.
+    if (providerId === "custom" && !apiKey.trim() && baseUrl.trim() && customProviderId()) {
+      return [{ provider: customProviderId(), key: "", value: "", ...endpoint() }];
+    }
+    if (!providerEnvKey.trim() || !apiKey.trim()) return [];
+    return [
+      {
+        provider: providerId === "custom" ? "" : providerId,
+        key: providerEnvKey.trim(),
+        value: apiKey.trim(),
+        ...endpoint(),
+      },
+    ];
+  };
+
+  const buildPayload = (token: string, dryRun: boolean) => ({
+    model: model.trim(),
+    gatewayToken: token,
+    providers: providerEntries(),
+    rewriteLoopback: showBaseUrl && rewriteLoopback,
+    checkReachability: showBaseUrl,
+    force: forceModel,
+    dryRun,
+  });
+
   const handleSubmit = async (event: React.FormEvent) => {
     event.preventDefault();
     if (!canSave || saving) return;
@@ -166,24 +316,40 @@ export default function App() {
     setStatus(null);
 
     try {
-      const token = gatewayToken.trim() || createToken();
-      if (!gatewayToken.trim()) {
-        setGatewayToken(token);
+      // An empty token keeps the one the gateway already uses; a new one
+      // is only sent after the user asked for it with 重新生成.
+      const token = gatewayToken.trim();
+      const dryRun = preview === null;
+      const headers: Record<string, string> = { "Content-Type": "application/json" };
+      if (revision) {
+        headers["If-Match"] = `"${revision}"`;
       }
-      const payload = {
-        model: model.trim(),
-        gatewayToken: token,
-        providers:
-          providerEnvKey.trim() && apiKey.trim()
-            ? [{ key: providerEnvKey.trim(), value: apiKey.trim() }]
-            : [],
-      };
       const resp = await fetch("/api/config", {
         method: "POST",
-        headers: { "Content-Type": "application/json" },
-        body: JSON.stringify(payload),
+        headers,
+        body: JSON.stringify(buildPayload(token, dryRun)),
       });
       const data = (await resp.json()) as SaveResponse;
+      if (resp.status === 409) {
+        // Adopt the newer revision; the next preview shows the diff against it.
+        setRevision(data.revision ?? null);
+        setPreview(null);
+        setStatus(data);
+        return;
+      }
+      if (data.revision) {
+        setRevision(data.revision);
+      }
+      if (dryRun && data.ok) {
+        setPreview(data.changes ?? []);
+        const warnings = [
+          data.modelCheck?.warning,
+          ...(data.reachability ?? []).map((item) => item.warning),
+        ].filter(Boolean);
+        setStatus(warnings.length > 0 ? { ...data, message: warnings.join("；") } : null);
+        return;
+      }
+      setPreview(null);
       setStatus(data);
     } catch (err) {
       setStatus({
@@ -198,7 +364,7 @@ export default function App() {
   };
 
   const handleFetchModels = async () => {
-    if (!apiKey.trim()) {
+    if (!apiKey.trim() && !keyless && !(providerId === "custom" && baseUrl.trim())) {
       setModelsMessage("请先填写 API Key");
       return;
     }
@@ -208,11 +374,17 @@ export default function App() {
       const resp = await fetch("/api/models", {
         method: "POST",
         headers: { "Content-Type": "application/json" },
-        body: JSON.stringify({ provider: providerId, apiKey: apiKey.trim() }),
+        body: JSON.stringify({
+          provider: providerId === "custom" ? customProviderId() : providerId,
+          apiKey: apiKey.trim(),
+          ...endpoint(),
+          filter: { chatOnly: true },
+        }),
       });
       const data = await resp.json();
       if (!resp.ok) {
-        setModelsMessage(data.message || "获取模型失败");
+        const upstream = data.upstreamStatus ? `（HTTP ${data.upstreamStatus}）` : "";
+        setModelsMessage(`${data.message || "获取模型失败"}${upstream}`);
         setModels([]);
         return;
       }
@@ -230,6 +402,83 @@ export default function App() {
     }
   };
 
+  const handleProbe = async () => {
+    if (!baseUrl.trim()) {
+      setProbeMessage("请先填写 Base URL");
+      return;
+    }
+    setProbing(true);
+    setProbeMessage(null);
+    try {
+      const resp = await fetch("/api/probe", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ baseUrl: baseUrl.trim(), apiKey: apiKey.trim() }),
+      });
+      const data = await resp.json();
+      if (!resp.ok) {
+        setProbeMessage(data.message || "探测失败");
+        return;
+      }
+      const results: { api: string; baseUrl: string; supported: boolean }[] = Array.isArray(data.results)
+        ? data.results
+        : [];
+      const supported = results.filter((item) => item.supported).map((item) => item.api);
+      const recommended = results.find((item) => item.api === data.recommended);
+      if (!recommended) {
+        setProbeMessage("未识别出支持的协议，请手动选择");
+        return;
+      }
+      setApi(recommended.api);
+      setBaseUrl(recommended.baseUrl);
+      setProbeMessage(`支持：${supported.join("、")}，已选择 ${recommended.api}`);
+    } catch {
+      setProbeMessage("探测失败，请检查网络或代理");
+    } finally {
+      setProbing(false);
+    }
+  };
+
+  const handleDiscover = async () => {
+    setDiscovering(true);
+    setDiscoverMessage(null);
+    try {
+      const resp = await fetch("/api/discover");
+      const data = await resp.json();
+      const list: DiscoveredRuntime[] = Array.isArray(data.runtimes) ? data.runtimes : [];
+      setRuntimes(list);
+      setDiscoverMessage(list.length === 0 ? data.message || "未发现本地模型服务" : null);
+    } catch {
+      setDiscoverMessage("发现失败");
+    } finally {
+      setDiscovering(false);
+    }
+  };
+
+  const selectRuntime = (runtime: DiscoveredRuntime, modelId: string) => {
+    const nextModel = `${runtime.provider}/${modelId}`;
+    if (runtime.provider === "ollama") {
+      pendingRuntime.current = { baseUrl: runtime.baseUrl, model: nextModel };
+      if (providerId === "ollama") {
+        setBaseUrl(runtime.baseUrl);
+        setModel(nextModel);
+        pendingRuntime.current = null;
+      } else {
+        setProviderId("ollama");
+      }
+      return;
+    }
+    const envKey = `${runtime.provider.toUpperCase()}_API_KEY`;
+    if (providerId === "custom" && customEnvKey === envKey) {
+      setBaseUrl(runtime.baseUrl);
+      setModel(nextModel);
+      return;
+    }
+    pendingRuntime.current = { baseUrl: runtime.baseUrl, model: nextModel };
+    setProviderId("custom");
+    setCustomEnvKey(envKey);
+  };
+
   const handleCopyToken = async () => {
     try {
       await navigator.clipboard.writeText(gatewayToken);
@@ -248,6 +497,34 @@ export default function App() {
         </header>
 
         <form className="form" onSubmit={handleSubmit}>
+          <div className="field">
+            <div className="inline">
+              <button type="button" className="ghost" onClick={handleDiscover} disabled={discovering}>
+                {discovering ? "查找中" : "发现本地模型"}
+              </button>
+            </div>
+            {discoverMessage && <div className="hint">{discoverMessage}</div>}
+            {runtimes.map((runtime) => (
+              <div key={`${runtime.runtime}@${runtime.baseUrl}`} className="hint">
+                <span>
+                  {runtime.name}（{runtime.baseUrl}）：
+                </span>
+                {runtime.reachability?.warning && <span>{runtime.reachability.warning}；</span>}
+                {runtime.models.length === 0 && <span>未加载模型</span>}
+                {runtime.models.map((item) => (
+                  <button
+                    key={item}
+                    type="button"
+                    className="ghost"
+                    onClick={() => selectRuntime(runtime, item)}
+                  >
+                    {item}
+                  </button>
+                ))}
+              </div>
+            ))}
+          </div>
+
           <label className="field">
             <span>模型提供商</span>
             <select value={providerId} onChange={(e) => setProviderId(e.target.value)}>
@@ -269,18 +546,29 @@ export default function App() {
                     </option>
                   ))}
               </optgroup>
+              <optgroup label="本地与自定义">
+                {providerOptions
+                  .filter((item) => item.group === "local")
+                  .map((item) => (
+                    <option key={item.id} value={item.id}>
+                      {item.label}
+                    </option>
+                  ))}
+              </optgroup>
             </select>
           </label>
 
-          <label className="field">
-            <span>API Key</span>
-            <input
-              type="password"
-              value={apiKey}
-              onChange={(e) => setApiKey(e.target.value)}
-              placeholder={providerEnvKey ? `${providerEnvKey}...` : "API Key"}
-            />
-          </label>
+          {!keyless && (
+            <label className="field">
+              <span>API Key</span>
+              <input
+                type="password"
+                value={apiKey}
+                onChange={(e) => setApiKey(e.target.value)}
+                placeholder={providerEnvKey ? `${providerEnvKey}...` : "API Key"}
+              />
+            </label>
+          )}
 
           {providerId === "custom" && (
             <label className="field">
@@ -293,6 +581,57 @@ export default function App() {
             </label>
           )}
 
+          {regionChoices.length > 0 && (
+            <label className="field">
+              <span>接入地址</span>
+              <select value={region} onChange={(e) => setRegion(e.target.value)}>
+                {regionChoices.map((item) => (
+                  <option key={item} value={item}>
+                    {regionLabels[item] ?? item}
+                  </option>
+                ))}
+              </select>
+            </label>
+          )}
+
+          {showBaseUrl && (
+            <label className="field">
+              <span>Base URL</span>
+              <div className="inline stretch">
+                <input
+                  value={baseUrl}
+                  onChange={(e) => setBaseUrl(e.target.value)}
+                  placeholder="例如 https://example.com/v1"
+                />
+                <button type="button" className="ghost" onClick={handleProbe} disabled={probing}>
+                  {probing ? "探测中" : "探测协议"}
+                </button>
+              </div>
+              {probeMessage && <div className="hint">{probeMessage}</div>}
+              <span className="hint">
+                <input
+                  type="checkbox"
+                  checked={rewriteLoopback}
+                  onChange={(e) => setRewriteLoopback(e.target.checked)}
+                />
+                将 127.0.0.1 / localhost 改写为容器可访问的宿主机地址
+              </span>
+            </label>
+          )}
+
+          {showBaseUrl && (
+            <label className="field">
+              <span>API 协议</span>
+              <select value={api} onChange={(e) => setApi(e.target.value)}>
+                {apiDialects.map((item) => (
+                  <option key={item.id} value={item.id}>
+                    {item.label}
+                  </option>
+                ))}
+              </select>
+            </label>
+          )}
+
           <label className="field">
             <span>默认模型</span>
             <div className="inline stretch">
@@ -327,20 +666,49 @@ export default function App() {
                 className="token-input"
                 value={gatewayToken}
                 onChange={(e) => setGatewayToken(e.target.value)}
-                placeholder="自动生成，可手动修改"
+                placeholder="留空沿用现有 Token"
               />
               <button type="button" className="ghost" onClick={generateToken}>
                 重新生成
               </button>
-              <button type="button" className="ghost" onClick={handleCopyToken}>
+              <button type="button" className="ghost" onClick={handleCopyToken} disabled={!gatewayToken}>
                 复制
               </button>
             </div>
           </label>
 
-          <button type="submit" className="primary" disabled={!canSave || saving}>
-            {saving ? "保存中..." : "保存并重启"}
-          </button>
+          {preview && (
+            <div className="preview">
+              <strong>即将写入以下变更（密钥已隐藏）</strong>
+              {preview.map((change) => (
+                <div key={change.path} className="preview-file">
+                  <div className="preview-path">
+                    {actionLabels[change.action]} · {change.path}
+                  </div>
+                  {change.diff && (
+                    <pre className="diff">
+                      {change.diff.split("\n").map((line, index) => (
+                        <div key={index} className={diffLineClass(line)}>
+                          {line}
+                        </div>
+                      ))}
+                    </pre>
+                  )}
+                </div>
+              ))}
+            </div>
+          )}
+
+          <div className="inline">
+            {preview && (
+              <button type="button" className="ghost" onClick={() => setPreview(null)}>
+                返回修改
+              </button>
+            )}
+            <button type="submit" className="primary grow" disabled={!canSave || saving}>
+              {saving ? "处理中..." : preview ? "确认保存并重启" : "预览变更"}
+            </button>
+          </div>
         </form>
 
         {status && (
@@ -349,6 +717,39 @@ export default function App() {
             {status.restartError && (
               <div className="status-detail">重启失败：{status.restartError}</div>
             )}
+            {status.suggestions && status.suggestions.length > 0 && (
+              <div className="status-detail inline">
+                <span>你是否想用：</span>
+                {status.suggestions.map((item) => (
+                  <button
+                    key={item}
+                    type="button"
+                    className="ghost"
+                    onClick={() => {
+                      setModel(item);
+                      setStatus(null);
+                    }}
+                  >
+                    {item}
+                  </button>
+                ))}
+                <button
+                  type="button"
+                  className="ghost"
+                  onClick={() => {
+                    setForceModel(true);
+                    setStatus(null);
+                  }}
+                >
+                  仍然使用 {model.trim()}
+                </button>
+              </div>
+            )}
+            {status.errors?.map((item) => (
+              <div key={item.path + item.message} className="status-detail">
+                {item.path}：{item.message}
+              </div>
+            ))}
           </div>
         )}
       </div>